@@ -0,0 +1,702 @@
+// Package client is a Go client for the tictacgo HTTP API described in api/openapi.json.
+// keep the types and methods here in step with the spec when endpoints change.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a tictacgo server. sign in with Guest, Register or Login first,
+// the session cookie they return is kept in the HTTP client's cookie jar. or use
+// Token/GuestToken to get a bearer token instead, it is refreshed when it runs out
+type Client struct {
+	BaseURL    string       // e.g. "http://localhost:8080"
+	HTTPClient *http.Client // defaults to a client with a cookie jar and a 10 second timeout
+	PlayerID   string       // the signed in account's ID, which is its player ID in every lobby
+	Invite     string       // invite token for private lobbies
+	Passcode   string       // passcode for private lobbies
+
+	AccessToken  string    // sent as a bearer token when set
+	RefreshToken string    // used to get a new AccessToken shortly before TokenExpires
+	TokenExpires time.Time // when AccessToken stops working
+}
+
+const tokenPath = "/api/v1/auth/token"
+
+// New returns a client for the server at baseURL
+func New(baseURL string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Jar: jar},
+	}
+}
+
+// Error is returned for any non-2xx response
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// LobbySettings are chosen when a lobby is created
+type LobbySettings struct {
+	Name           string `json:"name,omitempty"`
+	Variant        string `json:"variant,omitempty"`
+	BoardSize      int    `json:"boardSize,omitempty"`
+	TimeControl    int    `json:"timeControl,omitempty"`
+	Visibility     string `json:"visibility,omitempty"`
+	SpectatorLimit *int   `json:"spectatorLimit,omitempty"` // nil takes the server default, 0 disables spectating
+	ChatEnabled    *bool  `json:"chatEnabled,omitempty"`
+	SeriesLength   int    `json:"seriesLength,omitempty"`
+	FirstMove      string `json:"firstMove,omitempty"`
+	StartPosition  string `json:"startPosition,omitempty"` // position code, see Position
+	PostGameReview bool   `json:"postGameReview,omitempty"`
+	Rated          bool   `json:"rated,omitempty"`        // no hints
+	HintsPerGame   int    `json:"hintsPerGame,omitempty"` // 0 turns hints off
+}
+
+// CreateLobbyRequest is the body for creating a lobby, unset fields take the server defaults.
+// a signed in creator becomes the host and the lobby is named after them
+type CreateLobbyRequest struct {
+	LobbySettings
+	Username string `json:"username,omitempty"`
+	Passcode string `json:"passcode,omitempty"`
+}
+
+// CreateLobbyResponse is returned by POST /create-lobby
+type CreateLobbyResponse struct {
+	ID       string        `json:"id"`
+	URL      string        `json:"url"`
+	Settings LobbySettings `json:"settings"`
+}
+
+// LobbySummary is an entry of GET /lobbies
+type LobbySummary struct {
+	ID         string
+	Name       string
+	MaxPlayers int
+	Players    []struct {
+		ID     string
+		Name   string
+		Symbol string
+	}
+	Settings LobbySettings
+}
+
+// Player is a seated player or spectator
+type Player struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Symbol string `json:"symbol"`
+	Role   string `json:"role"`
+	Ready  bool   `json:"ready"`
+	IsBot  bool   `json:"isBot"`
+}
+
+// PlayerList is returned by ListPlayers
+type PlayerList struct {
+	HostID     string   `json:"hostId"`
+	Players    []Player `json:"players"`
+	Spectators []Player `json:"spectators"`
+}
+
+// Lobby is returned by the /api/v1/lobbies endpoints
+type Lobby struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	URL         string        `json:"url"`
+	HostID      string        `json:"hostId"`
+	Settings    LobbySettings `json:"settings"`
+	GameStarted bool          `json:"gameStarted"`
+	Players     []Player      `json:"players"`
+	Spectators  []Player      `json:"spectators"`
+}
+
+// Game is the state of the board
+type Game struct {
+	Board       [9]string      `json:"board"`
+	CurrentTurn string         `json:"currentTurn"`
+	GameStarted bool           `json:"gameStarted"`
+	Variant     string         `json:"variant"`
+	Clock       map[string]int `json:"clock,omitempty"`
+	Position    string         `json:"position"` // code of the board and turn, see GetPosition
+}
+
+// GameMessage is the result of a move
+type GameMessage struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Next     string `json:"next"`
+	Winner   string `json:"winner"`
+	Position int    `json:"position"`
+	Symbol   string `json:"symbol"`
+
+	Termination string `json:"termination,omitempty"` // resign, timeout or agreed, empty when decided on the board
+}
+
+// MoveResponse is returned by Move
+type MoveResponse struct {
+	Result GameMessage `json:"result"`
+	Game   Game        `json:"game"`
+}
+
+// ChatMessage is an entry of the chat history
+type ChatMessage struct {
+	ID        int                 `json:"id"`
+	Text      string              `json:"text"`
+	Sender    string              `json:"sender"`
+	Timestamp time.Time           `json:"timestamp"`
+	Emote     bool                `json:"emote,omitempty"`    // posted with /me
+	Channel   string              `json:"channel,omitempty"`  // "players", "spectators" or "whisper", empty for everyone
+	SenderID  string              `json:"senderId,omitempty"` // empty for GAMEMASTER
+	To        string              `json:"to,omitempty"`       // player ID a whisper is for
+	ToName    string              `json:"toName,omitempty"`
+	EditedAt  *time.Time          `json:"editedAt,omitempty"`
+	Deleted   bool                `json:"deleted,omitempty"`   // a tombstone, the text is gone
+	Reactions map[string][]string `json:"reactions,omitempty"` // player IDs by emoji
+}
+
+// Account is a signed in player
+type Account struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Guest    bool   `json:"guest"`
+}
+
+// Guest starts a session as a guest shown as name, the server picks a name when it is empty
+func (c *Client) Guest(name string) (*Account, error) {
+	return c.signIn("/api/v1/auth/guest", map[string]string{"name": name})
+}
+
+// Register creates an account and signs in with it
+func (c *Client) Register(username string, password string) (*Account, error) {
+	return c.signIn("/api/v1/auth/register", map[string]string{"username": username, "password": password})
+}
+
+// Login signs in with a username and password
+func (c *Client) Login(username string, password string) (*Account, error) {
+	return c.signIn("/api/v1/auth/login", map[string]string{"username": username, "password": password})
+}
+
+// Upgrade gives the signed in guest account a username and password, keeping its ID
+func (c *Client) Upgrade(username string, password string) (*Account, error) {
+	return c.signIn("/api/v1/auth/upgrade", map[string]string{"username": username, "password": password})
+}
+
+// Logout ends the session
+func (c *Client) Logout() error {
+	c.PlayerID = ""
+	return c.do(http.MethodPost, "/api/v1/auth/logout", nil, nil)
+}
+
+// Me returns the signed in account
+func (c *Client) Me() (*Account, error) {
+	var out Account
+	return &out, c.do(http.MethodGet, "/api/v1/auth/me", nil, &out)
+}
+
+// TokenResponse is returned by the token endpoint
+type TokenResponse struct {
+	AccessToken  string  `json:"accessToken"`
+	TokenType    string  `json:"tokenType"`
+	ExpiresIn    int     `json:"expiresIn"`
+	RefreshToken string  `json:"refreshToken"`
+	Account      Account `json:"account"`
+}
+
+// Token signs in with a username and password and keeps the returned bearer token
+func (c *Client) Token(username string, password string) (*TokenResponse, error) {
+	return c.token(map[string]string{"grantType": "password", "username": username, "password": password})
+}
+
+// GuestToken starts a guest account and keeps the returned bearer token
+func (c *Client) GuestToken(name string) (*TokenResponse, error) {
+	return c.token(map[string]string{"grantType": "guest", "name": name})
+}
+
+// RefreshTokens swaps the refresh token for a new pair, the old refresh token stops working
+func (c *Client) RefreshTokens() (*TokenResponse, error) {
+	return c.token(map[string]string{"grantType": "refresh_token", "refreshToken": c.RefreshToken})
+}
+
+// RevokeTokens revokes the client's tokens, or every token of the account when all is set
+func (c *Client) RevokeTokens(all bool) error {
+	body := map[string]interface{}{"refreshToken": c.RefreshToken, "all": all}
+	if err := c.do(http.MethodPost, tokenPath+"/revoke", body, nil); err != nil {
+		return err
+	}
+	c.AccessToken, c.RefreshToken, c.TokenExpires = "", "", time.Time{}
+	return nil
+}
+
+// FreshAccessToken returns the access token, refreshing it first when it is about to expire.
+// pass it as wsclient.Config.TokenSource so reconnects use a valid token
+func (c *Client) FreshAccessToken() (string, error) {
+	if c.AccessToken != "" && c.RefreshToken != "" && time.Until(c.TokenExpires) < 30*time.Second {
+		if _, err := c.RefreshTokens(); err != nil {
+			return "", err
+		}
+	}
+	return c.AccessToken, nil
+}
+
+func (c *Client) token(body interface{}) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(http.MethodPost, tokenPath, body, &out); err != nil {
+		return nil, err
+	}
+	c.AccessToken = out.AccessToken
+	c.RefreshToken = out.RefreshToken
+	c.TokenExpires = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+	c.PlayerID = out.Account.ID
+	return &out, nil
+}
+
+// Session returns the session cookie's value, for signing in a websocket (see wsclient.Config)
+func (c *Client) Session() string {
+	if c.HTTPClient == nil || c.HTTPClient.Jar == nil {
+		return ""
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	for _, cookie := range c.HTTPClient.Jar.Cookies(u) {
+		if cookie.Name == "session" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func (c *Client) signIn(path string, body interface{}) (*Account, error) {
+	var out Account
+	if err := c.do(http.MethodPost, path, body, &out); err != nil {
+		return nil, err
+	}
+	c.PlayerID = out.ID
+	return &out, nil
+}
+
+// CreateLobbyForm creates a lobby with POST /create-lobby
+func (c *Client) CreateLobbyForm(req CreateLobbyRequest) (*CreateLobbyResponse, error) {
+	var out CreateLobbyResponse
+	return &out, c.do(http.MethodPost, "/create-lobby", req, &out)
+}
+
+// ListLobbies returns the public lobbies from GET /lobbies
+func (c *Client) ListLobbies() ([]LobbySummary, error) {
+	var out []LobbySummary
+	return out, c.do(http.MethodGet, "/lobbies", nil, &out)
+}
+
+// CreateLobby creates a lobby with POST /api/v1/lobbies
+func (c *Client) CreateLobby(req CreateLobbyRequest) (*Lobby, error) {
+	var out Lobby
+	return &out, c.do(http.MethodPost, "/api/v1/lobbies", req, &out)
+}
+
+// GetLobby fetches a lobby
+func (c *Client) GetLobby(lobbyID string) (*Lobby, error) {
+	var out Lobby
+	return &out, c.do(http.MethodGet, lobbyPath(lobbyID, ""), nil, &out)
+}
+
+// DeleteLobby closes a lobby, the signed in account must be the host
+func (c *Client) DeleteLobby(lobbyID string) error {
+	return c.do(http.MethodDelete, lobbyPath(lobbyID, ""), nil, nil)
+}
+
+// GetGame fetches the board of a lobby
+func (c *Client) GetGame(lobbyID string) (*Game, error) {
+	var out Game
+	return &out, c.do(http.MethodGet, lobbyPath(lobbyID, "/game"), nil, &out)
+}
+
+// Move plays a position (0-8) for the client's player
+func (c *Client) Move(lobbyID string, position int) (*MoveResponse, error) {
+	var out MoveResponse
+	body := map[string]int{"position": position}
+	return &out, c.do(http.MethodPost, lobbyPath(lobbyID, "/moves"), body, &out)
+}
+
+// ListPlayers returns the seated players and spectators of a lobby
+func (c *Client) ListPlayers(lobbyID string) (*PlayerList, error) {
+	var out PlayerList
+	return &out, c.do(http.MethodGet, lobbyPath(lobbyID, "/players"), nil, &out)
+}
+
+// Join joins a lobby as the signed in account, joining again returns the existing player
+func (c *Client) Join(lobbyID string) (*Player, error) {
+	var out Player
+	return &out, c.do(http.MethodPost, lobbyPath(lobbyID, "/players"), nil, &out)
+}
+
+// Ready readies (or un-readies) the client's player
+func (c *Client) Ready(lobbyID string, ready bool) (*Game, error) {
+	var out Game
+	body := map[string]bool{"ready": ready}
+	return &out, c.do(http.MethodPost, lobbyPath(lobbyID, "/ready"), body, &out)
+}
+
+// ChatPage is a page of chat history, oldest first
+type ChatPage struct {
+	Messages []ChatMessage `json:"messages"`
+	HasMore  bool          `json:"hasMore"` // older messages are left, ask again with before set to Messages[0].ID
+}
+
+// ChatHistory returns the newest messages older than before (0 for the newest overall),
+// limit 0 takes the server's page size
+func (c *Client) ChatHistory(lobbyID string, before int, limit int) (*ChatPage, error) {
+	return c.ChannelHistory(lobbyID, "all", before, limit)
+}
+
+// ChannelHistory is ChatHistory for one channel: "all", "players", "spectators" or "whisper"
+// (the caller's own whispers). channels other than all need a signed in client who can read them
+func (c *Client) ChannelHistory(lobbyID string, channel string, before int, limit int) (*ChatPage, error) {
+	query := url.Values{}
+	if channel != "" && channel != "all" {
+		query.Set("channel", channel)
+	}
+	if before > 0 {
+		query.Set("before", strconv.Itoa(before))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := lobbyPath(lobbyID, "/chat")
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var out ChatPage
+	return &out, c.do(http.MethodGet, path, nil, &out)
+}
+
+// ImportedGame is a game in notation, replayed and checked by the server
+type ImportedGame struct {
+	Tags     map[string]string `json:"tags"`
+	Moves    []string          `json:"moves"` // squares, a1 (top left) to c3
+	Board    [9]string         `json:"board"`
+	Finished bool              `json:"finished"`
+	Result   string            `json:"result"` // "1-0", "0-1", "1/2-1/2" or "*"
+	Next     string            `json:"next"`
+	Winner   string            `json:"winner"`
+	Notation string            `json:"notation"`
+}
+
+// ImportGame checks a game written in notation, see internal/game/notation.go
+func (c *Client) ImportGame(notation string) (*ImportedGame, error) {
+	var out ImportedGame
+	return &out, c.do(http.MethodPost, "/api/v1/games/import", map[string]string{"notation": notation}, &out)
+}
+
+// Position is a board and whose turn it is, looked up by code or key
+type Position struct {
+	Code          string    `json:"code"`
+	Key           int       `json:"key"`
+	Board         [9]string `json:"board"`
+	ToMove        string    `json:"toMove"`
+	Over          bool      `json:"over"`
+	CanonicalCode string    `json:"canonicalCode"` // the same for every rotation and mirror image
+	CanonicalKey  int       `json:"canonicalKey"`
+	Symmetry      int       `json:"symmetry"`
+	PracticeURL   string    `json:"practiceURL,omitempty"`
+}
+
+// GetPosition looks up a position by code (e.g. "x---o----x") or key
+func (c *Client) GetPosition(position string) (*Position, error) {
+	var out Position
+	return &out, c.do(http.MethodGet, "/api/v1/positions/"+url.PathEscape(position), nil, &out)
+}
+
+// Evaluation is a position or move under perfect play
+type Evaluation struct {
+	Outcome string `json:"outcome"` // "win", "draw" or "loss"
+	Moves   int    `json:"moves"`   // until the game ends, both sides counted
+}
+
+// MoveAnalysis is one legal move and what it leads to for the player making it
+type MoveAnalysis struct {
+	Position int    `json:"position"`
+	Square   string `json:"square"`
+	Evaluation
+	Best bool `json:"best"`
+}
+
+// Analysis is a solved position
+type Analysis struct {
+	Position Position       `json:"position"`
+	Variant  string         `json:"variant"`
+	Result   Evaluation     `json:"result"` // for the side to move
+	Moves    []MoveAnalysis `json:"moves"`
+}
+
+// Analyze solves a position, variant is "classic" (or empty) or "misere"
+func (c *Client) Analyze(position string, variant string) (*Analysis, error) {
+	query := url.Values{"position": {position}}
+	if variant != "" {
+		query.Set("variant", variant)
+	}
+	var out Analysis
+	return &out, c.do(http.MethodGet, "/analyze?"+query.Encode(), nil, &out)
+}
+
+// ReviewedMove is a move of a finished game next to the best one available
+type ReviewedMove struct {
+	Number    int        `json:"number"`
+	Symbol    string     `json:"symbol"`
+	Player    string     `json:"player"`
+	Square    string     `json:"square"`
+	Played    Evaluation `json:"played"`
+	Best      Evaluation `json:"best"`
+	BestMoves []string   `json:"bestMoves"`
+	Mark      string     `json:"mark,omitempty"` // "inaccuracy", "mistake" or "blunder"
+}
+
+// GameReview is every move of a finished game graded by the solver
+type GameReview struct {
+	Number int            `json:"number"`
+	Moves  []ReviewedMove `json:"moves"`
+}
+
+// ReviewGame grades the moves of a lobby's finished game, numbered from 1
+func (c *Client) ReviewGame(lobbyID string, number int) (*GameReview, error) {
+	var out GameReview
+	return &out, c.do(http.MethodGet, lobbyPath(lobbyID, "/games/"+strconv.Itoa(number)+"/review"), nil, &out)
+}
+
+// Puzzle is a "win in N" position from the server's library
+type Puzzle struct {
+	ID       int      `json:"id"`
+	Position Position `json:"position"`
+	WinIn    int      `json:"winIn"` // moves of the side to move
+	Rating   int      `json:"rating"`
+	Attempts int      `json:"attempts"`
+	Solved   int      `json:"solved"`
+	PlayURL  string   `json:"playURL"`
+}
+
+// GetPuzzle looks up a puzzle by ID, or "daily" for the puzzle of the day, or "next" for
+// one near the player's puzzle rating they haven't tried
+func (c *Client) GetPuzzle(id string) (*Puzzle, error) {
+	var out Puzzle
+	return &out, c.do(http.MethodGet, "/api/v1/puzzles/"+url.PathEscape(id), nil, &out)
+}
+
+// PlayPuzzle opens a lobby for the puzzle (an ID, "daily" or "next") where the solver
+// defends. join it and ready up to start
+func (c *Client) PlayPuzzle(id string) (*Lobby, error) {
+	var out Lobby
+	return &out, c.do(http.MethodPost, "/api/v1/puzzles/"+url.PathEscape(id)+"/play", nil, &out)
+}
+
+// BotRegistration is returned by RegisterBot, keep the token, it is only shown once
+type BotRegistration struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// Bot is an entry of ListBots
+type Bot struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+}
+
+// RegisterBot registers a bot and returns its token for the /bot websocket
+func (c *Client) RegisterBot(name string) (*BotRegistration, error) {
+	var out BotRegistration
+	return &out, c.do(http.MethodPost, "/api/v1/bots", map[string]string{"name": name}, &out)
+}
+
+// ListBots lists the bots known to the server
+func (c *Client) ListBots() ([]Bot, error) {
+	var out []Bot
+	return out, c.do(http.MethodGet, "/api/v1/bots", nil, &out)
+}
+
+// AddBot seats a connected bot in a lobby, the signed in account must be the host
+func (c *Client) AddBot(lobbyID string, botID string) (*Player, error) {
+	var out Player
+	body := map[string]string{"botId": botID}
+	return &out, c.do(http.MethodPost, lobbyPath(lobbyID, "/bots"), body, &out)
+}
+
+// Profile is what other players see next to the board and in chat
+type Profile struct {
+	PlayerID    string       `json:"playerId"`
+	DisplayName string       `json:"displayName"`
+	Avatar      string       `json:"avatar"`    // URL path, empty without an avatar
+	Thumbnail   string       `json:"thumbnail"` // small version of Avatar
+	Colors      SymbolColors `json:"colors"`
+	Stats       PlayerStats  `json:"stats"`
+	Puzzles     PuzzleStats  `json:"puzzles"`
+}
+
+// SymbolColors are "#rrggbb", empty for the default
+type SymbolColors struct {
+	X string `json:"x,omitempty"`
+	O string `json:"o,omitempty"`
+}
+
+// PlayerStats sums up a player's finished games
+type PlayerStats struct {
+	Played int `json:"played"`
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+}
+
+// PuzzleStats is a player's puzzle record, rating is 0 until their first attempt
+type PuzzleStats struct {
+	Rating int `json:"rating"`
+	Solved int `json:"solved"`
+	Failed int `json:"failed"`
+}
+
+// ProfileUpdate changes the signed in player's profile, nil fields are left alone
+type ProfileUpdate struct {
+	DisplayName *string       `json:"displayName,omitempty"`
+	Colors      *SymbolColors `json:"colors,omitempty"`
+}
+
+// MyProfile returns the signed in player's profile
+func (c *Client) MyProfile() (*Profile, error) {
+	var out Profile
+	return &out, c.do(http.MethodGet, "/api/v1/profile", nil, &out)
+}
+
+// GetProfile returns any player's profile
+func (c *Client) GetProfile(playerID string) (*Profile, error) {
+	var out Profile
+	return &out, c.do(http.MethodGet, "/api/v1/profiles/"+url.PathEscape(playerID), nil, &out)
+}
+
+// UpdateProfile changes the display name (unique across players) and symbol colors
+func (c *Client) UpdateProfile(update ProfileUpdate) (*Profile, error) {
+	var out Profile
+	return &out, c.do(http.MethodPatch, "/api/v1/profile", update, &out)
+}
+
+// UploadAvatar sets the avatar from PNG, JPEG or GIF data
+func (c *Client) UploadAvatar(image []byte) (*Profile, error) {
+	var out Profile
+	return &out, c.do(http.MethodPut, "/api/v1/profile/avatar", rawBody(image), &out)
+}
+
+// DeleteAvatar removes the avatar
+func (c *Client) DeleteAvatar() error {
+	return c.do(http.MethodDelete, "/api/v1/profile/avatar", nil, nil)
+}
+
+func lobbyPath(lobbyID string, suffix string) string {
+	return "/api/v1/lobbies/" + url.PathEscape(lobbyID) + suffix
+}
+
+// rawBody is sent as is instead of as JSON, the server sniffs its type
+type rawBody []byte
+
+// do sends a request and decodes a JSON response into out (when not nil)
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	var accessToken string
+	if path != tokenPath {
+		var err error
+		if accessToken, err = c.FreshAccessToken(); err != nil {
+			return err
+		}
+	}
+
+	var reader io.Reader
+	contentType := "application/json"
+	if raw, ok := body.(rawBody); ok {
+		reader = bytes.NewReader(raw)
+		contentType = "application/octet-stream"
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u, err := url.Parse(c.BaseURL + path)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	if c.Invite != "" {
+		query.Set("invite", c.Invite)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	if c.Passcode != "" {
+		req.Header.Set("X-Lobby-Passcode", c.Passcode)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// decodeError turns an error response into an *Error, the older endpoints answer in plain text
+func decodeError(resp *http.Response) error {
+	data, _ := io.ReadAll(resp.Body)
+	apiErr := &Error{StatusCode: resp.StatusCode}
+
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error.Code != "" {
+		apiErr.Code = body.Error.Code
+		apiErr.Message = body.Error.Message
+		return apiErr
+	}
+
+	apiErr.Code = http.StatusText(resp.StatusCode)
+	apiErr.Message = strings.TrimSpace(string(data))
+	return apiErr
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+	"tictacgo/internal/lobby"
+)
+
+// EvaluationView is a position or move under perfect play
+type EvaluationView struct {
+	Outcome string `json:"outcome"` // "win", "draw" or "loss"
+	Moves   int    `json:"moves"`   // until the game ends, both sides counted
+}
+
+// MoveAnalysis is one legal move and what it leads to for the player making it
+type MoveAnalysis struct {
+	Position int    `json:"position"`
+	Square   string `json:"square"`
+	EvaluationView
+	Best bool `json:"best"`
+}
+
+// Analysis answers /analyze
+type Analysis struct {
+	Position PositionView   `json:"position"`
+	Variant  string         `json:"variant"`
+	Result   EvaluationView `json:"result"` // for the side to move
+	Moves    []MoveAnalysis `json:"moves"`  // every legal move in board order, empty when the game is over
+}
+
+// ReviewedMoveView is a move of a finished game next to the best one available
+type ReviewedMoveView struct {
+	Number    int            `json:"number"`
+	Symbol    string         `json:"symbol"`
+	Player    string         `json:"player"`
+	Square    string         `json:"square"`
+	Played    EvaluationView `json:"played"`
+	Best      EvaluationView `json:"best"`
+	BestMoves []string       `json:"bestMoves"`
+	Mark      string         `json:"mark,omitempty"` // "inaccuracy", "mistake" or "blunder"
+}
+
+func newEvaluationView(e bot.Evaluation) EvaluationView {
+	return EvaluationView{Outcome: e.Outcome, Moves: e.Moves}
+}
+
+// APIAnalyze handles GET /analyze?position=<code or key>&variant=classic|misere, solving
+// every legal move of the position
+func APIAnalyze(w http.ResponseWriter, r *http.Request) {
+	position, err := game.ParsePosition(r.URL.Query().Get("position"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_position", err.Error())
+		return
+	}
+	variant := r.URL.Query().Get("variant")
+	if variant == "" {
+		variant = game.VariantClassic
+	}
+	if variant != game.VariantClassic && variant != game.VariantMisere {
+		writeError(w, http.StatusBadRequest, "invalid_variant", "variant must be classic or misere")
+		return
+	}
+
+	analysis := Analysis{
+		Position: newPositionView(position),
+		Variant:  variant,
+		Result:   newEvaluationView(bot.Solve(position, variant)),
+		Moves:    []MoveAnalysis{},
+	}
+	for _, m := range bot.Analyze(position, variant) {
+		analysis.Moves = append(analysis.Moves, MoveAnalysis{m.Position, game.Square(m.Position), newEvaluationView(m.Evaluation), m.Best})
+	}
+	writeJSON(w, http.StatusOK, analysis)
+}
+
+// APIGameReview handles GET /api/v1/lobbies/{id}/games/{number}/review, grading every
+// move of a finished game against the solver
+func APIGameReview(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	record := lobby.FindGame(currentLobby, number)
+	if record == nil {
+		writeError(w, http.StatusNotFound, "not_found", "no finished game with that number in this lobby")
+		return
+	}
+
+	moves := []ReviewedMoveView{}
+	for _, m := range lobby.Review(*record) {
+		view := ReviewedMoveView{
+			Number:    m.Number,
+			Symbol:    m.Symbol,
+			Player:    m.Player,
+			Square:    game.Square(m.Position),
+			Played:    newEvaluationView(m.Played),
+			Best:      newEvaluationView(m.Best),
+			BestMoves: []string{},
+			Mark:      m.Mark,
+		}
+		for _, position := range m.BestMoves {
+			view.BestMoves = append(view.BestMoves, game.Square(position))
+		}
+		moves = append(moves, view)
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Number int                `json:"number"`
+		Moves  []ReviewedMoveView `json:"moves"`
+	}{record.Number, moves})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"tictacgo/internal/auth"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+	"time"
+)
+
+// Accounts, mounted under /api/v1/auth. every endpoint that signs someone in
+// answers with a session cookie, the browser and api/client send it back automatically.
+// clients that can't keep cookies use /api/v1/auth/token for a JWT bearer token instead
+
+// AccountView is an account as returned by the API, never includes the password hash
+type AccountView struct {
+	ID       string `json:"id"`
+	Username string `json:"username,omitempty"`
+	Name     string `json:"name"`
+	Guest    bool   `json:"guest"`
+}
+
+// CredentialsRequest is the body of register, login and upgrade
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// TokenRequest is the body of POST /api/v1/auth/token. GrantType is one of
+// "password" (Username and Password), "guest" (optional Name), "refresh_token"
+// (RefreshToken) or "session" (the caller's cookie or token)
+type TokenRequest struct {
+	GrantType    string `json:"grantType"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	Name         string `json:"name"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenResponse carries a new access and refresh token
+type TokenResponse struct {
+	AccessToken  string      `json:"accessToken"`
+	TokenType    string      `json:"tokenType"`
+	ExpiresIn    int         `json:"expiresIn"` // seconds
+	RefreshToken string      `json:"refreshToken"`
+	Account      AccountView `json:"account"`
+}
+
+func newAccountView(account *models.Account) AccountView {
+	return AccountView{
+		ID:       account.ID,
+		Username: account.Username,
+		Name:     account.Name,
+		Guest:    account.Guest,
+	}
+}
+
+// apiAccount is the signed in caller, writes a 401 and returns nil when there is none
+func apiAccount(w http.ResponseWriter, r *http.Request) *models.Account {
+	account := auth.CurrentAccount(r)
+	if account == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "sign in or start a guest session first")
+	}
+	return account
+}
+
+// writeAuthError maps auth errors onto API errors
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidName), errors.Is(err, auth.ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, "invalid_credentials", err.Error())
+	case errors.Is(err, auth.ErrUsernameTaken), errors.Is(err, auth.ErrNotGuest), errors.Is(err, auth.ErrNameTaken),
+		errors.Is(err, auth.ErrReservedName):
+		writeError(w, http.StatusConflict, "conflict", err.Error())
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+	default:
+		log.Printf("Auth error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "something went wrong")
+	}
+}
+
+func decodeCredentials(w http.ResponseWriter, r *http.Request) (CredentialsRequest, bool) {
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"username\": \"...\", \"password\": \"...\"}")
+		return req, false
+	}
+	return req, true
+}
+
+// APIRegister handles POST /api/v1/auth/register and signs the new account in
+func APIRegister(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := auth.Register(req.Username, req.Password)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	auth.StartSession(w, r, account)
+	writeJSON(w, http.StatusCreated, newAccountView(account))
+}
+
+// APILogin handles POST /api/v1/auth/login
+func APILogin(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := auth.Authenticate(req.Username, req.Password)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	auth.StartSession(w, r, account)
+	writeJSON(w, http.StatusOK, newAccountView(account))
+}
+
+// APIGuest handles POST /api/v1/auth/guest with an optional {"name": "..."}
+func APIGuest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"name\": \"...\"}")
+			return
+		}
+	}
+
+	account, err := auth.NewGuest(req.Name)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	auth.StartSession(w, r, account)
+	writeJSON(w, http.StatusCreated, newAccountView(account))
+}
+
+// APIUpgrade handles POST /api/v1/auth/upgrade, giving the caller's guest account a username and password
+func APIUpgrade(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+	req, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	if err := auth.Upgrade(account, req.Username, req.Password); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	// the new name shows up in any lobby the guest is already in
+	renamePlayer(account)
+	writeJSON(w, http.StatusOK, newAccountView(account))
+}
+
+// APILogout handles POST /api/v1/auth/logout, ending the session and revoking the bearer token if one was sent
+func APILogout(w http.ResponseWriter, r *http.Request) {
+	if claims := auth.TokenClaims(r); claims != nil {
+		auth.RevokeAccessToken(claims)
+	}
+	auth.EndSession(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIToken handles POST /api/v1/auth/token, issuing an access token and a refresh token
+func APIToken(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be a JSON object with a grantType")
+		return
+	}
+	if req.GrantType == "" && req.Username != "" {
+		req.GrantType = "password"
+	}
+
+	var account *models.Account
+	var tokens auth.TokenPair
+	var err error
+	status := http.StatusOK
+
+	switch req.GrantType {
+	case "password":
+		account, err = auth.Authenticate(req.Username, req.Password)
+	case "guest":
+		account, err = auth.NewGuest(req.Name)
+		status = http.StatusCreated
+	case "refresh_token":
+		account, tokens, err = auth.Refresh(req.RefreshToken)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "invalid_grant", err.Error())
+			return
+		}
+	case "session":
+		if account = apiAccount(w, r); account == nil {
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "grantType must be password, guest, refresh_token or session")
+		return
+	}
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	if tokens.AccessToken == "" {
+		tokens = auth.IssueTokens(account)
+	}
+	writeJSON(w, status, TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(tokens.Expires).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Account:      newAccountView(account),
+	})
+}
+
+// APIRevokeToken handles POST /api/v1/auth/token/revoke. revokes the given refresh token
+// and the access token the request was made with, or with {"all": true} every token the account has
+func APIRevokeToken(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+		All          bool   `json:"all"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"refreshToken\": \"...\"} or {\"all\": true}")
+			return
+		}
+	}
+
+	if req.All {
+		auth.RevokeAllTokens(account)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if req.RefreshToken != "" && !auth.RevokeRefreshToken(account, req.RefreshToken) {
+		writeError(w, http.StatusNotFound, "not_found", "refresh token not found")
+		return
+	}
+	if claims := auth.TokenClaims(r); claims != nil {
+		auth.RevokeAccessToken(claims)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIMe handles GET /api/v1/auth/me
+func APIMe(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, newAccountView(account))
+}
+
+// renamePlayer updates the account's player in every lobby after their name changed
+func renamePlayer(account *models.Account) {
+	for _, currentLobby := range lobby.All() {
+		unlock := lobby.Lock(currentLobby.ID)
+		for _, group := range [][]*models.Player{currentLobby.Players, currentLobby.Spectators} {
+			for _, p := range group {
+				if p.ID != account.ID || p.Name == account.Name {
+					continue
+				}
+				// ready state is keyed by name
+				if ready, ok := currentLobby.ReadyPlayers[p.Name]; ok {
+					delete(currentLobby.ReadyPlayers, p.Name)
+					currentLobby.ReadyPlayers[account.Name] = ready
+				}
+				p.Name = account.Name
+				notifyAssignments(currentLobby, []*models.Player{p})
+				storeLobbyState(currentLobby.ID, currentLobby)
+			}
+		}
+		unlock()
+	}
+}
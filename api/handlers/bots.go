@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+// Bot API, see docs/BOTS.md. a bot registers once for a token, keeps a websocket open
+// on /bot?token=... and is told when it is seated and when it is its turn to move
+
+// how long a bot gets to answer yourTurn, shortened when its clock has less left
+const botMoveTimeout = 5 * time.Second
+
+// open bot connections keyed by bot ID
+var BotConnections = make(map[string]*websocket.Conn)
+
+// a bot turn waiting for an answer, keyed by lobby ID
+type botTurn struct {
+	botID string
+	timer *time.Timer
+}
+
+var pendingBotTurns = make(map[string]*botTurn)
+
+// guards models.Bots, BotConnections and pendingBotTurns. taken after a lobby's lock, never before it
+var botsMu sync.Mutex
+
+// botConnection returns the bot's open connection, nil when it has none
+func botConnection(botID string) *websocket.Conn {
+	botsMu.Lock()
+	defer botsMu.Unlock()
+	return BotConnections[botID]
+}
+
+// findBot returns a registered bot by ID
+func findBot(botID string) (*models.Bot, bool) {
+	botsMu.Lock()
+	defer botsMu.Unlock()
+	b, ok := models.Bots[botID]
+	return b, ok
+}
+
+// BotRegistration is returned once by POST /api/v1/bots, the token is not stored in the clear
+type BotRegistration struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// BotView is a bot as listed by GET /api/v1/bots
+type BotView struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+}
+
+func hashBotToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// findBotByToken looks the token up in memory, then in Redis
+func findBotByToken(token string) *models.Bot {
+	hash := hashBotToken(token)
+	botsMu.Lock()
+	for _, b := range models.Bots {
+		if b.TokenHash == hash {
+			botsMu.Unlock()
+			return b
+		}
+	}
+	botsMu.Unlock()
+
+	botID, err := redisClient.Get("bot-token:" + hash).Result()
+	if err != nil {
+		return nil
+	}
+	data, err := redisClient.Get("bot:" + botID).Result()
+	if err != nil {
+		return nil
+	}
+	var b models.Bot
+	if err := json.Unmarshal([]byte(data), &b); err != nil {
+		log.Printf("Error decoding bot %s: %v", botID, err)
+		return nil
+	}
+
+	// another connection may have loaded it meanwhile, keep the first copy
+	botsMu.Lock()
+	defer botsMu.Unlock()
+	if loaded, ok := models.Bots[b.ID]; ok {
+		return loaded
+	}
+	models.Bots[b.ID] = &b
+	return &b
+}
+
+// APIRegisterBot handles POST /api/v1/bots with {"name": "..."}
+func APIRegisterBot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || len(req.Name) > 15 {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"name\": \"...\"} with up to 15 characters")
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", "failed to generate token")
+		return
+	}
+	token := hex.EncodeToString(secret)
+
+	b := &models.Bot{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		TokenHash: hashBotToken(token),
+		Created:   time.Now(),
+	}
+	botsMu.Lock()
+	models.Bots[b.ID] = b
+	botsMu.Unlock()
+
+	// bots outlive restarts so their tokens keep working
+	if data, err := json.Marshal(b); err == nil {
+		if err := redisClient.Set("bot:"+b.ID, data, 0).Err(); err != nil {
+			log.Printf("Error storing bot in Redis: %v", err)
+		}
+		redisClient.Set("bot-token:"+b.TokenHash, b.ID, 0)
+	}
+
+	writeJSON(w, http.StatusCreated, BotRegistration{ID: b.ID, Name: b.Name, Token: token})
+}
+
+// APIListBots handles GET /api/v1/bots, listing bots known to this server
+func APIListBots(w http.ResponseWriter, r *http.Request) {
+	bots := []BotView{}
+	botsMu.Lock()
+	for _, b := range models.Bots {
+		connected := BotConnections[b.ID] != nil
+		bots = append(bots, BotView{ID: b.ID, Name: b.Name, Connected: connected})
+	}
+	botsMu.Unlock()
+	writeJSON(w, http.StatusOK, bots)
+}
+
+// APIAddBot handles POST /api/v1/lobbies/{id}/bots with {"botId": "..."}, host only
+func APIAddBot(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	var req struct {
+		BotID string `json:"botId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"botId\": \"...\"}")
+		return
+	}
+
+	player, err := addBot(currentLobby, account.ID, req.BotID)
+	if err != nil {
+		writeError(w, http.StatusConflict, "cannot_add_bot", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, newPlayerView(currentLobby, player))
+}
+
+// addBot seats a connected bot in the lobby, shared by the REST API and the host's addBot message
+func addBot(currentLobby *models.Lobby, hostID string, botID string) (*models.Player, error) {
+	if !lobby.IsHost(currentLobby, hostID) {
+		return nil, errors.New("only the host can add bots")
+	}
+	b, ok := findBot(botID)
+	if !ok {
+		return nil, errors.New("bot not found")
+	}
+	if botConnection(botID) == nil {
+		return nil, fmt.Errorf("%s is not connected", b.Name)
+	}
+
+	player, err := lobby.SeatBot(currentLobby, b.ID, b.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	sendToBot(b.ID, map[string]interface{}{
+		"type":      "seated",
+		"lobbyId":   currentLobby.ID,
+		"lobbyName": currentLobby.Name,
+		"symbol":    player.Symbol,
+		"settings":  currentLobby.Settings,
+	})
+	announce(currentLobby, fmt.Sprintf("%v (bot) has joined the game as %v!", player.Name, player.Symbol))
+
+	// bots are always ready, this starts the game if the other seat is waiting
+	setReady(currentLobby, player.ID, true)
+	storeLobbyState(currentLobby.ID, currentLobby)
+	return player, nil
+}
+
+// sendToBot writes to a bot's connection if it has one
+func sendToBot(botID string, msg map[string]interface{}) {
+	if conn := botConnection(botID); conn != nil {
+		sendJSON(conn, msg)
+	}
+}
+
+// notifyBotTurn asks the bot to move when it is a bot's turn, with a fallback when it doesn't answer in time
+func notifyBotTurn(currentLobby *models.Lobby) {
+	if !currentLobby.GameStarted {
+		return
+	}
+
+	var player *models.Player
+	for _, p := range currentLobby.Players {
+		if p.Symbol == currentLobby.Game.CurrentTurn {
+			player = p
+		}
+	}
+	if player == nil || !player.IsBot {
+		return
+	}
+
+	// the puzzle solver plays right here
+	if player.ID == lobby.SolverID {
+		position := bot.Solver{}.Move(currentLobby.Game, player.Symbol)
+		if _, err := applyMove(currentLobby, player.ID, position); err != nil {
+			log.Printf("Error playing the solver's move in %s: %v", currentLobby.ID, err)
+		}
+		return
+	}
+
+	deadline := botMoveTimeout
+	remaining := currentLobby.Game.TimeRemaining(player.Symbol)
+	if currentLobby.Game.TimeControl > 0 && remaining < deadline {
+		deadline = remaining
+	}
+
+	sendToBot(player.ID, map[string]interface{}{
+		"type":            "yourTurn",
+		"lobbyId":         currentLobby.ID,
+		"board":           currentLobby.Game.Board,
+		"symbol":          player.Symbol,
+		"variant":         currentLobby.Game.Variant,
+		"timeRemainingMs": remaining.Milliseconds(),
+		"deadlineMs":      deadline.Milliseconds(),
+	})
+
+	cancelBotTurn(currentLobby.ID)
+	turn := &botTurn{botID: player.ID}
+	botsMu.Lock()
+	turn.timer = time.AfterFunc(deadline, func() { botTurnExpired(currentLobby, turn) })
+	pendingBotTurns[currentLobby.ID] = turn
+	botsMu.Unlock()
+}
+
+// cancelBotTurn stops waiting on a bot, called when any move lands
+func cancelBotTurn(lobbyID string) {
+	botsMu.Lock()
+	defer botsMu.Unlock()
+	if turn, ok := pendingBotTurns[lobbyID]; ok {
+		turn.timer.Stop()
+		delete(pendingBotTurns, lobbyID)
+	}
+}
+
+// botTurnExpired plays a random move for a bot that missed its deadline. it runs on the
+// timer's goroutine, so it takes the lobby's lock like any other move
+func botTurnExpired(currentLobby *models.Lobby, turn *botTurn) {
+	unlock := lobby.Lock(currentLobby.ID)
+	defer unlock()
+
+	botsMu.Lock()
+	expired := pendingBotTurns[currentLobby.ID] == turn
+	if expired {
+		delete(pendingBotTurns, currentLobby.ID)
+	}
+	botsMu.Unlock()
+	if !expired {
+		return // the bot answered in the meantime, or the lobby closed
+	}
+
+	sendToBot(turn.botID, map[string]interface{}{
+		"type":    "timeout",
+		"lobbyId": currentLobby.ID,
+		"text":    "You missed the deadline, a random move was played for you.",
+	})
+
+	position := bot.Random{}.Move(currentLobby.Game, currentLobby.Game.CurrentTurn)
+	if _, err := applyMove(currentLobby, turn.botID, position); err != nil {
+		log.Printf("Error playing fallback move for bot %s: %v", turn.botID, err)
+	}
+}
+
+// notifyBotsGameOver tells seated bots how the game ended
+func notifyBotsGameOver(currentLobby *models.Lobby, result game.GameMessage) {
+	for _, p := range currentLobby.Players {
+		if p.IsBot {
+			sendToBot(p.ID, map[string]interface{}{
+				"type":    "gameOver",
+				"lobbyId": currentLobby.ID,
+				"result":  result.Next,
+				"winner":  result.Winner,
+				"text":    result.Text,
+			})
+		}
+	}
+}
+
+// removeBot tells a bot it is out of a lobby, msgType is "kicked", "banned" or
+// "lobbyClosed". its one connection serves every lobby it is in, so the connection is only
+// dropped once it isn't seated in any of them
+func removeBot(lobbyID string, botID string, msgType string, text string) {
+	if botID == lobby.SolverID {
+		return
+	}
+	botsMu.Lock()
+	if turn, ok := pendingBotTurns[lobbyID]; ok && turn.botID == botID {
+		turn.timer.Stop()
+		delete(pendingBotTurns, lobbyID)
+	}
+	botsMu.Unlock()
+
+	sendToBot(botID, map[string]interface{}{
+		"type":    msgType,
+		"lobbyId": lobbyID,
+		"text":    text,
+	})
+	// the caller holds the lobby's lock, and the other lobbies' locks can't be taken under it
+	go dropIdleBot(botID)
+}
+
+// dropIdleBot closes a bot's connection when no lobby in memory has it seated
+func dropIdleBot(botID string) {
+	for _, currentLobby := range lobby.All() {
+		unlock := lobby.Lock(currentLobby.ID)
+		seated := lobby.IsSeated(currentLobby, botID)
+		unlock()
+		if seated {
+			return
+		}
+	}
+
+	botsMu.Lock()
+	conn := BotConnections[botID]
+	delete(BotConnections, botID)
+	botsMu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// HandleBotSocket serves /bot?token=..., the single connection a bot plays all its lobbies over
+func HandleBotSocket(ws *websocket.Conn) {
+	b := findBotByToken(ws.Request().URL.Query().Get("token"))
+	if b == nil {
+		sendJSON(ws, map[string]interface{}{"type": "error", "text": "invalid bot token"})
+		ws.Close()
+		return
+	}
+
+	// a newer connection replaces the old one
+	botsMu.Lock()
+	if old, ok := BotConnections[b.ID]; ok {
+		old.Close()
+	}
+	BotConnections[b.ID] = ws
+	botsMu.Unlock()
+	defer func() {
+		botsMu.Lock()
+		if BotConnections[b.ID] == ws {
+			delete(BotConnections, b.ID)
+		}
+		botsMu.Unlock()
+		ws.Close()
+	}()
+
+	sendJSON(ws, map[string]interface{}{"type": "hello", "id": b.ID, "name": b.Name})
+
+	for {
+		var msg struct {
+			Type     string `json:"type"`
+			LobbyID  string `json:"lobbyId"`
+			Position int    `json:"position"`
+		}
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			fmt.Printf("Bot %s disconnected: %v\n", b.Name, err)
+			return
+		}
+		if msg.Type != "move" {
+			continue
+		}
+
+		currentLobby, ok := lobby.Lookup(msg.LobbyID)
+		if !ok {
+			sendJSON(ws, map[string]interface{}{"type": "error", "lobbyId": msg.LobbyID, "text": "lobby not found"})
+			continue
+		}
+		unlock := lobby.Lock(currentLobby.ID)
+		_, err := applyMove(currentLobby, b.ID, msg.Position)
+		unlock()
+		if err != nil {
+			sendJSON(ws, map[string]interface{}{"type": "error", "lobbyId": msg.LobbyID, "text": err.Error()})
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"tictacgo/internal/chat"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+
+	"golang.org/x/net/websocket"
+)
+
+// postChat moderates a player's message and posts it on a channel, to is the player ID
+// a whisper goes to. a *chat.Rejection says why the message wasn't posted
+func postChat(currentLobby *models.Lobby, player *models.Player, text string, channel string, to string, emote bool) error {
+	recipient, err := chat.CheckPost(currentLobby, player.ID, channel, to)
+	if err != nil {
+		return err
+	}
+	text, err = chat.Moderate(currentLobby, player.ID, text)
+	if err != nil {
+		return err
+	}
+
+	msg := map[string]interface{}{
+		"sender":   player.Name,
+		"senderId": player.ID,
+		"text":     text,
+		"channel":  channel,
+		"emote":    emote,
+	}
+	readable := models.ChatMessage{Channel: channel, SenderID: player.ID}
+	if recipient != nil {
+		msg["to"] = recipient.ID
+		msg["toName"] = recipient.Name
+		readable.To = recipient.ID
+	}
+	return chat.HandleChatMessage(currentLobby.ID, msg, chatReaders(currentLobby, readable))
+}
+
+// chatReaders picks the lobby connections allowed to read msg, in the shape HandleChatMessage takes
+func chatReaders(currentLobby *models.Lobby, msg models.ChatMessage) map[string][]*websocket.Conn {
+	var conns []*websocket.Conn
+	for _, conn := range lobbyConnections(currentLobby.ID) {
+		if chat.CanRead(currentLobby, connectionPlayer(conn), msg) {
+			conns = append(conns, conn)
+		}
+	}
+	return map[string][]*websocket.Conn{currentLobby.ID: conns}
+}
+
+// handleChatChange runs chatEdit, chatDelete and chatReact for the player on ws and sends
+// the changed message to everyone who can read it. failures go back to the sender only
+func handleChatChange(currentLobby *models.Lobby, ws *websocket.Conn, msgType string, msg map[string]interface{}) {
+	playerID := connectionPlayer(ws)
+	if lobby.FindPlayer(currentLobby, playerID) == nil {
+		return
+	}
+	if !currentLobby.Settings.ChatEnabled {
+		sendJSON(ws, map[string]interface{}{
+			"type": "error",
+			"text": "Chat is disabled in this lobby.",
+		})
+		return
+	}
+
+	id, _ := msg["id"].(float64)
+	var changed *models.ChatMessage
+	var err error
+	switch msgType {
+	case "chatEdit":
+		text, _ := msg["text"].(string)
+		changed, err = chat.EditMessage(currentLobby, playerID, int(id), text)
+	case "chatDelete":
+		changed, err = chat.DeleteMessage(currentLobby, playerID, int(id), lobby.CanModerate(currentLobby, playerID))
+	case "chatReact":
+		emoji, _ := msg["emoji"].(string)
+		changed, err = chat.React(currentLobby, playerID, int(id), emoji)
+	}
+
+	// an edit is moderated like a new message, reactions are rate limited like one
+	var rejection *chat.Rejection
+	if errors.As(err, &rejection) {
+		sendJSON(ws, map[string]interface{}{
+			"type":   "chatRejected",
+			"reason": rejection.Reason,
+			"text":   rejection.Text,
+		})
+		return
+	}
+	if err != nil {
+		sendJSON(ws, map[string]interface{}{
+			"type": "error",
+			"text": err.Error(),
+		})
+		return
+	}
+
+	update := map[string]interface{}{
+		"type":    "chatUpdate",
+		"message": changed,
+	}
+	for _, conn := range chatReaders(currentLobby, *changed)[currentLobby.ID] {
+		sendJSON(conn, update)
+	}
+}
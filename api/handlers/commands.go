@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tictacgo/internal/chat"
+	"tictacgo/internal/game"
+	"tictacgo/internal/lobby"
+	"tictacgo/internal/profile"
+	"tictacgo/models"
+
+	"golang.org/x/net/websocket"
+)
+
+// Slash commands typed into the lobby chat. the registry and permission checks live in
+// internal/chat, the commands are here because most of them act on the game and connections
+
+var errGameInProgress = errors.New("finish the game in progress first")
+
+func init() {
+	chat.RegisterCommand(&chat.Command{
+		Name: "help",
+		Help: "list the commands you can use",
+		Run:  helpCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name: "who",
+		Help: "list who is seated and watching",
+		Run:  whoCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name: "stats",
+		Args: "[name]",
+		Help: "show a player's record, yours by default",
+		Run:  statsCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name: "me",
+		Args: "<action>",
+		Help: "say what you are doing, e.g. /me thinks hard",
+		Run:  meCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name: "w",
+		Args: "<name> <message>",
+		Help: "whisper to one player, only they see it",
+		Run:  whisperCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "p",
+		Args:       "<message>",
+		Help:       "talk on the players channel, spectators don't see it",
+		Permission: chat.SeatedPlayer,
+		Run:        channelCommand(chat.ChannelPlayers),
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "s",
+		Args:       "<message>",
+		Help:       "talk on the spectators channel, players don't see it",
+		Permission: chat.SpectatorOnly,
+		Run:        channelCommand(chat.ChannelSpectators),
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "kick",
+		Args:       "<name>",
+		Help:       "remove a player from the lobby",
+		Permission: chat.HostOnly,
+		Run:        kickCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "resign",
+		Help:       "give up the game in progress",
+		Permission: chat.SeatedPlayer,
+		Run:        resignCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "draw",
+		Help:       "offer a draw, or accept the one your opponent offered",
+		Permission: chat.SeatedPlayer,
+		Run:        drawCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "rematch",
+		Help:       "ready up for another game",
+		Permission: chat.SeatedPlayer,
+		Run:        rematchCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name:       "hint",
+		Help:       "ask for the best move, when the lobby gives hints",
+		Permission: chat.SeatedPlayer,
+		Run:        hintCommand,
+	})
+	chat.RegisterCommand(&chat.Command{
+		Name: "review",
+		Args: "[game]",
+		Help: "point out the mistakes in a finished game, the last one by default",
+		Run:  reviewCommand,
+	})
+}
+
+// runChatCommand runs a command sent by the player on ws, replies go to ws only
+func runChatCommand(currentLobby *models.Lobby, ws *websocket.Conn, player *models.Player, text string) {
+	ctx := &chat.CommandContext{
+		Lobby:    currentLobby,
+		Player:   player,
+		IsHost:   lobby.IsHost(currentLobby, player.ID),
+		IsSeated: lobby.IsSeated(currentLobby, player.ID),
+		Reply: func(text string) {
+			sendJSON(ws, chat.PrivateMessage(text))
+		},
+	}
+	chat.RunCommand(ctx, text)
+}
+
+func helpCommand(ctx *chat.CommandContext) error {
+	ctx.Reply("Commands:")
+	for _, cmd := range chat.Commands() {
+		if cmd.Allowed(ctx) {
+			ctx.Reply(fmt.Sprintf("%s - %s", cmd.Usage(), cmd.Help))
+		}
+	}
+	return nil
+}
+
+func whoCommand(ctx *chat.CommandContext) error {
+	var seated []string
+	for _, p := range ctx.Lobby.Players {
+		seated = append(seated, fmt.Sprintf("%v (%v)", playerLabel(ctx.Lobby, p), p.Symbol))
+	}
+	var watching []string
+	for _, p := range ctx.Lobby.Spectators {
+		watching = append(watching, playerLabel(ctx.Lobby, p))
+	}
+
+	if len(seated) == 0 {
+		seated = []string{"nobody"}
+	}
+	ctx.Reply("Playing: " + strings.Join(seated, ", "))
+	if len(watching) > 0 {
+		ctx.Reply("Watching: " + strings.Join(watching, ", "))
+	}
+	return nil
+}
+
+// the player's name, marked when they host or are a bot
+func playerLabel(currentLobby *models.Lobby, p *models.Player) string {
+	switch {
+	case lobby.IsHost(currentLobby, p.ID):
+		return p.Name + " [host]"
+	case p.IsBot:
+		return p.Name + " [bot]"
+	}
+	return p.Name
+}
+
+func statsCommand(ctx *chat.CommandContext) error {
+	target := ctx.Player
+	if ctx.Args != "" {
+		if target = lobby.FindPlayerByName(ctx.Lobby, ctx.Args); target == nil {
+			return fmt.Errorf("nobody called %v is in this lobby", ctx.Args)
+		}
+	}
+
+	p := profile.Get(target.ID)
+	if target.IsBot || p == nil {
+		return fmt.Errorf("%v doesn't keep stats", target.Name)
+	}
+	ctx.Reply(fmt.Sprintf("%v has played %d: %d won, %d lost, %d drawn.",
+		target.Name, p.Stats.Played, p.Stats.Wins, p.Stats.Losses, p.Stats.Draws))
+	return nil
+}
+
+func meCommand(ctx *chat.CommandContext) error {
+	if !ctx.Lobby.Settings.ChatEnabled {
+		return errors.New("chat is disabled in this lobby")
+	}
+	if ctx.Args == "" {
+		return errors.New("usage: /me <action>")
+	}
+	// a rejection's text says why, and is replied to the issuer like any other error
+	return postChat(ctx.Lobby, ctx.Player, ctx.Args, chat.ChannelAll, "", true)
+}
+
+func whisperCommand(ctx *chat.CommandContext) error {
+	if !ctx.Lobby.Settings.ChatEnabled {
+		return errors.New("chat is disabled in this lobby")
+	}
+	name, text, _ := strings.Cut(ctx.Args, " ")
+	if name == "" || strings.TrimSpace(text) == "" {
+		return errors.New("usage: /w <name> <message>")
+	}
+	target := lobby.FindPlayerByName(ctx.Lobby, name)
+	if target == nil {
+		return fmt.Errorf("nobody called %v is in this lobby", name)
+	}
+	return postChat(ctx.Lobby, ctx.Player, text, chat.ChannelWhisper, target.ID, false)
+}
+
+// channelCommand posts the arguments on a channel, for clients without a channel picker
+func channelCommand(channel string) func(ctx *chat.CommandContext) error {
+	return func(ctx *chat.CommandContext) error {
+		if !ctx.Lobby.Settings.ChatEnabled {
+			return errors.New("chat is disabled in this lobby")
+		}
+		if ctx.Args == "" {
+			return errors.New("type your message after the command")
+		}
+		return postChat(ctx.Lobby, ctx.Player, ctx.Args, channel, "", false)
+	}
+}
+
+func kickCommand(ctx *chat.CommandContext) error {
+	if ctx.Args == "" {
+		return errors.New("usage: /kick <name>")
+	}
+	target := lobby.FindPlayerByName(ctx.Lobby, ctx.Args)
+	if target == nil {
+		return fmt.Errorf("nobody called %v is in this lobby", ctx.Args)
+	}
+	return kickPlayer(ctx.Lobby, ctx.Player.ID, target.ID)
+}
+
+func resignCommand(ctx *chat.CommandContext) error {
+	return resign(ctx.Lobby, ctx.Player.ID)
+}
+
+func drawCommand(ctx *chat.CommandContext) error {
+	agreed, err := offerDraw(ctx.Lobby, ctx.Player.ID)
+	if err == nil && !agreed {
+		announce(ctx.Lobby, fmt.Sprintf("%v offers a draw, type /draw to accept.", ctx.Player.Name))
+	}
+	return err
+}
+
+func rematchCommand(ctx *chat.CommandContext) error {
+	if ctx.Lobby.GameStarted {
+		return errGameInProgress
+	}
+	// both can still be marked ready from the last game when their clients didn't un-ready
+	if ctx.Lobby.ReadyPlayers[ctx.Player.Name] && len(ctx.Lobby.ReadyPlayers) < 2 {
+		return errors.New("you are already ready, waiting on your opponent")
+	}
+	announce(ctx.Lobby, fmt.Sprintf("%v wants a rematch.", ctx.Player.Name))
+	return setReady(ctx.Lobby, ctx.Player.ID, true)
+}
+
+func hintCommand(ctx *chat.CommandContext) error {
+	move, left, err := hint(ctx.Lobby, ctx.Player.ID)
+	if err != nil {
+		return err
+	}
+	ctx.Reply(fmt.Sprintf("Hint: %s %s. %d hints left this game.", game.Square(move.Position), lobby.EvaluationText(move.Evaluation), left))
+	return nil
+}
+
+func reviewCommand(ctx *chat.CommandContext) error {
+	if len(ctx.Lobby.Games) == 0 {
+		return errors.New("no game has finished in this lobby yet")
+	}
+	record := &ctx.Lobby.Games[len(ctx.Lobby.Games)-1]
+	if ctx.Args != "" {
+		number, err := strconv.Atoi(ctx.Args)
+		if err != nil {
+			return errors.New("usage: /review [game number]")
+		}
+		if record = lobby.FindGame(ctx.Lobby, number); record == nil {
+			return fmt.Errorf("there is no finished game %d in this lobby", number)
+		}
+	}
+
+	for _, line := range lobby.ReviewText(*record, lobby.Review(*record)) {
+		ctx.Reply(line)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"tictacgo/internal/auth"
+	"tictacgo/internal/lobby"
+)
+
+// content types of the export formats
+var exportContentTypes = map[string]string{
+	lobby.ExportJSON: "application/json",
+	lobby.ExportText: "text/plain; charset=utf-8",
+	lobby.ExportCSV:  "text/csv; charset=utf-8",
+}
+
+// ExportLobby handles GET /lobby/{id}/export?format=json|txt|csv, downloading the chat
+// transcript and move history. signed in players also get the channels and whispers they can read
+func ExportLobby(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = lobby.ExportJSON
+	}
+	if !lobby.ValidExportFormat(format) {
+		writeError(w, http.StatusBadRequest, "invalid_format", "format must be json, txt or csv")
+		return
+	}
+
+	var playerID string
+	if account := auth.CurrentAccount(r); account != nil {
+		playerID = account.ID
+	}
+	export := lobby.BuildExport(currentLobby, playerID)
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"lobby-%s.%s\"", currentLobby.ID, format))
+	if format == lobby.ExportJSON {
+		writeJSON(w, http.StatusOK, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	var err error
+	if format == lobby.ExportCSV {
+		err = lobby.WriteCSV(w, export)
+	} else {
+		err = lobby.WriteText(w, export)
+	}
+	if err != nil {
+		log.Printf("Error writing export of lobby %s: %v", currentLobby.ID, err)
+	}
+}
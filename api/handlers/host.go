@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"tictacgo/internal/chat"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// handleHostMessage runs host-only actions: kick, ban, swapSeats, promote, addBot, transferHost,
+// mute and unmute. the sender must be bound to the lobby host (or be an admin for mute and unmute),
+// failures are reported back to the sender only
+func handleHostMessage(currentLobby *models.Lobby, ws *websocket.Conn, msgType string, msg map[string]interface{}) {
+	hostID := connectionPlayer(ws)
+	targetID, _ := msg["targetId"].(string)
+
+	var err error
+	switch msgType {
+	case "kick":
+		err = kickPlayer(currentLobby, hostID, targetID)
+	case "ban":
+		forfeitRemoved(currentLobby, hostID, targetID)
+		var target *models.Player
+		if target, err = lobby.Ban(currentLobby, hostID, targetID); err == nil {
+			removePlayerConnections(currentLobby.ID, target.ID, "banned", "You have been banned from this lobby.")
+			if target.IsBot {
+				removeBot(currentLobby.ID, target.ID, "banned", "You have been banned from this lobby.")
+			}
+			announce(currentLobby, fmt.Sprintf("%v was banned by the host.", target.Name))
+			notifySeatOpen(currentLobby)
+		}
+	case "swapSeats":
+		var changed []*models.Player
+		if changed, err = lobby.SwapSeats(currentLobby, hostID); err == nil {
+			notifyAssignments(currentLobby, changed)
+			announce(currentLobby, "The host swapped the X and O seats.")
+		}
+	case "promote":
+		symbol, _ := msg["symbol"].(string)
+		var changed []*models.Player
+		if changed, err = lobby.Promote(currentLobby, hostID, targetID, symbol); err == nil {
+			notifyAssignments(currentLobby, changed)
+			announce(currentLobby, fmt.Sprintf("%v now plays as %v.", changed[0].Name, changed[0].Symbol))
+		}
+	case "addBot":
+		botID, _ := msg["botId"].(string)
+		_, err = addBot(currentLobby, hostID, botID)
+	case "mute":
+		// duration in seconds, the server picks one when it is missing
+		seconds, _ := msg["duration"].(float64)
+		var target *models.Player
+		var duration time.Duration
+		if target, duration, err = lobby.Mute(currentLobby, hostID, targetID, time.Duration(seconds)*time.Second); err == nil {
+			announce(currentLobby, fmt.Sprintf("%v was muted for %v.", target.Name, duration))
+		}
+	case "unmute":
+		var target *models.Player
+		if target, err = lobby.Unmute(currentLobby, hostID, targetID); err == nil {
+			announce(currentLobby, fmt.Sprintf("%v can chat again.", target.Name))
+		}
+	case "transferHost":
+		var target *models.Player
+		if target, err = lobby.TransferHost(currentLobby, hostID, targetID); err == nil {
+			notifyAssignments(currentLobby, []*models.Player{target, lobby.FindPlayer(currentLobby, hostID)})
+			announce(currentLobby, fmt.Sprintf("%v is now the host.", target.Name))
+		}
+	}
+
+	if err != nil {
+		sendJSON(ws, map[string]interface{}{
+			"type": "error",
+			"text": err.Error(),
+		})
+	}
+}
+
+// kickPlayer removes a player from the lobby and closes their connections, for the
+// kick message and /kick
+func kickPlayer(currentLobby *models.Lobby, hostID string, targetID string) error {
+	forfeitRemoved(currentLobby, hostID, targetID)
+	target, err := lobby.Kick(currentLobby, hostID, targetID)
+	if err != nil {
+		return err
+	}
+	removePlayerConnections(currentLobby.ID, target.ID, "kicked", "You have been kicked from the lobby.")
+	if target.IsBot {
+		removeBot(currentLobby.ID, target.ID, "kicked", "You have been kicked from the lobby.")
+	}
+	announce(currentLobby, fmt.Sprintf("%v was kicked by the host.", target.Name))
+	notifySeatOpen(currentLobby)
+	return nil
+}
+
+// forfeitRemoved ends the game in progress as a loss for a player the host is about to
+// kick or ban, through the same path as /resign, so it doesn't go on with an empty seat
+func forfeitRemoved(currentLobby *models.Lobby, hostID string, targetID string) {
+	if !lobby.IsHost(currentLobby, hostID) || targetID == hostID {
+		return
+	}
+	if currentLobby.GameStarted && lobby.IsSeated(currentLobby, targetID) {
+		resign(currentLobby, targetID)
+	}
+}
+
+// announce posts a GAMEMASTER message to the lobby chat
+func announce(currentLobby *models.Lobby, text string) {
+	gameMasterMessage := map[string]interface{}{
+		"type":   "chat",
+		"sender": "GAMEMASTER",
+		"text":   text,
+	}
+	chat.HandleChatMessage(currentLobby.ID, gameMasterMessage, connectionSet(currentLobby.ID))
+}
+
+// playerConnections returns every open connection bound to a player in a lobby
+func playerConnections(lobbyID string, playerID string) []*websocket.Conn {
+	var conns []*websocket.Conn
+	for _, conn := range lobbyConnections(lobbyID) {
+		if connectionPlayer(conn) == playerID {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// sendToPlayer sends a message to every connection a player has open in the lobby
+func sendToPlayer(lobbyID string, playerID string, msg map[string]interface{}) {
+	for _, conn := range playerConnections(lobbyID, playerID) {
+		sendJSON(conn, msg)
+	}
+}
+
+// re-sends assignPlayer to players whose seat or host status changed
+func notifyAssignments(currentLobby *models.Lobby, players []*models.Player) {
+	for _, p := range players {
+		if p == nil {
+			continue
+		}
+		sendToPlayer(currentLobby.ID, p.ID, lobby.AssignPlayerMessage(currentLobby, p))
+	}
+}
+
+// tells a removed player why and closes their connections
+func removePlayerConnections(lobbyID string, playerID string, msgType string, text string) {
+	for _, conn := range playerConnections(lobbyID, playerID) {
+		sendJSON(conn, map[string]interface{}{
+			"type": msgType,
+			"text": text,
+		})
+		removeConnection(lobbyID, conn)
+		unbindConnection(conn)
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// reasons a move is refused before it reaches the board
+var (
+	errNotSeated      = errors.New("only seated players can move")
+	errGameNotStarted = errors.New("the game has not started yet")
+	errNotYourTurn    = errors.New("it's not your turn")
+	errInvalidMove    = errors.New("invalid move: position already filled or out of bounds")
+	errNotSeatedReady = errors.New("only seated players can ready up")
+	errDrawOffered    = errors.New("you already offered a draw, waiting on your opponent")
+	errBotDraw        = errors.New("bots play every game out, they don't take draw offers")
+	errHintsOff       = errors.New("hints are turned off in this lobby")
+	errHintsRated     = errors.New("there are no hints in rated lobbies")
+	errNoHintsLeft    = errors.New("you have used all your hints for this game")
+)
+
+// setReady marks a seated player (un)ready, starting the game once both seats are ready.
+// shared by the websocket and the REST API
+func setReady(currentLobby *models.Lobby, playerID string, ready bool) error {
+	player := lobby.FindPlayer(currentLobby, playerID)
+	if player == nil || !lobby.IsSeated(currentLobby, playerID) {
+		// clients un-ready everyone after a game, nothing to do for spectators
+		if !ready {
+			return nil
+		}
+		return errNotSeatedReady
+	}
+
+	if !ready {
+		delete(currentLobby.ReadyPlayers, player.Name)
+		fmt.Printf("Player %s is no longer ready\n", player.Name)
+		return nil
+	}
+
+	currentLobby.ReadyPlayers[player.Name] = true
+	if len(currentLobby.ReadyPlayers) == 2 && !currentLobby.GameStarted {
+		currentLobby.GameStarted = true // Prevent duplicate start messages
+		currentLobby.Game.Start()       // winds the clocks for timed lobbies
+		currentLobby.DrawOffer = ""
+		currentLobby.HintsUsed = make(map[string]int)
+		start := map[string]interface{}{
+			"type":        "startGame",
+			"currentTurn": currentLobby.Game.CurrentTurn,
+			"board":       currentLobby.Game.Board, // not empty in practice lobbies
+		}
+		for _, conn := range lobbyConnections(currentLobby.ID) {
+			sendJSON(conn, start)
+		}
+
+		announce(currentLobby, "Both players are ready. The game will start now!")
+		startTurnClock(currentLobby)
+		notifyBotTurn(currentLobby)
+	}
+	return nil
+}
+
+// applyMove is the single path for moves from both the websocket and the REST API.
+// it checks the player may move, plays it, broadcasts the result to the lobby and saves the lobby
+func applyMove(currentLobby *models.Lobby, playerID string, position int) (game.GameMessage, error) {
+	player := lobby.FindPlayer(currentLobby, playerID)
+	if player == nil || !lobby.IsSeated(currentLobby, playerID) {
+		return game.GameMessage{}, errNotSeated
+	}
+	if !currentLobby.GameStarted {
+		return game.GameMessage{}, errGameNotStarted
+	}
+	if currentLobby.Game.CurrentTurn != player.Symbol {
+		return game.GameMessage{}, errNotYourTurn
+	}
+
+	response := currentLobby.Game.HandleGameMove(position, player.Symbol, player.Name)
+	if response.Type == "invalidMove" {
+		return response, errInvalidMove
+	}
+	publishResult(currentLobby, response)
+	return response, nil
+}
+
+// publishResult sends a move result to everyone in the lobby, ending the game when the
+// result says it is over, and saves the lobby
+func publishResult(currentLobby *models.Lobby, response game.GameMessage) {
+	cancelBotTurn(currentLobby.ID)
+	// any move turns down a pending draw offer
+	currentLobby.DrawOffer = ""
+
+	broadcastMove(currentLobby, response)
+	storeLobbyState(currentLobby.ID, currentLobby)
+
+	for _, conn := range lobbyConnections(currentLobby.ID) {
+		if err := websocket.JSON.Send(conn, response); err != nil {
+			log.Printf("Error sending move message: %v", err)
+			continue
+		}
+	}
+
+	// keep seated bots in the loop
+	if response.Next == "updateTurn" {
+		startTurnClock(currentLobby)
+		notifyBotTurn(currentLobby)
+	} else {
+		stopTurnClock(currentLobby.ID)
+		notifyBotsGameOver(currentLobby, response)
+		freeDisconnectedSeats(currentLobby)
+	}
+}
+
+// timers ending timed games when the player to move runs out, keyed by lobby ID.
+// without them a flag only falls when the player finally moves
+type turnClock struct {
+	timer *time.Timer
+}
+
+var (
+	turnClocksMu sync.Mutex
+	turnClocks   = make(map[string]*turnClock)
+)
+
+// startTurnClock (re)arms the lobby's timer for the turn in progress, a no-op in untimed lobbies
+func startTurnClock(currentLobby *models.Lobby) {
+	stopTurnClock(currentLobby.ID)
+	g := currentLobby.Game
+	if g.TimeControl <= 0 || !currentLobby.GameStarted {
+		return
+	}
+
+	clock := &turnClock{}
+	turnClocksMu.Lock()
+	clock.timer = time.AfterFunc(g.TimeRemaining(g.CurrentTurn), func() { turnClockExpired(currentLobby, clock) })
+	turnClocks[currentLobby.ID] = clock
+	turnClocksMu.Unlock()
+}
+
+// stopTurnClock stops the lobby's timer, called when the game ends or the lobby closes
+func stopTurnClock(lobbyID string) {
+	turnClocksMu.Lock()
+	defer turnClocksMu.Unlock()
+	if clock, ok := turnClocks[lobbyID]; ok {
+		clock.timer.Stop()
+		delete(turnClocks, lobbyID)
+	}
+}
+
+// turnClockExpired ends the game as a timeout for the player to move. it runs on the
+// timer's goroutine, so it takes the lobby's lock like any other move
+func turnClockExpired(currentLobby *models.Lobby, clock *turnClock) {
+	unlock := lobby.Lock(currentLobby.ID)
+	defer unlock()
+
+	turnClocksMu.Lock()
+	current := turnClocks[currentLobby.ID] == clock
+	if current {
+		delete(turnClocks, currentLobby.ID)
+	}
+	turnClocksMu.Unlock()
+	if !current || !currentLobby.GameStarted {
+		return // a move landed or the game ended in the meantime
+	}
+
+	symbol := currentLobby.Game.CurrentTurn
+	if currentLobby.Game.TimeRemaining(symbol) > 0 {
+		// woke up early, wait out the rest
+		startTurnClock(currentLobby)
+		return
+	}
+
+	name := symbol
+	for _, p := range currentLobby.Players {
+		if p.Symbol == symbol {
+			name = p.Name
+		}
+	}
+	publishResult(currentLobby, currentLobby.Game.Timeout(symbol, name))
+}
+
+// resign ends the game in progress as a loss for the player
+func resign(currentLobby *models.Lobby, playerID string) error {
+	player := lobby.FindPlayer(currentLobby, playerID)
+	if player == nil || !lobby.IsSeated(currentLobby, playerID) {
+		return errNotSeated
+	}
+	if !currentLobby.GameStarted {
+		return errGameNotStarted
+	}
+	publishResult(currentLobby, currentLobby.Game.Resign(player.Symbol, player.Name))
+	return nil
+}
+
+// offerDraw offers the opponent a draw, or takes the one they offered. agreed is true
+// when the game ended in a draw
+func offerDraw(currentLobby *models.Lobby, playerID string) (agreed bool, err error) {
+	player := lobby.FindPlayer(currentLobby, playerID)
+	if player == nil || !lobby.IsSeated(currentLobby, playerID) {
+		return false, errNotSeated
+	}
+	if !currentLobby.GameStarted {
+		return false, errGameNotStarted
+	}
+
+	switch currentLobby.DrawOffer {
+	case playerID:
+		return false, errDrawOffered
+	case "":
+		for _, p := range currentLobby.Players {
+			if p.ID != playerID && p.IsBot {
+				return false, errBotDraw
+			}
+		}
+		currentLobby.DrawOffer = playerID
+		return false, nil
+	}
+
+	publishResult(currentLobby, currentLobby.Game.AgreeDraw())
+	return true, nil
+}
+
+// hint asks the solver for the player's best move, counting it against the lobby's hints
+// per game. everyone is told a hint was used so it's no secret to the opponent. returns
+// the move and how many hints the player has left
+func hint(currentLobby *models.Lobby, playerID string) (bot.MoveEvaluation, int, error) {
+	player := lobby.FindPlayer(currentLobby, playerID)
+	if player == nil || !lobby.IsSeated(currentLobby, playerID) {
+		return bot.MoveEvaluation{}, 0, errNotSeated
+	}
+	if currentLobby.Settings.Rated {
+		return bot.MoveEvaluation{}, 0, errHintsRated
+	}
+	if currentLobby.Settings.HintsPerGame == 0 {
+		return bot.MoveEvaluation{}, 0, errHintsOff
+	}
+	if !currentLobby.GameStarted {
+		return bot.MoveEvaluation{}, 0, errGameNotStarted
+	}
+	if currentLobby.Game.CurrentTurn != player.Symbol {
+		return bot.MoveEvaluation{}, 0, errNotYourTurn
+	}
+	if currentLobby.HintsUsed[playerID] >= currentLobby.Settings.HintsPerGame {
+		return bot.MoveEvaluation{}, 0, errNoHintsLeft
+	}
+
+	// the first of the best moves, in board order
+	var best bot.MoveEvaluation
+	for _, m := range bot.Analyze(game.PositionOf(currentLobby.Game), currentLobby.Game.Variant) {
+		if m.Best {
+			best = m
+			break
+		}
+	}
+
+	if currentLobby.HintsUsed == nil {
+		currentLobby.HintsUsed = make(map[string]int)
+	}
+	currentLobby.HintsUsed[playerID]++
+	left := currentLobby.Settings.HintsPerGame - currentLobby.HintsUsed[playerID]
+	announce(currentLobby, fmt.Sprintf("%v (%v) used a hint, %d left this game.", player.Name, player.Symbol, left))
+	return best, left, nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"tictacgo/internal/game"
+	"tictacgo/internal/lobby"
+)
+
+// longest notation accepted by the import, a full game is well under 1 KB
+const maxNotationSize = 16 << 10
+
+// ImportRequest is the JSON body of POST /api/v1/games/import, the notation can also be sent as text/plain
+type ImportRequest struct {
+	Notation string `json:"notation"`
+}
+
+// ImportedGame is a game read from notation and replayed move by move
+type ImportedGame struct {
+	Tags     map[string]string `json:"tags"`
+	Moves    []string          `json:"moves"` // squares, a1 to c3
+	Board    [9]string         `json:"board"` // after the last move
+	Finished bool              `json:"finished"`
+	Result   string            `json:"result"` // "1-0", "0-1", "1/2-1/2" or "*"
+	Next     string            `json:"next"`   // how it ended, like a move's next: "win", "draw", "timeout", "resign", or "updateTurn" when it didn't
+	Winner   string            `json:"winner"`
+	Notation string            `json:"notation"` // the game written out again, tidied up
+}
+
+// APIGameNotation handles GET /api/v1/lobbies/{id}/games/{number}/notation, a finished
+// game of the lobby written in notation
+func APIGameNotation(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	record := lobby.FindGame(currentLobby, number)
+	if record == nil {
+		writeError(w, http.StatusNotFound, "not_found", "no finished game with that number in this lobby")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"lobby-%s-game-%d.txt\"", currentLobby.ID, number))
+	io.WriteString(w, game.FormatNotation(lobby.Notation(currentLobby, *record)))
+}
+
+// APIImportGame handles POST /api/v1/games/import, checking a game in notation is legal
+// by replaying it. nothing is stored, the replayed game is sent back for analysis
+func APIImportGame(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotationSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "couldn't read the request body")
+		return
+	}
+	if len(body) > maxNotationSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "too_large", "notation is limited to 16 KB")
+		return
+	}
+	notation := string(body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req ImportRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "body must be {\"notation\": \"...\"}")
+			return
+		}
+		notation = req.Notation
+	}
+
+	record, err := game.ParseNotation(notation)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_notation", err.Error())
+		return
+	}
+	board, last, err := game.Replay(record)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "illegal_game", err.Error())
+		return
+	}
+
+	imported := ImportedGame{
+		Tags:     record.Tags,
+		Moves:    []string{},
+		Board:    board,
+		Finished: record.Tag("Result") != game.ResultOngoing,
+		Result:   record.Tag("Result"),
+		Next:     last.Next,
+		Winner:   last.Winner,
+		Notation: game.FormatNotation(*record),
+	}
+	for _, position := range record.Moves {
+		imported.Moves = append(imported.Moves, game.Square(position))
+	}
+	// a game with no moves hasn't had a result yet
+	if imported.Next == "" {
+		imported.Next = "updateTurn"
+		imported.Winner = "none"
+	}
+	writeJSON(w, http.StatusOK, imported)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"tictacgo/internal/game"
+)
+
+// PositionView describes a position, see game.Position for the encodings
+type PositionView struct {
+	Code          string    `json:"code"`
+	Key           int       `json:"key"`
+	Board         [9]string `json:"board"`
+	ToMove        string    `json:"toMove"`
+	Over          bool      `json:"over"`          // won or drawn already
+	CanonicalCode string    `json:"canonicalCode"` // the same for every rotation and mirror image
+	CanonicalKey  int       `json:"canonicalKey"`
+	Symmetry      int       `json:"symmetry"`              // the transformation taking this position to the canonical one, 0-7
+	PracticeURL   string    `json:"practiceURL,omitempty"` // creates a lobby starting from the position
+}
+
+func newPositionView(position game.Position) PositionView {
+	canonical, symmetry := position.Canonical()
+	view := PositionView{
+		Code:          position.Code(),
+		Key:           position.Key(),
+		Board:         position.Board,
+		ToMove:        position.ToMove,
+		Over:          position.Over(),
+		CanonicalCode: canonical.Code(),
+		CanonicalKey:  canonical.Key(),
+		Symmetry:      int(symmetry),
+	}
+	if !view.Over {
+		view.PracticeURL = "/create-lobby?" + url.Values{"position": {view.Code}}.Encode()
+	}
+	return view
+}
+
+// APIGetPosition handles GET /api/v1/positions/{position}, looking up a position by its
+// code (e.g. x---o----x) or key
+func APIGetPosition(w http.ResponseWriter, r *http.Request) {
+	position, err := game.ParsePosition(r.PathValue("position"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_position", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newPositionView(position))
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"tictacgo/internal/auth"
+	"tictacgo/internal/lobby"
+	"tictacgo/internal/profile"
+	"tictacgo/models"
+)
+
+// Profiles, mounted under /api/v1/profile (the caller's) and /api/v1/profiles/{id} (anyone's).
+// lobbies get a profile message whenever one of their players changes theirs
+
+// ProfileUpdate is the body of PATCH /api/v1/profile, fields left out are unchanged
+type ProfileUpdate struct {
+	DisplayName *string              `json:"displayName"`
+	Colors      *models.SymbolColors `json:"colors"`
+}
+
+// APIGetProfile handles GET /api/v1/profiles/{id}
+func APIGetProfile(w http.ResponseWriter, r *http.Request) {
+	p := profile.Get(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "not_found", "player not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// APIMyProfile handles GET /api/v1/profile
+func APIMyProfile(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, profile.Get(account.ID))
+}
+
+// APIUpdateProfile handles PATCH /api/v1/profile
+func APIUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	var req ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"displayName\": \"...\", \"colors\": {\"x\": \"#rrggbb\", \"o\": \"#rrggbb\"}}")
+		return
+	}
+
+	if req.Colors != nil {
+		if err := profile.SetColors(account.ID, *req.Colors); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_profile", err.Error())
+			return
+		}
+	}
+	if req.DisplayName != nil && *req.DisplayName != account.Name {
+		if err := auth.Rename(account, *req.DisplayName); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		renamePlayer(account)
+	}
+
+	p := profile.Get(account.ID)
+	broadcastProfile(p)
+	writeJSON(w, http.StatusOK, p)
+}
+
+// APIUploadAvatar handles PUT /api/v1/profile/avatar. the image is either the raw
+// body or the "avatar" field of a multipart form
+func APIUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	// a little headroom for multipart boundaries and headers
+	r.Body = http.MaxBytesReader(w, r.Body, profile.MaxAvatarBytes+64*1024)
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		var file io.ReadCloser
+		if file, _, err = r.FormFile("avatar"); err == nil {
+			data, err = io.ReadAll(file)
+			file.Close()
+		}
+	} else {
+		data, err = io.ReadAll(r.Body)
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "too_large", profile.ErrAvatarTooLarge.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, "invalid_body", "send the image as the body or as the avatar field of a form")
+		return
+	}
+
+	p, err := profile.SetAvatar(account.ID, data)
+	switch {
+	case errors.Is(err, profile.ErrAvatarTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "too_large", err.Error())
+	case errors.Is(err, profile.ErrAvatarType):
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", err.Error())
+	case err != nil:
+		log.Printf("Error storing avatar: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to store avatar")
+	default:
+		broadcastProfile(p)
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+// APIDeleteAvatar handles DELETE /api/v1/profile/avatar
+func APIDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+	broadcastProfile(profile.RemoveAvatar(account.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// broadcastProfile sends the profile to every lobby the player is in, so boards and chat redraw it.
+// it runs in the background, the caller may be holding one of those lobbies' locks. p must be
+// a copy from profile.Get or profile.Update, never the one in models.Profiles
+func broadcastProfile(p *models.Profile) {
+	msg := map[string]interface{}{
+		"type":    "profile",
+		"profile": p,
+	}
+	go func() {
+		for _, currentLobby := range lobby.All() {
+			unlock := lobby.Lock(currentLobby.ID)
+			joined := lobby.FindPlayer(currentLobby, p.PlayerID) != nil
+			unlock()
+			if !joined {
+				continue
+			}
+			for _, conn := range lobbyConnections(currentLobby.ID) {
+				sendJSON(conn, msg)
+			}
+		}
+	}()
+}
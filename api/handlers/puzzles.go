@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"tictacgo/internal/auth"
+	"tictacgo/internal/lobby"
+	"tictacgo/internal/profile"
+	"tictacgo/internal/puzzle"
+	"tictacgo/models"
+	"time"
+)
+
+// PuzzleView is a puzzle of the library, see internal/puzzle
+type PuzzleView struct {
+	ID       int          `json:"id"`
+	Position PositionView `json:"position"`
+	WinIn    int          `json:"winIn"` // moves of the side to move
+	Rating   int          `json:"rating"`
+	Attempts int          `json:"attempts"`
+	Solved   int          `json:"solved"`
+	PlayURL  string       `json:"playURL"` // opens a puzzle lobby
+}
+
+func newPuzzleView(p *puzzle.Puzzle) PuzzleView {
+	rating, attempts, solved := puzzle.Stats(p)
+	return PuzzleView{
+		ID:       p.ID,
+		Position: newPositionView(p.Position),
+		WinIn:    p.WinIn,
+		Rating:   rating,
+		Attempts: attempts,
+		Solved:   solved,
+		PlayURL:  fmt.Sprintf("/puzzle?id=%d", p.ID),
+	}
+}
+
+// findPuzzle resolves a puzzle reference: an ID, "daily", or "next" for one near the
+// player's rating they haven't tried. nil when there is no such puzzle
+func findPuzzle(ref string, account *models.Account) *puzzle.Puzzle {
+	switch ref {
+	case "daily":
+		return puzzle.Daily(time.Now())
+	case "next":
+		// signed out callers get one near the default rating
+		if account == nil {
+			return puzzle.Next("", 0)
+		}
+		rating := 0
+		if p := profile.Get(account.ID); p != nil {
+			rating = p.Puzzles.Rating
+		}
+		return puzzle.Next(account.ID, rating)
+	}
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		return nil
+	}
+	return puzzle.Find(id)
+}
+
+// puzzle lobbies are for one player, Redis forgets them after a day without a save
+const puzzleLobbyTTL = 24 * time.Hour
+
+// startPuzzle opens a puzzle lobby with the player as host, closing the one they had open
+func startPuzzle(p *puzzle.Puzzle, hostID string) *models.Lobby {
+	closePuzzleLobbies(hostID)
+
+	newLobby := lobby.NewPuzzleLobby(p, hostID)
+	unlock := lobby.Lock(newLobby.ID)
+	defer unlock()
+	announce(newLobby, fmt.Sprintf("Puzzle %d: %s to play and win in %d against the solver. Ready up to start.", p.ID, p.Position.ToMove, p.WinIn))
+	storeLobbyState(newLobby.ID, newLobby)
+	return newLobby
+}
+
+// closePuzzleLobbies closes the puzzle lobbies a player opened, so each player has
+// at most one in memory however many puzzles they start
+func closePuzzleLobbies(hostID string) {
+	for _, currentLobby := range lobby.All() {
+		unlock := lobby.Lock(currentLobby.ID)
+		if currentLobby.Settings.Puzzle != 0 && lobby.IsHost(currentLobby, hostID) {
+			closeLobby(currentLobby)
+		}
+		unlock()
+	}
+}
+
+// finishPuzzle scores a finished game in a puzzle lobby and returns the GAMEMASTER announcement
+func finishPuzzle(currentLobby *models.Lobby, record models.GameRecord) string {
+	p := puzzle.Find(currentLobby.Settings.Puzzle)
+	if p == nil {
+		return ""
+	}
+
+	solved := lobby.PuzzleSolved(p, record)
+	text := fmt.Sprintf("Not solved, %s can win in %d.", p.Position.ToMove, p.WinIn)
+	if solved {
+		text = "Puzzle solved!"
+	}
+	player := lobby.PuzzlePlayer(currentLobby)
+	if player == nil {
+		return text + " Only the player who opened the puzzle is rated."
+	}
+
+	var change int
+	var rated bool
+	playerProfile := profile.Update(player.ID, func(pr *models.Profile) {
+		change, rated = puzzle.Record(p, player.ID, &pr.Puzzles, solved)
+	})
+	if playerProfile == nil {
+		return text
+	}
+	broadcastProfile(playerProfile)
+
+	if rated {
+		text += fmt.Sprintf(" %v's puzzle rating is now %d (%+d).", player.Name, playerProfile.Puzzles.Rating, change)
+	} else {
+		text += " Only the first attempt is rated."
+	}
+	return text + " Ready up to try again, or go to /puzzle?id=next for another one."
+}
+
+// PlayPuzzle handles GET /puzzle?id=<id, daily or next>, opening a puzzle lobby for the
+// signed in player and redirecting to its page
+func PlayPuzzle(w http.ResponseWriter, r *http.Request) {
+	ref := r.URL.Query().Get("id")
+	if ref == "" {
+		ref = "next"
+	}
+	account := auth.CurrentAccount(r)
+	if account == nil {
+		http.Error(w, "Sign in or play as a guest on the home page to try puzzles", http.StatusUnauthorized)
+		return
+	}
+	p := findPuzzle(ref, account)
+	if p == nil {
+		http.Error(w, "no such puzzle", http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, lobby.PageURL(startPuzzle(p, account.ID)), http.StatusSeeOther)
+}
+
+// APIGetPuzzle handles GET /api/v1/puzzles/{id}, where id can also be daily or next
+func APIGetPuzzle(w http.ResponseWriter, r *http.Request) {
+	p := findPuzzle(r.PathValue("id"), auth.CurrentAccount(r))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "not_found", "no such puzzle")
+		return
+	}
+	writeJSON(w, http.StatusOK, newPuzzleView(p))
+}
+
+// APIPlayPuzzle handles POST /api/v1/puzzles/{id}/play, opening a puzzle lobby for the
+// signed in player. the response is the lobby, join it like any other
+func APIPlayPuzzle(w http.ResponseWriter, r *http.Request) {
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+	p := findPuzzle(r.PathValue("id"), account)
+	if p == nil {
+		writeError(w, http.StatusNotFound, "not_found", "no such puzzle")
+		return
+	}
+
+	newLobby := startPuzzle(p, account.ID)
+	unlock := lobby.Lock(newLobby.ID)
+	view := newLobbyView(newLobby)
+	unlock()
+	view.URL = lobby.PageURL(newLobby)
+	writeJSON(w, http.StatusCreated, view)
+}
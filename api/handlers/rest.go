@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"tictacgo/internal/chat"
+	"tictacgo/internal/game"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+	"time"
+)
+
+// REST API, mounted under /api/v1. the caller is the account signed in with the
+// session cookie (see auth.go), its ID is their player ID in every lobby
+
+// APIError is the body of every non-2xx response
+type APIError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// PlayerView is a seated player or spectator as returned by the API
+type PlayerView struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Symbol string `json:"symbol"`
+	Role   string `json:"role"`
+	Ready  bool   `json:"ready"`
+	IsBot  bool   `json:"isBot"`
+}
+
+// LobbyView is a lobby as returned by the API
+type LobbyView struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	URL         string               `json:"url"`
+	HostID      string               `json:"hostId"`
+	Settings    models.LobbySettings `json:"settings"`
+	GameStarted bool                 `json:"gameStarted"`
+	Players     []PlayerView         `json:"players"`
+	Spectators  []PlayerView         `json:"spectators"`
+}
+
+// GameView is the state of the board
+type GameView struct {
+	Board       [9]string      `json:"board"`
+	CurrentTurn string         `json:"currentTurn"`
+	GameStarted bool           `json:"gameStarted"`
+	Variant     string         `json:"variant"`
+	Clock       map[string]int `json:"clock,omitempty"`
+	Position    string         `json:"position"` // code of the board and turn, for sharing, see /api/v1/positions
+}
+
+// MoveRequest is the body of POST /api/v1/lobbies/{id}/moves
+type MoveRequest struct {
+	Position int `json:"position"`
+}
+
+// ReadyRequest is the body of POST /api/v1/lobbies/{id}/ready
+type ReadyRequest struct {
+	Ready bool `json:"ready"`
+}
+
+// writeJSON writes a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeError writes an APIError response
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	var body APIError
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+// loads the lobby named in the path, takes its lock and checks private lobby access.
+// writes the error response and returns nil when the request can't continue, otherwise
+// the caller releases the lock with unlock once it's done with the lobby
+func apiLobby(w http.ResponseWriter, r *http.Request) (currentLobby *models.Lobby, unlock func()) {
+	currentLobby, err := lobby.Load(r.PathValue("id"))
+	if errors.Is(err, lobby.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "lobby not found")
+		return nil, nil
+	} else if err != nil {
+		log.Printf("Error loading lobby: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to load lobby")
+		return nil, nil
+	}
+
+	unlock = lobby.Lock(currentLobby.ID)
+	// closed while this request waited for the lock
+	if loaded, exists := lobby.Lookup(currentLobby.ID); !exists || loaded != currentLobby {
+		unlock()
+		writeError(w, http.StatusNotFound, "not_found", "lobby not found")
+		return nil, nil
+	}
+
+	if !lobby.CanAccess(currentLobby, r) {
+		unlock()
+		writeError(w, http.StatusForbidden, "forbidden", "this lobby is private, a passcode or invite is required")
+		return nil, nil
+	}
+	return currentLobby, unlock
+}
+
+func newPlayerView(currentLobby *models.Lobby, p *models.Player) PlayerView {
+	return PlayerView{
+		ID:     p.ID,
+		Name:   p.Name,
+		Symbol: p.Symbol,
+		Role:   lobby.Role(currentLobby, p.ID),
+		Ready:  currentLobby.ReadyPlayers[p.Name],
+		IsBot:  p.IsBot,
+	}
+}
+
+func newLobbyView(currentLobby *models.Lobby) LobbyView {
+	view := LobbyView{
+		ID:          currentLobby.ID,
+		Name:        currentLobby.Name,
+		URL:         "/lobby/" + currentLobby.ID,
+		HostID:      currentLobby.HostID,
+		Settings:    currentLobby.Settings,
+		GameStarted: currentLobby.GameStarted,
+		Players:     []PlayerView{},
+		Spectators:  []PlayerView{},
+	}
+	for _, p := range currentLobby.Players {
+		view.Players = append(view.Players, newPlayerView(currentLobby, p))
+	}
+	for _, p := range currentLobby.Spectators {
+		view.Spectators = append(view.Spectators, newPlayerView(currentLobby, p))
+	}
+	return view
+}
+
+func newGameView(currentLobby *models.Lobby) GameView {
+	return GameView{
+		Board:       currentLobby.Game.Board,
+		CurrentTurn: currentLobby.Game.CurrentTurn,
+		GameStarted: currentLobby.GameStarted,
+		Variant:     currentLobby.Game.Variant,
+		Clock:       clockSeconds(currentLobby.Game),
+		Position:    game.PositionOf(currentLobby.Game).Code(),
+	}
+}
+
+// APICreateLobby handles POST /api/v1/lobbies, the body matches /create-lobby
+func APICreateLobby(w http.ResponseWriter, r *http.Request) {
+	newLobby, err := lobby.CreateFromJSON(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_settings", err.Error())
+		return
+	}
+	storeLobbyState(newLobby.ID, newLobby)
+
+	view := newLobbyView(newLobby)
+	view.URL = lobby.PageURL(newLobby)
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// APIGetLobby handles GET /api/v1/lobbies/{id}
+func APIGetLobby(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	writeJSON(w, http.StatusOK, newLobbyView(currentLobby))
+}
+
+// APIDeleteLobby handles DELETE /api/v1/lobbies/{id}, only the host may close a lobby
+func APIDeleteLobby(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+	if !lobby.IsHost(currentLobby, account.ID) {
+		writeError(w, http.StatusForbidden, "forbidden", "only the host can delete the lobby")
+		return
+	}
+
+	closeLobby(currentLobby)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIGetGame handles GET /api/v1/lobbies/{id}/game
+func APIGetGame(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	writeJSON(w, http.StatusOK, newGameView(currentLobby))
+}
+
+// APIMove handles POST /api/v1/lobbies/{id}/moves, playing for the caller's seat
+func APIMove(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"position\": 0-8}")
+		return
+	}
+
+	result, err := applyMove(currentLobby, account.ID, req.Position)
+	switch {
+	case errors.Is(err, errNotSeated):
+		writeError(w, http.StatusForbidden, "not_seated", err.Error())
+	case errors.Is(err, errGameNotStarted):
+		writeError(w, http.StatusConflict, "game_not_started", err.Error())
+	case errors.Is(err, errNotYourTurn):
+		writeError(w, http.StatusConflict, "not_your_turn", err.Error())
+	case errors.Is(err, errInvalidMove):
+		writeError(w, http.StatusUnprocessableEntity, "invalid_move", err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+	default:
+		writeJSON(w, http.StatusOK, struct {
+			Result game.GameMessage `json:"result"`
+			Game   GameView         `json:"game"`
+		}{result, newGameView(currentLobby)})
+	}
+}
+
+// APIListPlayers handles GET /api/v1/lobbies/{id}/players
+func APIListPlayers(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	view := newLobbyView(currentLobby)
+	writeJSON(w, http.StatusOK, struct {
+		HostID     string       `json:"hostId"`
+		Players    []PlayerView `json:"players"`
+		Spectators []PlayerView `json:"spectators"`
+	}{view.HostID, view.Players, view.Spectators})
+}
+
+// APIJoinLobby handles POST /api/v1/lobbies/{id}/players, taking a free seat or spectating
+// as the signed in account. joining again returns the existing player
+func APIJoinLobby(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	player, joined, err := lobby.Join(currentLobby, account.Name, account.ID)
+	if errors.Is(err, lobby.ErrBanned) {
+		writeError(w, http.StatusForbidden, "banned", err.Error())
+		return
+	} else if errors.Is(err, lobby.ErrLobbyFull) {
+		writeError(w, http.StatusConflict, "lobby_full", err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if joined {
+		status = http.StatusCreated
+		lobby.AnnounceJoin(currentLobby, player, connectionSet(currentLobby.ID))
+		storeLobbyState(currentLobby.ID, currentLobby)
+	}
+	writeJSON(w, status, newPlayerView(currentLobby, player))
+}
+
+// APIReady handles POST /api/v1/lobbies/{id}/ready for the caller's seat
+func APIReady(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+
+	account := apiAccount(w, r)
+	if account == nil {
+		return
+	}
+
+	var req ReadyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "body must be {\"ready\": true|false}")
+		return
+	}
+
+	if err := setReady(currentLobby, account.ID, req.Ready); err != nil {
+		writeError(w, http.StatusForbidden, "not_seated", err.Error())
+		return
+	}
+	storeLobbyState(currentLobby.ID, currentLobby)
+	writeJSON(w, http.StatusOK, newGameView(currentLobby))
+}
+
+// APIChatHistory handles GET /api/v1/lobbies/{id}/chat, the newest messages first page.
+// ?before=<message id> pages back, ?limit= sets the page size. ?channel= picks the channel,
+// anything but all needs the caller to be able to read it
+func APIChatHistory(w http.ResponseWriter, r *http.Request) {
+	currentLobby, unlock := apiLobby(w, r)
+	if currentLobby == nil {
+		return
+	}
+	defer unlock()
+
+	channel := r.URL.Query().Get("channel")
+	if channel == "" {
+		channel = chat.ChannelAll
+	}
+	if !chat.ValidChannel(channel) {
+		writeError(w, http.StatusBadRequest, "invalid_channel", "channel must be all, players, spectators or whisper")
+		return
+	}
+	var playerID string
+	if channel != chat.ChannelAll {
+		account := apiAccount(w, r)
+		if account == nil {
+			return
+		}
+		if !chat.CanReadChannel(currentLobby, account.ID, channel) {
+			writeError(w, http.StatusForbidden, "forbidden", "you can't read the "+channel+" channel of this lobby")
+			return
+		}
+		playerID = account.ID
+	}
+
+	before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	type chatView struct {
+		ID        int                 `json:"id"`
+		Text      string              `json:"text"`
+		Sender    string              `json:"sender"`
+		SenderID  string              `json:"senderId,omitempty"` // empty for GAMEMASTER
+		Timestamp time.Time           `json:"timestamp"`
+		Emote     bool                `json:"emote,omitempty"`
+		Channel   string              `json:"channel,omitempty"`
+		To        string              `json:"to,omitempty"` // whispers only
+		ToName    string              `json:"toName,omitempty"`
+		EditedAt  *time.Time          `json:"editedAt,omitempty"`
+		Deleted   bool                `json:"deleted,omitempty"`
+		Reactions map[string][]string `json:"reactions,omitempty"` // player IDs by emoji
+	}
+	page, more := chat.History(currentLobby, channel, playerID, before, limit)
+	messages := []chatView{}
+	for _, m := range page {
+		messages = append(messages, chatView{m.ID, m.Text, m.Sender, m.SenderID, m.Timestamp, m.Emote, m.Channel, m.To, m.ToName, m.EditedAt, m.Deleted, m.Reactions})
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Messages []chatView `json:"messages"`
+		HasMore  bool       `json:"hasMore"`
+	}{messages, more})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"tictacgo/internal/lobby"
+	"tictacgo/models"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// handleSeatMessage lets a spectator take an empty seat or a player give theirs up
+func handleSeatMessage(currentLobby *models.Lobby, ws *websocket.Conn, msgType string) {
+	playerID := connectionPlayer(ws)
+
+	switch msgType {
+	case "takeSeat":
+		player, err := lobby.TakeSeat(currentLobby, playerID)
+		if err != nil {
+			sendJSON(ws, map[string]interface{}{"type": "error", "text": err.Error()})
+			return
+		}
+		notifyAssignments(currentLobby, []*models.Player{player})
+		announce(currentLobby, fmt.Sprintf("%v took the %v seat.", player.Name, player.Symbol))
+	case "leaveSeat":
+		if err := leaveSeat(currentLobby, playerID); err != nil {
+			sendJSON(ws, map[string]interface{}{"type": "error", "text": err.Error()})
+		}
+	}
+}
+
+// leaveSeat moves a seated player to the spectators, or out of the lobby when there is
+// no room, and tells spectators the seat is free
+func leaveSeat(currentLobby *models.Lobby, playerID string) error {
+	player, stayed, err := lobby.LeaveSeat(currentLobby, playerID)
+	if err != nil {
+		return err
+	}
+	if stayed {
+		notifyAssignments(currentLobby, []*models.Player{player})
+		announce(currentLobby, fmt.Sprintf("%v left their seat and is now spectating.", player.Name))
+	} else {
+		removePlayerConnections(currentLobby.ID, player.ID, "lobbyFull", "You left your seat and there is no room to spectate.")
+		announce(currentLobby, fmt.Sprintf("%v left the lobby.", player.Name))
+	}
+	notifySeatOpen(currentLobby)
+	return nil
+}
+
+// how long a seated player who disconnects keeps their seat, long enough to reload the page
+const disconnectGrace = 15 * time.Second
+
+// freeSeatLater gives up a disconnected player's seat once the grace period is over,
+// unless they reconnected or a game is on. the game's end checks again, see freeDisconnectedSeats
+func freeSeatLater(currentLobby *models.Lobby, playerID string) {
+	if playerID == "" {
+		return
+	}
+	time.AfterFunc(disconnectGrace, func() {
+		unlock := lobby.Lock(currentLobby.ID)
+		defer unlock()
+		if loaded, exists := lobby.Lookup(currentLobby.ID); !exists || loaded != currentLobby {
+			return // closed in the meantime
+		}
+		if currentLobby.GameStarted || !lobby.IsSeated(currentLobby, playerID) || len(playerConnections(currentLobby.ID, playerID)) > 0 {
+			return
+		}
+		if err := leaveSeat(currentLobby, playerID); err == nil {
+			storeLobbyState(currentLobby.ID, currentLobby)
+		}
+	})
+}
+
+// freeDisconnectedSeats starts the grace period again for seated players without a
+// connection, called when a game ends so a player who dropped mid-game doesn't keep their seat
+func freeDisconnectedSeats(currentLobby *models.Lobby) {
+	for _, p := range currentLobby.Players {
+		// bots connect through their own socket, see bots.go
+		if !p.IsBot && len(playerConnections(currentLobby.ID, p.ID)) == 0 {
+			freeSeatLater(currentLobby, p.ID)
+		}
+	}
+}
+
+// notifySeatOpen tells spectators they can take the empty seat
+func notifySeatOpen(currentLobby *models.Lobby) {
+	symbol := lobby.FreeSeat(currentLobby)
+	if symbol == "" {
+		return
+	}
+	for _, spectator := range currentLobby.Spectators {
+		sendToPlayer(currentLobby.ID, spectator.ID, map[string]interface{}{
+			"type":   "seatOpen",
+			"symbol": symbol,
+			"text":   fmt.Sprintf("The %v seat is open, take it to play!", symbol),
+		})
+	}
+}
@@ -2,13 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"tictacgo/internal/auth"
 	"tictacgo/internal/chat"
 	"tictacgo/internal/game"
 	"tictacgo/internal/lobby"
+	"tictacgo/internal/profile"
 	"tictacgo/models"
+	"time"
 
 	"github.com/go-redis/redis"
 	"golang.org/x/net/websocket"
@@ -18,14 +25,48 @@ import (
 // store active game lobbies in a map, a map in go is used to store key value pairs, dictionary-like
 var LobbyConnections = make(map[string][]*websocket.Conn)
 
+// player ID bound to each connection once setUsername has been handled, always the account's ID
+var ConnectionPlayers = make(map[*websocket.Conn]string)
+
+// guards LobbyConnections and ConnectionPlayers, use the helpers below rather than the maps
+var connectionsMu sync.RWMutex
+
 var redisClient = redis.NewClient(&redis.Options{
 	Addr: os.Getenv("REDIS_ADDRESS"), // Use environment variable
 })
 
+// AuthenticateUpgrade runs before the /ws upgrade, turning away requests without a valid
+// access token (Authorization header or access_token parameter) or session cookie
+func AuthenticateUpgrade(config *websocket.Config, r *http.Request) error {
+	if auth.UpgradeAccount(r) == nil {
+		return errors.New("websocket: not signed in")
+	}
+
+	// the origin check websocket.Handler does by default
+	var err error
+	config.Origin, err = websocket.Origin(config, r)
+	if err == nil && config.Origin == nil {
+		return errors.New("websocket: null origin")
+	}
+	return err
+}
+
 // HandleWebSocket - Handle WebSocket connection
 // manages Chat, Moves, Ready Messages, and Game State
 // Ensure only one active connection per player
 func HandleWebSocket(ws *websocket.Conn) {
+	// the player is whoever the token or session cookie on the upgrade request belongs to,
+	// checked again here in case the token was revoked during the handshake
+	account := auth.UpgradeAccount(ws.Request())
+	if account == nil {
+		sendJSON(ws, map[string]interface{}{
+			"type": "error",
+			"text": "Sign in or play as a guest before joining a lobby.",
+		})
+		ws.Close()
+		return
+	}
+
 	query := ws.Request().URL.Query()
 	lobbyID := query.Get("lobby")
 
@@ -35,33 +76,37 @@ func HandleWebSocket(ws *websocket.Conn) {
 		return
 	}
 
-	currentLobby, exists := models.Lobbies[lobbyID]
+	currentLobby, exists := lobby.Lookup(lobbyID)
 	if !exists {
 		fmt.Println("Lobby not found")
 		ws.Close()
 		return
 	}
 
-	if _, exists := LobbyConnections[lobbyID]; !exists {
-		LobbyConnections[lobbyID] = []*websocket.Conn{}
+	// private lobbies need a passcode or invite token on the upgrade request
+	if !lobby.CanAccess(currentLobby, ws.Request()) {
+		fmt.Println("Access to private lobby denied")
+		ws.Close()
+		return
 	}
 
-	// TODO! - Test if still needed,
-	// Remove stale connections before adding a new one
-	removeDuplicateConnection(lobbyID, ws)
-
-	// Add the new connection
-	LobbyConnections[lobbyID] = append(LobbyConnections[lobbyID], ws)
+	// Add the new connection, removing stale ones first
+	addConnection(lobbyID, ws)
 
 	// Handle connection cleanup on disconnect
 	defer func() {
 		fmt.Println("Client disconnected, removing from lobby")
+		playerID := connectionPlayer(ws)
 		removeConnection(currentLobby.ID, ws)
+		unbindConnection(ws)
+		freeSeatLater(currentLobby, playerID)
 	}()
 
+	unlock := lobby.Lock(lobbyID)
 	HandleInitialConnection(ws, currentLobby)
+	unlock()
 
-	// Handle incoming messages
+	// Handle incoming messages, one at a time under the lobby's lock
 	for {
 		var msg map[string]interface{}
 		err := websocket.JSON.Receive(ws, &msg)
@@ -75,90 +120,188 @@ func HandleWebSocket(ws *websocket.Conn) {
 			continue
 		}
 
-		switch msgType {
-		case "setUsername":
-			username, ok := msg["username"].(string)
-			if !ok {
-				continue
-			}
-			var id string
-			if idVal, ok := msg["id"].(string); ok {
-				id = idVal
-			}
+		unlock = lobby.Lock(lobbyID)
+		keep := handleLobbyMessage(currentLobby, ws, account, msgType, msg)
+		unlock()
+		if !keep {
+			return
+		}
+	}
+}
 
-			lobby.AssignAndNotifyPlayer(currentLobby, ws, username, id, LobbyConnections)
-
-			storeLobbyState(lobbyID, currentLobby)
-		case "chat":
-			chat.HandleChatMessage(currentLobby.ID, msg, LobbyConnections)
-			storeLobbyState(lobbyID, currentLobby)
-		case "move":
-			rawPosition := msg["position"].(float64)
-			username := msg["username"].(string)
-			position := int(rawPosition)
-			symbol := msg["symbol"].(string)
-
-			response := currentLobby.Game.HandleGameMove(position, symbol, username)
-			broadcastMove(currentLobby, response)
-			storeLobbyState(lobbyID, currentLobby)
-
-			for _, conn := range LobbyConnections[currentLobby.ID] {
-				if err := websocket.JSON.Send(conn, response); err != nil {
-					log.Printf("Error sending move message: %v", err)
-					continue
-				}
-			}
-		case "ready":
-			username := msg["username"].(string)
-			ready := msg["ready"].(bool)
-
-			if ready {
-				currentLobby.ReadyPlayers[username] = true
-				if len(currentLobby.ReadyPlayers) == 2 && !currentLobby.GameStarted {
-					currentLobby.GameStarted = true // Prevent duplicate start messages
-					start := map[string]interface{}{
-						"type": "startGame",
-					}
-					for _, conn := range LobbyConnections[currentLobby.ID] {
-						sendJSON(conn, start)
-					}
-
-					gameMasterMessage := map[string]interface{}{
-						"type":   "chat",
-						"sender": "GAMEMASTER",
-						"text":   "Both players are ready. The game will start now!",
-					}
-					chat.HandleChatMessage(currentLobby.ID, gameMasterMessage, LobbyConnections)
-				}
-			} else if !ready {
-				delete(currentLobby.ReadyPlayers, username)
-				fmt.Printf("Player %s is no longer ready\n", username)
-			}
+// handleLobbyMessage runs one message from the websocket, the caller holds the lobby's lock.
+// returns false when the connection should be dropped
+func handleLobbyMessage(currentLobby *models.Lobby, ws *websocket.Conn, account *models.Account, msgType string, msg map[string]interface{}) bool {
+	switch msgType {
+	case "setUsername":
+		// joins the lobby, the name and ID come from the account and not the message
+		player := lobby.AssignAndNotifyPlayer(currentLobby, ws, account.Name, account.ID, connectionSet(currentLobby.ID))
+		if player == nil {
+			// turned away (banned), drop the connection
+			return false
+		}
+		bindConnection(ws, player.ID)
+
+		storeLobbyState(currentLobby.ID, currentLobby)
+	case "chat":
+		// only players who have joined can talk, and only as themselves
+		player := lobby.FindPlayer(currentLobby, connectionPlayer(ws))
+		if player == nil {
+			return true
+		}
+		text, _ := msg["text"].(string)
+
+		// commands work with chat disabled, they aren't posted (except /me, which checks itself)
+		if chat.IsCommand(text) {
+			runChatCommand(currentLobby, ws, player, text)
+			storeLobbyState(currentLobby.ID, currentLobby)
+			return true
 		}
+
+		if !currentLobby.Settings.ChatEnabled {
+			sendJSON(ws, map[string]interface{}{
+				"type": "error",
+				"text": "Chat is disabled in this lobby.",
+			})
+			return true
+		}
+		// "all" when missing, whispers name the player they go to
+		channel, _ := msg["channel"].(string)
+		to, _ := msg["to"].(string)
+		err := postChat(currentLobby, player, text, channel, to, false)
+		var rejection *chat.Rejection
+		if errors.As(err, &rejection) {
+			// only the sender hears why
+			sendJSON(ws, map[string]interface{}{
+				"type":   "chatRejected",
+				"reason": rejection.Reason,
+				"text":   rejection.Text,
+			})
+			return true
+		}
+		// the message is in the lobby's chat list already, no need to save the whole lobby
+	case "chatEdit", "chatDelete", "chatReact":
+		handleChatChange(currentLobby, ws, msgType, msg)
+	case "chatHistory":
+		// a page of a channel's messages older than "before", for scrolling back
+		channel, _ := msg["channel"].(string)
+		if channel == "" {
+			channel = chat.ChannelAll
+		}
+		before, _ := msg["before"].(float64)
+		limit, _ := msg["limit"].(float64)
+		messages, more := chat.History(currentLobby, channel, connectionPlayer(ws), int(before), int(limit))
+		sendJSON(ws, map[string]interface{}{
+			"type":     "chatHistory",
+			"channel":  channel,
+			"messages": messages,
+			"hasMore":  more,
+		})
+	case "move":
+		rawPosition, ok := msg["position"].(float64)
+		if !ok {
+			return true
+		}
+
+		// the symbol comes from the player bound to this connection, not the message
+		if _, err := applyMove(currentLobby, connectionPlayer(ws), int(rawPosition)); err != nil {
+			sendJSON(ws, map[string]interface{}{
+				"type": "error",
+				"text": err.Error(),
+			})
+		}
+	case "ready":
+		ready, ok := msg["ready"].(bool)
+		if !ok {
+			return true
+		}
+
+		// only seated players can ready up, the name comes from the bound player
+		if err := setReady(currentLobby, connectionPlayer(ws), ready); err != nil {
+			sendJSON(ws, map[string]interface{}{
+				"type": "error",
+				"text": err.Error(),
+			})
+		}
+	case "hint":
+		// only the asking player sees the move, everyone hears a hint was used
+		move, left, err := hint(currentLobby, connectionPlayer(ws))
+		if err != nil {
+			sendJSON(ws, map[string]interface{}{
+				"type": "error",
+				"text": err.Error(),
+			})
+			return true
+		}
+		sendJSON(ws, map[string]interface{}{
+			"type":      "hint",
+			"position":  move.Position,
+			"square":    game.Square(move.Position),
+			"outcome":   move.Outcome,
+			"moves":     move.Moves,
+			"hintsLeft": left,
+		})
+		storeLobbyState(currentLobby.ID, currentLobby)
+	case "takeSeat", "leaveSeat":
+		handleSeatMessage(currentLobby, ws, msgType)
+		storeLobbyState(currentLobby.ID, currentLobby)
+	case "kick", "ban", "swapSeats", "promote", "addBot", "transferHost", "mute", "unmute":
+		handleHostMessage(currentLobby, ws, msgType, msg)
+		storeLobbyState(currentLobby.ID, currentLobby)
 	}
+	return true
 }
 
 // broadcast state to a newly connected user when they first connect to the lobby
 func HandleInitialConnection(ws *websocket.Conn, lobby *models.Lobby) {
+	// the all channel, clients ask for the others with chatHistory once they know their seat
+	chatMessages, chatHasMore := chat.History(lobby, chat.ChannelAll, "", 0, chat.HistoryWindow)
 	initialState := struct {
-		Type         string               `json:"type"`
-		GameBoard    [9]string            `json:"gameBoard"`
-		CurrentTurn  string               `json:"currentTurn"`
-		GameStarted  bool                 `json:"gameStarted"`
-		ChatMessages []models.ChatMessage `json:"chatMessages"`
-		ReadyPlayers map[string]bool      `json:"readyPlayers"`
+		Type           string                     `json:"type"`
+		Settings       models.LobbySettings       `json:"settings"`
+		Clock          map[string]int             `json:"clock,omitempty"` // seconds left per symbol in timed lobbies
+		GameBoard      [9]string                  `json:"gameBoard"`
+		CurrentTurn    string                     `json:"currentTurn"`
+		GameStarted    bool                       `json:"gameStarted"`
+		ChatMessages   []models.ChatMessage       `json:"chatMessages"` // the newest chat.HistoryWindow, request older with chatHistory
+		ChatHasMore    bool                       `json:"chatHasMore"`
+		ReadyPlayers   map[string]bool            `json:"readyPlayers"`
+		Players        []*models.Player           `json:"players"`
+		Spectators     []*models.Player           `json:"spectators"`
+		Profiles       map[string]*models.Profile `json:"profiles"`       // keyed by player ID
+		Reactions      []string                   `json:"reactions"`      // emoji chat messages can be reacted with
+		ChatEditWindow int                        `json:"chatEditWindow"` // seconds a message stays editable
 	}{
-		Type:         "initialState",
-		GameBoard:    lobby.Game.Board,
-		CurrentTurn:  lobby.CurrentTurn,
-		GameStarted:  lobby.GameStarted,
-		ChatMessages: lobby.ChatMessages,
-		ReadyPlayers: lobby.ReadyPlayers,
+		Type:           "initialState",
+		Settings:       lobby.Settings,
+		Clock:          clockSeconds(lobby.Game),
+		GameBoard:      lobby.Game.Board,
+		CurrentTurn:    lobby.Game.CurrentTurn,
+		GameStarted:    lobby.GameStarted,
+		ChatMessages:   chatMessages,
+		ChatHasMore:    chatHasMore,
+		ReadyPlayers:   lobby.ReadyPlayers,
+		Players:        lobby.Players,
+		Spectators:     lobby.Spectators,
+		Profiles:       profile.ForLobby(lobby),
+		Reactions:      chat.Reactions,
+		ChatEditWindow: int(chat.EditWindow.Seconds()),
 	}
 
 	websocket.JSON.Send(ws, initialState)
 }
 
+// seconds left on each clock, nil when the lobby is untimed
+func clockSeconds(g *game.Game) map[string]int {
+	if g.TimeControl <= 0 {
+		return nil
+	}
+	return map[string]int{
+		"X": int(g.TimeRemaining("X").Seconds()),
+		"O": int(g.TimeRemaining("O").Seconds()),
+	}
+}
+
 // Helper function to send a JSON message over the WebSocket
 // used for sending to individial client instead of all clients
 func sendJSON(ws *websocket.Conn, msg map[string]interface{}) {
@@ -173,27 +316,50 @@ func sendJSON(ws *websocket.Conn, msg map[string]interface{}) {
 	}
 }
 
-func broadcastMove(lobby *models.Lobby, result game.GameMessage) {
+func broadcastMove(currentLobby *models.Lobby, result game.GameMessage) {
+	var text string
 	switch result.Next {
 	case "win":
-		gameMasterMessage := map[string]interface{}{
-			"type":   "chat",
-			"sender": "GAMEMASTER",
-			"text":   fmt.Sprintf("%v Wins!!", result.Winner),
-		}
-
-		lobby.Game.Reset()
-		lobby.GameStarted = false
-		chat.HandleChatMessage(lobby.ID, gameMasterMessage, LobbyConnections)
+		text = fmt.Sprintf("%v Wins!!", result.Winner)
 	case "draw":
-		gameMasterMessage := map[string]interface{}{
-			"type":   "chat",
-			"sender": "GAMEMASTER",
-			"text":   "Its a Draw! Try Again!",
+		text = "Its a Draw! Try Again!"
+	case "timeout":
+		text = fmt.Sprintf("%v ran out of time, %v Wins!!", result.Symbol, result.Winner)
+	case "resign":
+		text = fmt.Sprintf("%v resigned, %v Wins!!", result.Symbol, result.Winner)
+	default:
+		return
+	}
+
+	// stats change for both players, show everyone the new totals. puzzle attempts
+	// count toward puzzle ratings instead
+	if currentLobby.Settings.Puzzle == 0 {
+		profile.RecordGame(currentLobby, result.Winner)
+		for _, p := range currentLobby.Players {
+			if !p.IsBot {
+				broadcastProfile(profile.For(p))
+			}
 		}
-		lobby.Game.Reset()
-		lobby.GameStarted = false
-		chat.HandleChatMessage(lobby.ID, gameMasterMessage, LobbyConnections)
+	}
+
+	// the finished game goes in the lobby history for exports
+	lobby.RecordGame(currentLobby, result)
+	currentLobby.Game.Reset()
+	currentLobby.GameStarted = false
+	announce(currentLobby, text)
+
+	if currentLobby.Settings.Puzzle != 0 {
+		announce(currentLobby, finishPuzzle(currentLobby, currentLobby.Games[len(currentLobby.Games)-1]))
+	}
+
+	// best-of-N lobbies keep score across games
+	if seriesText := lobby.RecordResult(currentLobby, result.Winner); seriesText != "" {
+		announce(currentLobby, seriesText)
+	}
+
+	if currentLobby.Settings.PostGameReview {
+		record := currentLobby.Games[len(currentLobby.Games)-1]
+		announce(currentLobby, strings.Join(lobby.ReviewText(record, lobby.Review(record)), " "))
 	}
 }
 
@@ -206,8 +372,12 @@ func storeLobbyState(lobbyID string, lobby *models.Lobby) {
 		return
 	}
 
-	// Store in Redis without expiration (manual deletion)
-	err = redisClient.Set("lobby:"+lobbyID, lobbyJSON, 0).Err()
+	// Store in Redis without expiration (manual deletion), except for puzzle lobbies
+	var ttl time.Duration
+	if lobby.Settings.Puzzle != 0 {
+		ttl = puzzleLobbyTTL
+	}
+	err = redisClient.Set("lobby:"+lobbyID, lobbyJSON, ttl).Err()
 	if err != nil {
 		log.Printf("Error storing lobby state in Redis: %v", err)
 	} else {
@@ -215,9 +385,85 @@ func storeLobbyState(lobbyID string, lobby *models.Lobby) {
 	}
 }
 
+// closeLobby removes a lobby from memory and Redis and disconnects everyone in it
+func closeLobby(currentLobby *models.Lobby) {
+	connectionsMu.Lock()
+	conns := LobbyConnections[currentLobby.ID]
+	delete(LobbyConnections, currentLobby.ID)
+	for _, conn := range conns {
+		delete(ConnectionPlayers, conn)
+	}
+	connectionsMu.Unlock()
+
+	for _, conn := range conns {
+		sendJSON(conn, map[string]interface{}{
+			"type": "lobbyClosed",
+			"text": "The host closed this lobby.",
+		})
+		conn.Close()
+	}
+	cancelBotTurn(currentLobby.ID)
+	stopTurnClock(currentLobby.ID)
+	lobby.Forget(currentLobby.ID)
+	for _, p := range currentLobby.Players {
+		if p.IsBot {
+			removeBot(currentLobby.ID, p.ID, "lobbyClosed", "The host closed this lobby.")
+		}
+	}
+
+	if err := redisClient.Del("lobby:" + currentLobby.ID).Err(); err != nil {
+		log.Printf("Error deleting lobby %s from Redis: %v", currentLobby.ID, err)
+	}
+	chat.Drop(currentLobby.ID)
+}
+
+// lobbyConnections returns a copy of the lobby's open connections, safe to range over
+func lobbyConnections(lobbyID string) []*websocket.Conn {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+	return append([]*websocket.Conn(nil), LobbyConnections[lobbyID]...)
+}
+
+// connectionSet is lobbyConnections in the shape the chat and lobby packages take
+func connectionSet(lobbyID string) map[string][]*websocket.Conn {
+	return map[string][]*websocket.Conn{lobbyID: lobbyConnections(lobbyID)}
+}
+
+// connectionPlayer is the player ID bound to a connection, "" before setUsername
+func connectionPlayer(ws *websocket.Conn) string {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+	return ConnectionPlayers[ws]
+}
+
+func bindConnection(ws *websocket.Conn, playerID string) {
+	connectionsMu.Lock()
+	ConnectionPlayers[ws] = playerID
+	connectionsMu.Unlock()
+}
+
+func unbindConnection(ws *websocket.Conn) {
+	connectionsMu.Lock()
+	delete(ConnectionPlayers, ws)
+	connectionsMu.Unlock()
+}
+
+// addConnection adds a new connection to the lobby
+func addConnection(lobbyID string, ws *websocket.Conn) {
+	// TODO! - Test if still needed,
+	// Remove stale connections before adding a new one
+	removeDuplicateConnection(lobbyID, ws)
+
+	connectionsMu.Lock()
+	LobbyConnections[lobbyID] = append(LobbyConnections[lobbyID], ws)
+	connectionsMu.Unlock()
+}
+
 // TODO - Investigate if still needed
 // remove duplicate conns
 func removeDuplicateConnection(lobbyID string, newConn *websocket.Conn) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
 	var activeConns []*websocket.Conn
 
 	for _, conn := range LobbyConnections[lobbyID] {
@@ -235,6 +481,8 @@ func removeDuplicateConnection(lobbyID string, newConn *websocket.Conn) {
 // TODO - Investigate if still needed
 // remove all conns (server shutdown)
 func removeConnection(lobbyID string, conn *websocket.Conn) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
 	var activeConns []*websocket.Conn
 
 	for _, c := range LobbyConnections[lobbyID] {
@@ -0,0 +1,531 @@
+// Package wsclient is a Go client for the tictacgo websocket protocol described in api/asyncapi.json.
+// it performs the /ws?lobby= handshake and setUsername, delivers server messages as typed
+// events on channels and reconnects when the connection drops. the player is the account
+// signed in with Config.AccessToken/TokenSource or Config.Session, get either from api/client.
+package wsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"tictacgo/api/client"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// events buffered per channel. once a game state channel is full the read loop waits
+// for it to be read, chat, hint and profile events are dropped instead
+const eventBuffer = 64
+
+// ErrClosed is returned when sending on a closed client
+var ErrClosed = errors.New("wsclient: client closed")
+
+// Config describes the lobby to connect to
+type Config struct {
+	ServerURL string // e.g. "http://localhost:8080"
+	LobbyID   string
+	Session   string // session cookie value, see client.Client.Session
+
+	// bearer token, used instead of Session when set. TokenSource is asked before
+	// every (re)connect so expired tokens get refreshed, e.g. client.Client.FreshAccessToken
+	AccessToken string
+	TokenSource func() (string, error)
+
+	Invite   string // invite token for private lobbies
+	Passcode string // passcode for private lobbies
+
+	NoReconnect bool          // give up when the connection drops instead of redialling
+	MaxBackoff  time.Duration // longest wait between reconnect attempts, defaults to 30s
+}
+
+// InitialState is sent by the server on every (re)connect
+type InitialState struct {
+	Settings     client.LobbySettings `json:"settings"`
+	Clock        map[string]int       `json:"clock"`
+	GameBoard    [9]string            `json:"gameBoard"`
+	CurrentTurn  string               `json:"currentTurn"`
+	GameStarted  bool                 `json:"gameStarted"`
+	ChatMessages []client.ChatMessage `json:"chatMessages"` // only the newest, see Client.RequestChatHistory
+	ChatHasMore  bool                 `json:"chatHasMore"`
+	ReadyPlayers map[string]bool      `json:"readyPlayers"`
+	Players      []LobbyPlayer        `json:"players"`
+	Spectators   []LobbyPlayer        `json:"spectators"`
+
+	Profiles       map[string]client.Profile `json:"profiles"`       // keyed by player ID
+	Reactions      []string                  `json:"reactions"`      // emoji chat messages can be reacted with
+	ChatEditWindow int                       `json:"chatEditWindow"` // seconds a message stays editable
+}
+
+// LobbyPlayer is a player as listed in InitialState
+type LobbyPlayer struct {
+	ID     string
+	Name   string
+	Symbol string
+	Ready  bool
+}
+
+// AssignPlayer tells the client who it plays as, re-sent when its seat or host status changes
+type AssignPlayer struct {
+	Username string `json:"username"`
+	Symbol   string `json:"symbol"`
+	ID       string `json:"id"`
+	IsHost   bool   `json:"isHost"`
+	Role     string `json:"role"`
+	CanReady bool   `json:"canReady"`
+
+	Profile client.Profile `json:"profile"`
+}
+
+// ProfileUpdate is sent when a player joins or changes their profile
+type ProfileUpdate struct {
+	Profile client.Profile `json:"profile"`
+	Symbol  string         `json:"symbol,omitempty"` // set when the player just joined, "S" for spectators
+}
+
+// Move is the result of a move played by either player
+type Move = client.GameMessage
+
+// Chat is a new message posted to the lobby, or a command reply only this client sees
+type Chat struct {
+	Message client.ChatMessage `json:"message"`
+	Private bool               `json:"private"` // command replies have no ID and aren't in the history
+}
+
+// ChatUpdate carries a message that was edited, deleted (a tombstone) or reacted to,
+// replace the one with the same ID
+type ChatUpdate struct {
+	Message client.ChatMessage `json:"message"`
+}
+
+// ChatHistory answers RequestChatHistory with older messages, oldest first
+type ChatHistory struct {
+	Channel  string               `json:"channel"`
+	Messages []client.ChatMessage `json:"messages"`
+	HasMore  bool                 `json:"hasMore"`
+}
+
+// StartGame is sent when both players are ready
+type StartGame struct {
+	CurrentTurn string    `json:"currentTurn"`
+	Board       [9]string `json:"board"` // the start position, empty cells unless the lobby has one
+}
+
+// Hint answers RequestHint with the solver's move for this player
+type Hint struct {
+	Position  int    `json:"position"`
+	Square    string `json:"square"`
+	Outcome   string `json:"outcome"` // "win", "draw" or "loss" for this player under perfect play
+	Moves     int    `json:"moves"`   // until the game ends, both sides counted
+	HintsLeft int    `json:"hintsLeft"`
+}
+
+// Notice covers the remaining server messages: error, chatRejected, seatOpen, lobbyFull, kicked, banned and lobbyClosed
+type Notice struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Symbol string `json:"symbol,omitempty"`
+	Reason string `json:"reason,omitempty"` // why a chat message or edit was rejected: empty, too_long, muted, rate_limited, not_allowed or no_recipient
+}
+
+// Client is a connection to one lobby. read the channels for the events you need,
+// every channel is closed once the client stops for good. InitialStates, Assignments,
+// Moves, GameStarts and Notices carry the game state and are never dropped, so keep
+// reading them: nothing else is received while one of them is full
+type Client struct {
+	InitialStates chan InitialState
+	Assignments   chan AssignPlayer
+	Moves         chan Move
+	Chats         chan Chat
+	ChatUpdates   chan ChatUpdate
+	ChatHistory   chan ChatHistory
+	GameStarts    chan StartGame
+	Hints         chan Hint
+	Profiles      chan ProfileUpdate
+	Notices       chan Notice
+
+	cfg     Config
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	self    AssignPlayer
+	closed  bool
+	closing chan struct{} // closed by Close, stops the read loop waiting on a full channel
+	done    chan struct{}
+}
+
+// Dial connects to the lobby and sends setUsername
+func Dial(cfg Config) (*Client, error) {
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	c := &Client{
+		InitialStates: make(chan InitialState, eventBuffer),
+		Assignments:   make(chan AssignPlayer, eventBuffer),
+		Moves:         make(chan Move, eventBuffer),
+		Chats:         make(chan Chat, eventBuffer),
+		ChatUpdates:   make(chan ChatUpdate, eventBuffer),
+		ChatHistory:   make(chan ChatHistory, eventBuffer),
+		GameStarts:    make(chan StartGame, eventBuffer),
+		Hints:         make(chan Hint, eventBuffer),
+		Profiles:      make(chan ProfileUpdate, eventBuffer),
+		Notices:       make(chan Notice, eventBuffer),
+		cfg:           cfg,
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	go c.run()
+	return c, nil
+}
+
+// Self returns the latest assignment, ID is empty until the server has answered setUsername
+func (c *Client) Self() AssignPlayer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.self
+}
+
+// Done is closed when the client stops for good
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Move plays a position (0-8)
+func (c *Client) Move(position int) error {
+	return c.Send(map[string]interface{}{"type": "move", "position": position})
+}
+
+// Chat posts a chat message
+func (c *Client) Chat(text string) error {
+	return c.Send(map[string]interface{}{"type": "chat", "sender": c.Self().Username, "text": text})
+}
+
+// ChatOn posts a chat message to a channel: "all", "players" (seated players only) or
+// "spectators" (spectators only)
+func (c *Client) ChatOn(channel string, text string) error {
+	return c.Send(map[string]interface{}{"type": "chat", "channel": channel, "text": text})
+}
+
+// Whisper sends a message only the player with ID playerID (and this client) sees
+func (c *Client) Whisper(playerID string, text string) error {
+	return c.Send(map[string]interface{}{"type": "chat", "channel": "whisper", "to": playerID, "text": text})
+}
+
+// EditChat replaces the text of one of this player's messages, allowed for a few minutes after posting
+func (c *Client) EditChat(id int, text string) error {
+	return c.Send(map[string]interface{}{"type": "chatEdit", "id": id, "text": text})
+}
+
+// DeleteChat deletes one of this player's messages, or anyone's when the player is the host
+func (c *Client) DeleteChat(id int) error {
+	return c.Send(map[string]interface{}{"type": "chatDelete", "id": id})
+}
+
+// ReactChat adds this player's reaction to a message, or takes it back when it is already there
+func (c *Client) ReactChat(id int, emoji string) error {
+	return c.Send(map[string]interface{}{"type": "chatReact", "id": id, "emoji": emoji})
+}
+
+// RequestChatHistory asks for up to limit messages older than the message with ID before,
+// the answer arrives on ChatHistory. limit 0 takes the server's page size
+func (c *Client) RequestChatHistory(before int, limit int) error {
+	return c.RequestChannelHistory("all", before, limit)
+}
+
+// RequestChannelHistory is RequestChatHistory for one channel, see ChatOn. "whisper" pages
+// through this player's whispers
+func (c *Client) RequestChannelHistory(channel string, before int, limit int) error {
+	return c.Send(map[string]interface{}{"type": "chatHistory", "channel": channel, "before": before, "limit": limit})
+}
+
+// Ready readies (or un-readies) the player
+func (c *Client) Ready(ready bool) error {
+	return c.Send(map[string]interface{}{"type": "ready", "ready": ready, "username": c.Self().Username})
+}
+
+// RequestHint asks for the best move when it is this player's turn, the answer arrives on
+// Hints (or an error on Notices). only lobbies with hintsPerGame give hints
+func (c *Client) RequestHint() error {
+	return c.Send(map[string]interface{}{"type": "hint"})
+}
+
+// Mute stops a player chatting for duration (the server default when 0), host or admin only
+func (c *Client) Mute(playerID string, duration time.Duration) error {
+	return c.Send(map[string]interface{}{"type": "mute", "targetId": playerID, "duration": int(duration.Seconds())})
+}
+
+// Unmute lets a muted player chat again, host or admin only
+func (c *Client) Unmute(playerID string) error {
+	return c.Send(map[string]interface{}{"type": "unmute", "targetId": playerID})
+}
+
+// TakeSeat asks to move from spectating into an empty seat
+func (c *Client) TakeSeat() error {
+	return c.Send(map[string]interface{}{"type": "takeSeat"})
+}
+
+// LeaveSeat gives up the player's seat
+func (c *Client) LeaveSeat() error {
+	return c.Send(map[string]interface{}{"type": "leaveSeat"})
+}
+
+// Send writes any protocol message, for messages without a helper
+func (c *Client) Send(msg interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if c.conn == nil {
+		return errors.New("wsclient: not connected")
+	}
+	return websocket.JSON.Send(c.conn, msg)
+}
+
+// Close disconnects and stops reconnecting
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.closing)
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// builds the websocket URL from the server URL
+func (c *Client) wsURL() (string, string, error) {
+	u, err := url.Parse(strings.TrimRight(c.cfg.ServerURL, "/"))
+	if err != nil {
+		return "", "", err
+	}
+	origin := u.String()
+
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path += "/ws"
+
+	query := url.Values{"lobby": {c.cfg.LobbyID}}
+	if c.cfg.Invite != "" {
+		query.Set("invite", c.cfg.Invite)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), origin, nil
+}
+
+// dials with the session cookie and performs setUsername, the server rejoins the same player after a reconnect
+func (c *Client) connect() error {
+	wsURL, origin, err := c.wsURL()
+	if err != nil {
+		return err
+	}
+	config, err := websocket.NewConfig(wsURL, origin)
+	if err != nil {
+		return err
+	}
+	token := c.cfg.AccessToken
+	if c.cfg.TokenSource != nil {
+		if token, err = c.cfg.TokenSource(); err != nil {
+			return fmt.Errorf("wsclient: access token: %w", err)
+		}
+	}
+	if token != "" {
+		config.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		config.Header.Set("Cookie", (&http.Cookie{Name: "session", Value: c.cfg.Session}).String())
+	}
+	if c.cfg.Passcode != "" {
+		config.Header.Set("X-Lobby-Passcode", c.cfg.Passcode)
+	}
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return fmt.Errorf("wsclient: dial %s: %w", wsURL, err)
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+	err = websocket.JSON.Send(conn, map[string]interface{}{"type": "setUsername"})
+	c.mu.Unlock()
+
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("wsclient: setUsername: %w", err)
+	}
+	return nil
+}
+
+// run reads until the connection drops, then reconnects with backoff
+func (c *Client) run() {
+	defer c.shutdown()
+
+	backoff := time.Second
+	for {
+		stop := c.readLoop()
+
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if stop || closed || c.cfg.NoReconnect {
+			return
+		}
+
+		for {
+			time.Sleep(backoff)
+			backoff = min(backoff*2, c.cfg.MaxBackoff)
+
+			err := c.connect()
+			if err == nil {
+				backoff = time.Second
+				break
+			}
+			if errors.Is(err, ErrClosed) {
+				return
+			}
+			log.Printf("wsclient: reconnect failed: %v", err)
+		}
+	}
+}
+
+// readLoop dispatches messages, returns true when the server ended the session for good
+func (c *Client) readLoop() bool {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	for {
+		var raw json.RawMessage
+		if err := websocket.JSON.Receive(conn, &raw); err != nil {
+			return false
+		}
+		if c.dispatch(raw) {
+			return true
+		}
+	}
+}
+
+// dispatch decodes one message onto its channel, returns true for messages ending the session
+func (c *Client) dispatch(raw json.RawMessage) bool {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return false
+	}
+
+	switch head.Type {
+	case "initialState":
+		var ev InitialState
+		if json.Unmarshal(raw, &ev) == nil {
+			deliver(c.InitialStates, ev, c.closing)
+		}
+	case "assignPlayer":
+		var ev AssignPlayer
+		if json.Unmarshal(raw, &ev) == nil {
+			c.mu.Lock()
+			c.self = ev
+			c.mu.Unlock()
+			deliver(c.Assignments, ev, c.closing)
+		}
+	case "move":
+		var ev Move
+		if json.Unmarshal(raw, &ev) == nil {
+			deliver(c.Moves, ev, c.closing)
+		}
+	case "chat":
+		var ev Chat
+		if json.Unmarshal(raw, &ev) == nil {
+			offer(c.Chats, ev)
+		}
+	case "chatUpdate":
+		var ev ChatUpdate
+		if json.Unmarshal(raw, &ev) == nil {
+			offer(c.ChatUpdates, ev)
+		}
+	case "chatHistory":
+		var ev ChatHistory
+		if json.Unmarshal(raw, &ev) == nil {
+			offer(c.ChatHistory, ev)
+		}
+	case "startGame":
+		var ev StartGame
+		if json.Unmarshal(raw, &ev) == nil {
+			deliver(c.GameStarts, ev, c.closing)
+		}
+	case "hint":
+		var ev Hint
+		if json.Unmarshal(raw, &ev) == nil {
+			offer(c.Hints, ev)
+		}
+	case "profile":
+		var ev ProfileUpdate
+		if json.Unmarshal(raw, &ev) == nil {
+			offer(c.Profiles, ev)
+		}
+	default:
+		var ev Notice
+		if json.Unmarshal(raw, &ev) == nil {
+			deliver(c.Notices, ev, c.closing)
+		}
+		switch head.Type {
+		case "kicked", "banned", "lobbyClosed", "lobbyFull":
+			return true
+		}
+	}
+	return false
+}
+
+// deliver hands over a game state event, waiting for the channel to be read.
+// missing one would leave the caller with a wrong board, so it is only given up on close
+func deliver[T any](ch chan T, ev T, closing <-chan struct{}) {
+	select {
+	case ch <- ev:
+	case <-closing:
+	}
+}
+
+// offer delivers an event without blocking the read loop
+func offer[T any](ch chan T, ev T) {
+	select {
+	case ch <- ev:
+	default:
+		log.Printf("wsclient: dropping %T event, channel full", ev)
+	}
+}
+
+// closes the connection and every event channel
+func (c *Client) shutdown() {
+	c.Close()
+	close(c.InitialStates)
+	close(c.Assignments)
+	close(c.Moves)
+	close(c.Chats)
+	close(c.ChatUpdates)
+	close(c.ChatHistory)
+	close(c.GameStarts)
+	close(c.Hints)
+	close(c.Profiles)
+	close(c.Notices)
+	close(c.done)
+}
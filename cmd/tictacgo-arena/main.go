@@ -0,0 +1,63 @@
+// tictacgo-arena plays two engines against each other offline and reports how the
+// first one did, for checking that an engine change didn't make it weaker.
+//
+//	go run ./cmd/tictacgo-arena -a minimax -b random -n 1000
+//	go run ./cmd/tictacgo-arena -a minimax -b minimax -variant misere
+//
+// exits with status 1 when -min-score is set and A's score falls below it
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+	"time"
+)
+
+func main() {
+	nameA := flag.String("a", "minimax", "engine under test: random, minimax or solver")
+	nameB := flag.String("b", "random", "opponent engine: random, minimax or solver")
+	games := flag.Int("n", 1000, "number of games, A plays X in every other game")
+	variant := flag.String("variant", game.VariantClassic, "rule set: classic or misere")
+	minScore := flag.Float64("min-score", 0, "fail when A scores less than this (0-1)")
+	flag.Parse()
+
+	a, b := bot.New(*nameA), bot.New(*nameB)
+	if a == nil || b == nil {
+		fmt.Fprintln(os.Stderr, "engines must be random, minimax or solver")
+		os.Exit(2)
+	}
+	if *variant != game.VariantClassic && *variant != game.VariantMisere {
+		fmt.Fprintf(os.Stderr, "unknown variant %q\n", *variant)
+		os.Exit(2)
+	}
+	if *games < 1 {
+		fmt.Fprintln(os.Stderr, "-n must be at least 1")
+		os.Exit(2)
+	}
+
+	start := time.Now()
+	stats := bot.Match(a, b, *games, *variant)
+	elapsed := time.Since(start)
+
+	low, high := stats.ScoreInterval()
+	fmt.Printf("%s (A) vs %s (B), %s, %d games in %v\n\n", a.Name(), b.Name(), *variant, stats.Games, elapsed.Round(time.Millisecond))
+	fmt.Printf("           wins  draws  losses\n")
+	fmt.Printf("  total  %6d %6d %7d\n", stats.Wins, stats.Draws, stats.Losses)
+	fmt.Printf("  as X   %6d %6s %7d\n", stats.WinsAsX, "", stats.LossesAsX)
+	fmt.Printf("  as O   %6d %6s %7d\n\n", stats.WinsAsO, "", stats.LossesAsO)
+	fmt.Printf("  average game length  %.2f moves\n", stats.AverageLength())
+	fmt.Printf("  score                %.3f (95%% CI %.3f - %.3f)\n", stats.Score(), low, high)
+	fmt.Printf("  elo difference       %+.0f (95%% CI %+.0f - %+.0f)\n", bot.Elo(stats.Score()), bot.Elo(low), bot.Elo(high))
+	fmt.Printf("  likelihood A better  %.1f%%\n", 100*stats.LOS())
+	if stats.Forfeits > 0 {
+		fmt.Printf("  illegal moves        %d games forfeited\n", stats.Forfeits)
+	}
+
+	if *minScore > 0 && stats.Score() < *minScore {
+		fmt.Printf("\nFAIL: score %.3f is below %.3f\n", stats.Score(), *minScore)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,115 @@
+// tictacgo-bot is a sample bot for the bot API (docs/BOTS.md). it registers itself,
+// waits on /bot for the host of a lobby to seat it and answers every yourTurn with a move.
+//
+//	go run ./cmd/tictacgo-bot -name randy -engine random
+//	go run ./cmd/tictacgo-bot -name minnie -engine minimax -token <token from an earlier run>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"tictacgo/api/client"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+
+	"golang.org/x/net/websocket"
+)
+
+// messages the server sends to bots
+type serverMessage struct {
+	Type            string    `json:"type"`
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	LobbyID         string    `json:"lobbyId"`
+	LobbyName       string    `json:"lobbyName"`
+	Symbol          string    `json:"symbol"`
+	Board           [9]string `json:"board"`
+	Variant         string    `json:"variant"`
+	TimeRemainingMs int64     `json:"timeRemainingMs"`
+	DeadlineMs      int64     `json:"deadlineMs"`
+	Result          string    `json:"result"`
+	Winner          string    `json:"winner"`
+	Text            string    `json:"text"`
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "server URL")
+	name := flag.String("name", "bot", "bot name shown in lobbies")
+	engineName := flag.String("engine", "minimax", "move engine: random, minimax or solver")
+	token := flag.String("token", "", "token from an earlier registration, registers a new bot when empty")
+	flag.Parse()
+
+	engine := bot.New(*engineName)
+	if engine == nil {
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engineName)
+		os.Exit(1)
+	}
+
+	if *token == "" {
+		reg, err := client.New(*server).RegisterBot(*name)
+		if err != nil {
+			log.Fatalf("registering bot: %v", err)
+		}
+		*token = reg.Token
+		log.Printf("registered %s (%s), reuse it with -token %s", reg.Name, reg.ID, reg.Token)
+	}
+
+	conn, err := dial(*server, *token)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	for {
+		var msg serverMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			log.Fatalf("connection closed: %v", err)
+		}
+
+		switch msg.Type {
+		case "hello":
+			log.Printf("connected as %s (%s), waiting to be seated", msg.Name, msg.ID)
+		case "seated":
+			log.Printf("seated as %s in %q (%s)", msg.Symbol, msg.LobbyName, msg.LobbyID)
+		case "yourTurn":
+			g := &game.Game{Board: msg.Board, Variant: msg.Variant}
+			position := engine.Move(g, msg.Symbol)
+			err := websocket.JSON.Send(conn, map[string]interface{}{
+				"type":     "move",
+				"lobbyId":  msg.LobbyID,
+				"position": position,
+			})
+			if err != nil {
+				log.Fatalf("sending move: %v", err)
+			}
+		case "gameOver":
+			log.Printf("game over in %s: %s", msg.LobbyID, msg.Text)
+		case "kicked", "banned", "lobbyClosed":
+			log.Printf("left %s: %s", msg.LobbyID, msg.Text)
+		case "timeout", "error":
+			log.Printf("%s: %s", msg.Type, msg.Text)
+		}
+	}
+}
+
+// dial opens the bot websocket
+func dial(server string, token string) (*websocket.Conn, error) {
+	u, err := url.Parse(strings.TrimRight(server, "/"))
+	if err != nil {
+		return nil, err
+	}
+	origin := u.String()
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path += "/bot"
+	u.RawQuery = url.Values{"token": {token}}.Encode()
+
+	return websocket.Dial(u.String(), "", origin)
+}
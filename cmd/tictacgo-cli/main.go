@@ -0,0 +1,251 @@
+// tictacgo-cli plays tictacgo from a terminal over the same /ws protocol as the browser.
+//
+//	go run ./cmd/tictacgo-cli -name alice            # pick a lobby from the list as a guest
+//	go run ./cmd/tictacgo-cli -name alice -create    # create a lobby and join it
+//	go run ./cmd/tictacgo-cli -name bob -lobby <id>  # join a lobby directly
+//	go run ./cmd/tictacgo-cli -user carol            # sign in to an account, asks for the password
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"tictacgo/api/client"
+	"tictacgo/api/wsclient"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "server URL")
+	name := flag.String("name", "", "guest name (letters and numbers, up to 15)")
+	user := flag.String("user", "", "account username, plays as a guest when empty")
+	password := flag.String("password", "", "account password, asked for when -user is set")
+	register := flag.Bool("register", false, "create the -user account first")
+	lobbyID := flag.String("lobby", "", "lobby ID to join, skips the lobby list")
+	create := flag.Bool("create", false, "create a new lobby instead of joining one")
+	invite := flag.String("invite", "", "invite token for a private lobby")
+	passcode := flag.String("passcode", "", "passcode for a private lobby")
+	flag.Parse()
+
+	input := bufio.NewScanner(os.Stdin)
+
+	api := client.New(*server)
+	account, err := signIn(api, input, *name, *user, *password, *register)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not sign in:", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *lobbyID != "":
+	case *create:
+		*lobbyID = createLobby(api)
+	default:
+		*lobbyID = chooseLobby(api, input)
+	}
+	fmt.Println("Playing as", account.Name)
+
+	ws, err := wsclient.Dial(wsclient.Config{
+		ServerURL: *server,
+		LobbyID:   *lobbyID,
+		Session:   api.Session(),
+		Invite:    *invite,
+		Passcode:  *passcode,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer ws.Close()
+
+	play(ws, input)
+}
+
+// prompt prints a question and reads one line
+func prompt(input *bufio.Scanner, question string) string {
+	fmt.Print(question)
+	if !input.Scan() {
+		os.Exit(0)
+	}
+	return strings.TrimSpace(input.Text())
+}
+
+// signIn logs in to an account when a username is given and starts a guest session otherwise
+func signIn(api *client.Client, input *bufio.Scanner, name, user, password string, register bool) (*client.Account, error) {
+	if user == "" {
+		if name == "" {
+			name = prompt(input, "Guest name (empty for a random one): ")
+		}
+		return api.Guest(name)
+	}
+
+	// note the password is echoed, pass -password to avoid typing it
+	if password == "" {
+		password = prompt(input, "Password: ")
+	}
+	if register {
+		return api.Register(user, password)
+	}
+	return api.Login(user, password)
+}
+
+func createLobby(api *client.Client) string {
+	l, err := api.CreateLobbyForm(client.CreateLobbyRequest{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not create lobby:", err)
+		os.Exit(1)
+	}
+	return l.ID
+}
+
+// chooseLobby lists public lobbies until the user picks one or creates their own
+func chooseLobby(api *client.Client, input *bufio.Scanner) string {
+	for {
+		lobbies, err := api.ListLobbies()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not list lobbies:", err)
+		}
+
+		fmt.Println()
+		fmt.Println("Open lobbies:")
+		if len(lobbies) == 0 {
+			fmt.Println("  (none)")
+		}
+		for i, l := range lobbies {
+			var names []string
+			for _, p := range l.Players {
+				names = append(names, p.Name)
+			}
+			fmt.Printf("  %d) %s (%s/%d)\n", i+1, l.Name, strings.Join(names, ", "), l.MaxPlayers)
+		}
+
+		choice := prompt(input, "Number to join, c to create, r to refresh, q to quit: ")
+		switch choice {
+		case "c":
+			return createLobby(api)
+		case "q":
+			os.Exit(0)
+		case "r", "":
+			continue
+		}
+		if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(lobbies) {
+			return lobbies[n-1].ID
+		}
+		fmt.Println("Unknown choice", choice)
+	}
+}
+
+// play runs the game screen until the user quits or the server ends the session
+func play(ws *wsclient.Client, input *bufio.Scanner) {
+	lines := make(chan string)
+	go func() {
+		for input.Scan() {
+			lines <- strings.TrimSpace(input.Text())
+		}
+		close(lines)
+	}()
+
+	s := newScreen()
+	s.render()
+
+	for {
+		// every event channel closes when the session ends for good
+		open := true
+		select {
+		case ev, ok := <-ws.InitialStates:
+			open = ok
+			s.applyInitialState(ev)
+		case ev, ok := <-ws.Assignments:
+			open = ok
+			s.self = ev
+		case ev, ok := <-ws.Moves:
+			open = ok
+			s.applyMove(ev)
+		case ev, ok := <-ws.Chats:
+			open = ok
+			s.addChat(ev.Message)
+		case ev, ok := <-ws.ChatUpdates:
+			open = ok
+			s.updateChat(ev.Message)
+		case ev, ok := <-ws.Profiles:
+			open = ok
+			if ev.Profile.PlayerID == s.self.ID {
+				s.self.Profile = ev.Profile
+			}
+		case ev, ok := <-ws.GameStarts:
+			open = ok
+			s.started = true
+			s.turn = ev.CurrentTurn
+			s.board = ev.Board
+			s.status = "Game on!"
+		case ev, ok := <-ws.Hints:
+			open = ok
+			s.status = fmt.Sprintf("Hint: play %d (%s), it %s. %d hints left this game.", ev.Position+1, ev.Square, outcomeText(ev.Outcome, ev.Moves), ev.HintsLeft)
+		case ev, ok := <-ws.Notices:
+			open = ok
+			s.status = ev.Text
+		case line, ok := <-lines:
+			if !ok || line == "q" {
+				return
+			}
+			s.status = handleInput(ws, s, line)
+		}
+
+		if !open {
+			fmt.Println()
+			fmt.Println("Session ended:", s.status)
+			return
+		}
+		s.render()
+	}
+}
+
+// outcomeText reads a hint's outcome out, e.g. "wins in 3"
+func outcomeText(outcome string, moves int) string {
+	switch outcome {
+	case "win":
+		return fmt.Sprintf("wins in %d", moves)
+	case "loss":
+		return fmt.Sprintf("loses in %d", moves)
+	}
+	return "draws"
+}
+
+// handleInput turns a typed line into a protocol message, returns the new status line
+func handleInput(ws *wsclient.Client, s *screen, line string) string {
+	if line == "" {
+		return s.status
+	}
+
+	// cells are numbered 1-9 like a phone keypad, the server counts 0-8
+	if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= 9 {
+		if err := ws.Move(n - 1); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	var err error
+	switch line {
+	case "r":
+		s.ready = !s.ready
+		err = ws.Ready(s.ready)
+		if err == nil && s.ready {
+			return "Ready, waiting for the other player."
+		}
+	case "s":
+		err = ws.TakeSeat()
+	case "l":
+		err = ws.LeaveSeat()
+	case "h":
+		err = ws.RequestHint()
+	default:
+		err = ws.Chat(line)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
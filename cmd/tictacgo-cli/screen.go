@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tictacgo/api/client"
+	"tictacgo/api/wsclient"
+)
+
+// chat lines shown under the board
+const chatLines = 10
+
+// screen holds what the terminal shows and redraws it from scratch on every event
+type screen struct {
+	board   [9]string
+	turn    string
+	started bool
+	ready   bool
+	self    wsclient.AssignPlayer
+	chat    []client.ChatMessage
+	status  string
+}
+
+func newScreen() *screen {
+	return &screen{turn: "X", status: "Connecting..."}
+}
+
+func (s *screen) applyInitialState(ev wsclient.InitialState) {
+	s.board = ev.GameBoard
+	s.turn = ev.CurrentTurn
+	s.started = ev.GameStarted
+	s.chat = ev.ChatMessages
+	s.status = ""
+}
+
+// addChat appends a new message, keeping only what fits on screen
+func (s *screen) addChat(m client.ChatMessage) {
+	s.chat = append(s.chat, m)
+	if len(s.chat) > chatLines {
+		s.chat = s.chat[len(s.chat)-chatLines:]
+	}
+}
+
+// channelLabel marks messages that not everyone in the lobby sees
+func channelLabel(m client.ChatMessage, selfID string) string {
+	switch m.Channel {
+	case "whisper":
+		if m.To == selfID {
+			return " whisper"
+		}
+		return " to " + m.ToName
+	case "players", "spectators":
+		return " " + m.Channel
+	}
+	return ""
+}
+
+// updateChat swaps in an edited, deleted or reacted to message if it is still on screen
+func (s *screen) updateChat(m client.ChatMessage) {
+	for i := range s.chat {
+		if s.chat[i].ID == m.ID {
+			s.chat[i] = m
+		}
+	}
+}
+
+// chatText is what is shown of a message after the sender, with edits and reactions marked
+func chatText(m client.ChatMessage) string {
+	if m.Deleted {
+		return "[deleted]"
+	}
+	text := m.Text
+	if m.EditedAt != nil {
+		text += " (edited)"
+	}
+	emoji := make([]string, 0, len(m.Reactions))
+	for e := range m.Reactions {
+		emoji = append(emoji, e)
+	}
+	sort.Strings(emoji)
+	for _, e := range emoji {
+		text += fmt.Sprintf(" %s%d", e, len(m.Reactions[e]))
+	}
+	return text
+}
+
+func (s *screen) applyMove(ev wsclient.Move) {
+	if ev.Position >= 0 && ev.Position < 9 {
+		s.board[ev.Position] = ev.Symbol
+	}
+
+	switch ev.Next {
+	case "updateTurn":
+		s.turn = ev.Text
+	case "win", "draw", "timeout", "resign":
+		// the server resets the board, ready up again for the next game
+		s.board = [9]string{}
+		s.started = false
+		s.ready = false
+		s.status = ev.Text + " Press r to ready up for the next game."
+	}
+}
+
+func (s *screen) render() {
+	var b strings.Builder
+
+	// clear the terminal and move the cursor home
+	b.WriteString("\033[H\033[2J")
+	b.WriteString("tictacgo\n\n")
+
+	switch {
+	case s.self.ID == "":
+		b.WriteString("Joining...\n")
+	case s.self.Role == "spectator":
+		fmt.Fprintf(&b, "Spectating as %s\n", s.self.Username)
+	default:
+		fmt.Fprintf(&b, "Playing as %s (%s)", s.self.Username, s.self.Symbol)
+		if s.self.IsHost {
+			b.WriteString(" [host]")
+		}
+		b.WriteString("\n")
+	}
+	if stats := s.self.Profile.Stats; stats.Played > 0 {
+		fmt.Fprintf(&b, "Record: %d won, %d lost, %d drawn\n", stats.Wins, stats.Losses, stats.Draws)
+	}
+
+	if s.started {
+		fmt.Fprintf(&b, "%s to move\n\n", s.turn)
+	} else {
+		b.WriteString("Waiting for both players to ready up\n\n")
+	}
+
+	for row := 0; row < 3; row++ {
+		b.WriteString(" ")
+		for col := 0; col < 3; col++ {
+			i := row*3 + col
+			cell := s.board[i]
+			if cell == "" {
+				cell = fmt.Sprint(i + 1)
+			}
+			b.WriteString(" " + cell + " ")
+			if col < 2 {
+				b.WriteString("|")
+			}
+		}
+		b.WriteString("\n")
+		if row < 2 {
+			b.WriteString(" ---+---+---\n")
+		}
+	}
+
+	b.WriteString("\nChat:\n")
+	start := max(len(s.chat)-chatLines, 0)
+	for _, m := range s.chat[start:] {
+		stamp := m.Timestamp.Local().Format("15:04:05") + channelLabel(m, s.self.ID)
+		if m.Emote {
+			fmt.Fprintf(&b, "  [%s] * %s %s\n", stamp, m.Sender, chatText(m))
+			continue
+		}
+		fmt.Fprintf(&b, "  [%s] %s: %s\n", stamp, m.Sender, chatText(m))
+	}
+
+	if s.status != "" {
+		fmt.Fprintf(&b, "\n%s\n", s.status)
+	}
+	b.WriteString("\n1-9 move, r ready, h hint, s take seat, l leave seat, q quit, anything else chats\n> ")
+
+	fmt.Print(b.String())
+}
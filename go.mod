@@ -7,5 +7,6 @@ require github.com/gorilla/websocket v1.5.3
 require (
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/google/uuid v1.6.0
-	golang.org/x/net v0.32.0 // indirect
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.32.0
 )
@@ -0,0 +1,311 @@
+// Package auth manages player accounts and the sessions that identify them.
+// every player is an account, guests get one without a password and can
+// upgrade it later, keeping the same ID
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"tictacgo/models"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var redisClient = redis.NewClient(&redis.Options{
+	Addr: os.Getenv("REDIS_ADDRESS"), // Use environment variable
+})
+
+// passwords shorter than this are refused, bcrypt ignores anything past 72 bytes
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// how long Redis keeps a guest account that is never upgraded
+const guestTTL = 30 * 24 * time.Hour
+
+// same rule the home page has always used for names
+var validName = regexp.MustCompile(`^[a-zA-Z0-9]{1,15}$`)
+
+// names nobody can take, compared ignoring case. GAMEMASTER signs the system messages in chat
+var reservedNames = map[string]bool{
+	"gamemaster": true,
+}
+
+// checkName is the rule for every name an account is shown as
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return ErrInvalidName
+	}
+	if reservedNames[strings.ToLower(name)] {
+		return ErrReservedName
+	}
+	return nil
+}
+
+// errors are safe to show to the client
+var (
+	ErrInvalidName        = errors.New("names must be 1-15 letters or numbers")
+	ErrWeakPassword       = fmt.Errorf("passwords must be %d-%d characters", minPasswordLength, maxPasswordLength)
+	ErrUsernameTaken      = errors.New("that username is already taken")
+	ErrInvalidCredentials = errors.New("wrong username or password")
+	ErrNotGuest           = errors.New("this account is already registered")
+	ErrNameTaken          = errors.New("that name is already taken")
+	ErrReservedName       = errors.New("that name is reserved")
+)
+
+// held from checking a name is free until the account claiming it is saved,
+// so two requests can't both take the same name
+var claimMu sync.Mutex
+
+// Register creates an account with a username and password
+func Register(username string, password string) (*models.Account, error) {
+	account := &models.Account{
+		ID:      uuid.New().String(),
+		Created: time.Now(),
+	}
+	if err := setCredentials(account, username, password); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// NewGuest creates a passwordless account shown as name, a name is made up when empty
+func NewGuest(name string) (*models.Account, error) {
+	id := uuid.New().String()
+	if name == "" {
+		// made from the ID so they don't run out, collisions are as rare as the IDs'
+		name = "Guest" + strings.ReplaceAll(id, "-", "")[:10]
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	if NameTaken(name, "") {
+		return nil, ErrNameTaken
+	}
+
+	account := &models.Account{
+		ID:      id,
+		Name:    name,
+		Guest:   true,
+		Created: time.Now(),
+	}
+	save(account)
+	return account, nil
+}
+
+// Upgrade turns a guest into a registered account, their ID (and so their seats) stay the same
+func Upgrade(account *models.Account, username string, password string) error {
+	if !account.Guest {
+		return ErrNotGuest
+	}
+	return setCredentials(account, username, password)
+}
+
+// setCredentials checks and stores a username and password, shared by Register and Upgrade
+func setCredentials(account *models.Account, username string, password string) error {
+	if err := checkName(username); err != nil {
+		return err
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	// the username becomes the display name, so it can't be someone else's either
+	if FindByUsername(username) != nil || NameTaken(username, account.ID) {
+		return ErrUsernameTaken
+	}
+
+	dropNameKey(account)
+	models.AccountsMu.Lock()
+	account.Username = username
+	account.Name = username
+	account.PasswordHash = string(hash)
+	account.Guest = false
+	models.AccountsMu.Unlock()
+	save(account)
+	return nil
+}
+
+// Rename changes the name an account is shown as, names are unique ignoring case
+func Rename(account *models.Account, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	if NameTaken(name, account.ID) {
+		return ErrNameTaken
+	}
+	dropNameKey(account)
+	models.AccountsMu.Lock()
+	account.Name = name
+	models.AccountsMu.Unlock()
+	save(account)
+	return nil
+}
+
+// NameTaken reports whether an account other than exceptID is shown as name
+func NameTaken(name string, exceptID string) bool {
+	models.AccountsMu.RLock()
+	for _, account := range models.Accounts {
+		if account.ID != exceptID && strings.EqualFold(account.Name, name) {
+			models.AccountsMu.RUnlock()
+			return true
+		}
+	}
+	models.AccountsMu.RUnlock()
+
+	id, err := redisClient.Get(nameKey(name)).Result()
+	if err != nil || id == exceptID {
+		return false
+	}
+	// the key can outlive a rename, check it still points at an account with that name
+	account := Find(id)
+	return account != nil && strings.EqualFold(account.Name, name)
+}
+
+// usernames with moderator powers in every lobby, from ADMIN_USERS (comma separated)
+var adminUsers = loadAdminUsers()
+
+func loadAdminUsers() map[string]bool {
+	admins := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			admins[strings.ToLower(name)] = true
+		}
+	}
+	return admins
+}
+
+// IsAdmin reports whether a registered account is listed in ADMIN_USERS, guests never are
+func IsAdmin(account *models.Account) bool {
+	return account != nil && !account.Guest && adminUsers[strings.ToLower(account.Username)]
+}
+
+// Authenticate checks a username and password
+func Authenticate(username string, password string) (*models.Account, error) {
+	account := FindByUsername(username)
+	if account == nil {
+		// hash anyway so unknown usernames take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return account, nil
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// Find returns an account by ID from memory, falling back to Redis
+func Find(id string) *models.Account {
+	if id == "" {
+		return nil
+	}
+	models.AccountsMu.RLock()
+	account, ok := models.Accounts[id]
+	models.AccountsMu.RUnlock()
+	if ok {
+		return account
+	}
+
+	data, err := redisClient.Get("account:" + id).Result()
+	if err != nil {
+		return nil
+	}
+	account = &models.Account{}
+	if err := json.Unmarshal([]byte(data), account); err != nil {
+		log.Printf("Error decoding account %s: %v", id, err)
+		return nil
+	}
+
+	// another request may have loaded it meanwhile, everyone should share one copy
+	models.AccountsMu.Lock()
+	defer models.AccountsMu.Unlock()
+	if loaded, ok := models.Accounts[account.ID]; ok {
+		return loaded
+	}
+	models.Accounts[account.ID] = account
+	return account
+}
+
+// FindByUsername looks a registered account up by username, ignoring case
+func FindByUsername(username string) *models.Account {
+	models.AccountsMu.RLock()
+	for _, account := range models.Accounts {
+		if !account.Guest && strings.EqualFold(account.Username, username) {
+			models.AccountsMu.RUnlock()
+			return account
+		}
+	}
+	models.AccountsMu.RUnlock()
+
+	id, err := redisClient.Get(usernameKey(username)).Result()
+	if err != nil {
+		return nil
+	}
+	return Find(id)
+}
+
+func usernameKey(username string) string {
+	return "account-name:" + strings.ToLower(username)
+}
+
+func nameKey(name string) string {
+	return "account-display:" + strings.ToLower(name)
+}
+
+// dropNameKey frees the account's current name before it changes
+func dropNameKey(account *models.Account) {
+	if account.Name != "" {
+		redisClient.Del(nameKey(account.Name))
+	}
+}
+
+// save keeps the account in memory and in Redis
+func save(account *models.Account) {
+	// copied under the lock, a rename can't change it halfway through
+	models.AccountsMu.Lock()
+	models.Accounts[account.ID] = account
+	saved := *account
+	models.AccountsMu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		log.Printf("Error encoding account %s: %v", saved.ID, err)
+		return
+	}
+	// guests that never come back are forgotten after a while
+	var ttl time.Duration
+	if saved.Guest {
+		ttl = guestTTL
+	}
+	if err := redisClient.Set("account:"+saved.ID, data, ttl).Err(); err != nil {
+		log.Printf("Error storing account in Redis: %v", err)
+	}
+	if saved.Username != "" {
+		redisClient.Set(usernameKey(saved.Username), saved.ID, 0)
+	}
+	redisClient.Set(nameKey(saved.Name), saved.ID, ttl)
+}
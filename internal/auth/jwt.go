@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"tictacgo/models"
+	"time"
+)
+
+// Access tokens are HS256 JWTs for clients that can't keep cookies. they are short
+// lived, a refresh token (see refresh.go) gets a new one. signing keys rotate on their
+// own and every token names its key in the "kid" header so older keys still verify
+
+const (
+	accessTTL   = 15 * time.Minute
+	keyRotation = 24 * time.Hour
+	tokenIssuer = "tictacgo"
+)
+
+// errors returned by ParseAccessToken
+var (
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrTokenExpired = errors.New("access token has expired")
+	ErrTokenRevoked = errors.New("access token has been revoked")
+)
+
+// Claims carried by an access token
+type Claims struct {
+	Subject   string `json:"sub"` // account ID
+	Name      string `json:"name"`
+	Guest     bool   `json:"guest"`
+	Issuer    string `json:"iss"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+	Version   int    `json:"ver"` // the account's TokenVersion when issued
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type signingKey struct {
+	ID      string
+	Secret  []byte
+	Created time.Time
+}
+
+// signing keys by kid, the newest signs and the rest only verify until their tokens have expired
+var (
+	keysMu      sync.Mutex
+	signingKeys = map[string]*signingKey{}
+	currentKey  *signingKey
+)
+
+// revoked token IDs with when they would have expired anyway
+var (
+	revokedMu     sync.RWMutex
+	revokedTokens = make(map[string]time.Time)
+)
+
+// RotateKey starts signing with a fresh key, tokens signed with older keys stay valid
+// until they expire. returns the new key's ID
+func RotateKey() string {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	return rotateKeyLocked()
+}
+
+func rotateKeyLocked() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("unable to generate signing key: %v", err))
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	now := time.Now()
+	currentKey = &signingKey{ID: base64.RawURLEncoding.EncodeToString(id), Secret: secret, Created: now}
+	signingKeys[currentKey.ID] = currentKey
+
+	// a retired key is kept as long as a token it signed could still be alive
+	for kid, key := range signingKeys {
+		if key != currentKey && now.Sub(key.Created) > keyRotation+accessTTL {
+			delete(signingKeys, kid)
+		}
+	}
+	return currentKey.ID
+}
+
+// activeKey is the key new tokens are signed with, rotating it once it is old enough
+func activeKey() *signingKey {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if currentKey == nil || time.Since(currentKey.Created) > keyRotation {
+		rotateKeyLocked()
+	}
+	return currentKey
+}
+
+func findKey(kid string) *signingKey {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	return signingKeys[kid]
+}
+
+// NewAccessToken signs a token for the account, returning it with its expiry
+func NewAccessToken(account *models.Account) (string, time.Time) {
+	now := time.Now()
+	expires := now.Add(accessTTL)
+
+	jti := make([]byte, 16)
+	rand.Read(jti)
+
+	claims := Claims{
+		Subject:   account.ID,
+		Name:      account.Name,
+		Guest:     account.Guest,
+		Issuer:    tokenIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+		ID:        base64.RawURLEncoding.EncodeToString(jti),
+		Version:   account.TokenVersion,
+	}
+
+	key := activeKey()
+	header, _ := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT", Kid: key.ID})
+	payload, _ := json.Marshal(claims)
+
+	unsigned := encodeSegment(header) + "." + encodeSegment(payload)
+	return unsigned + "." + signToken(key, unsigned), expires
+}
+
+// ParseAccessToken checks a token's signature, expiry and revocation and returns its claims
+func ParseAccessToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+	key := findKey(header.Kid)
+	if key == nil {
+		return nil, ErrInvalidToken
+	}
+	expected := signToken(key, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Issuer != tokenIssuer {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	if tokenRevoked(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+	return &claims, nil
+}
+
+// RevokeAccessToken stops a single token from working before it expires
+func RevokeAccessToken(claims *Claims) {
+	expires := time.Unix(claims.ExpiresAt, 0)
+	redisClient.Set("jwt-revoked:"+claims.ID, 1, time.Until(expires))
+
+	revokedMu.Lock()
+	defer revokedMu.Unlock()
+	revokedTokens[claims.ID] = expires
+
+	// forget revocations whose tokens have expired anyway
+	for jti, exp := range revokedTokens {
+		if time.Now().After(exp) {
+			delete(revokedTokens, jti)
+		}
+	}
+}
+
+// RevokeAllTokens signs the account out of every client: all access tokens issued
+// so far stop working and every refresh token is dropped
+func RevokeAllTokens(account *models.Account) {
+	models.AccountsMu.Lock()
+	account.TokenVersion++
+	models.AccountsMu.Unlock()
+	save(account)
+	revokeRefreshTokens(account.ID)
+}
+
+func tokenRevoked(jti string) bool {
+	revokedMu.RLock()
+	_, ok := revokedTokens[jti]
+	revokedMu.RUnlock()
+	if ok {
+		return true
+	}
+	n, err := redisClient.Exists("jwt-revoked:" + jti).Result()
+	return err == nil && n > 0
+}
+
+// accountFromToken resolves a bearer token to its account
+func accountFromToken(token string) (*models.Account, *Claims) {
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return nil, nil
+	}
+	account := Find(claims.Subject)
+	if account == nil || claims.Version != account.TokenVersion {
+		return nil, nil
+	}
+	return account, claims
+}
+
+// BearerToken finds an access token in the request's Authorization header
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return ""
+	}
+	scheme, token, found := strings.Cut(header, " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// UpgradeAccount is CurrentAccount for websocket upgrades. browsers can't set headers
+// on those, so the access_token query parameter is taken too. only /ws accepts it,
+// anywhere else a token in the URL would end up in logs and history for nothing
+func UpgradeAccount(r *http.Request) *models.Account {
+	if BearerToken(r) == "" {
+		if token := r.URL.Query().Get("access_token"); token != "" {
+			account, _ := accountFromToken(token)
+			return account
+		}
+	}
+	return CurrentAccount(r)
+}
+
+// TokenClaims returns the claims of the request's bearer token, nil when it has none or it is invalid
+func TokenClaims(r *http.Request) *Claims {
+	token := BearerToken(r)
+	if token == "" {
+		return nil
+	}
+	_, claims := accountFromToken(token)
+	return claims
+}
+
+func signToken(key *signingKey, unsigned string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
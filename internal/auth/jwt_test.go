@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"tictacgo/models"
+	"time"
+)
+
+// signed makes a token with any header and claims, signed with key, for the cases
+// NewAccessToken never produces
+func signed(t *testing.T, key *signingKey, header tokenHeader, claims Claims) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := encodeSegment(h) + "." + encodeSegment(c)
+	return unsigned + "." + signToken(key, unsigned)
+}
+
+// kidOf reads the key ID out of a token's header
+func kidOf(t *testing.T, token string) string {
+	t.Helper()
+	var header tokenHeader
+	if err := decodeSegment(strings.Split(token, ".")[0], &header); err != nil {
+		t.Fatalf("decoding the header of %q: %v", token, err)
+	}
+	return header.Kid
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	accounts := []*models.Account{
+		{ID: "a1", Name: "alice"},
+		{ID: "g1", Name: "guest", Guest: true},
+		{ID: "a2", Name: "bob", TokenVersion: 3},
+	}
+
+	for _, account := range accounts {
+		t.Run(account.Name, func(t *testing.T) {
+			before := time.Now()
+			token, expires := NewAccessToken(account)
+			if got := expires.Sub(before); got < accessTTL-time.Second || got > accessTTL+time.Second {
+				t.Errorf("expires in %v, want %v", got, accessTTL)
+			}
+
+			claims, err := ParseAccessToken(token)
+			if err != nil {
+				t.Fatalf("ParseAccessToken: %v", err)
+			}
+			want := Claims{
+				Subject:   account.ID,
+				Name:      account.Name,
+				Guest:     account.Guest,
+				Issuer:    tokenIssuer,
+				IssuedAt:  claims.IssuedAt,
+				ExpiresAt: expires.Unix(),
+				ID:        claims.ID,
+				Version:   account.TokenVersion,
+			}
+			if *claims != want {
+				t.Errorf("claims = %+v, want %+v", *claims, want)
+			}
+			if claims.ID == "" {
+				t.Error("token has no ID to revoke it by")
+			}
+			if kid := kidOf(t, token); kid != activeKey().ID {
+				t.Errorf("signed with key %q, the active key is %q", kid, activeKey().ID)
+			}
+		})
+	}
+
+	// two tokens for the same account can be revoked one at a time
+	first, _ := NewAccessToken(accounts[0])
+	second, _ := NewAccessToken(accounts[0])
+	a, errA := ParseAccessToken(first)
+	b, errB := ParseAccessToken(second)
+	if errA != nil || errB != nil {
+		t.Fatalf("ParseAccessToken: %v, %v", errA, errB)
+	}
+	if a.ID == b.ID {
+		t.Errorf("two tokens share the ID %q", a.ID)
+	}
+}
+
+func TestParseAccessTokenRejects(t *testing.T) {
+	key := activeKey()
+	now := time.Now()
+	header := tokenHeader{Alg: "HS256", Typ: "JWT", Kid: key.ID}
+	claims := Claims{Subject: "a1", Name: "alice", Issuer: tokenIssuer, IssuedAt: now.Unix(), ExpiresAt: now.Add(accessTTL).Unix(), ID: "jti"}
+	valid := signed(t, key, header, claims)
+	if _, err := ParseAccessToken(valid); err != nil {
+		t.Fatalf("the token the others are made from doesn't parse: %v", err)
+	}
+	parts := strings.Split(valid, ".")
+
+	otherKey := &signingKey{ID: key.ID, Secret: []byte("not the secret")}
+	withClaims := func(change func(*Claims)) string {
+		c := claims
+		change(&c)
+		return signed(t, key, header, c)
+	}
+	withHeader := func(change func(*tokenHeader)) string {
+		h := header
+		change(&h)
+		return signed(t, key, h, claims)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"empty", "", ErrInvalidToken},
+		{"two parts", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"four parts", valid + ".x", ErrInvalidToken},
+		{"header not base64", "!!!." + parts[1] + "." + parts[2], ErrInvalidToken},
+		{"unsigned", parts[0] + "." + parts[1] + ".", ErrInvalidToken},
+		{"signed with another secret", signed(t, otherKey, header, claims), ErrInvalidToken},
+		{"claims swapped after signing", parts[0] + "." + encodeSegment([]byte(`{"sub":"admin","iss":"tictacgo","exp":9999999999}`)) + "." + parts[2], ErrInvalidToken},
+		{"alg none", withHeader(func(h *tokenHeader) { h.Alg = "none" }), ErrInvalidToken},
+		{"unknown kid", withHeader(func(h *tokenHeader) { h.Kid = "nope" }), ErrInvalidToken},
+		{"no kid", withHeader(func(h *tokenHeader) { h.Kid = "" }), ErrInvalidToken},
+		{"another issuer", withClaims(func(c *Claims) { c.Issuer = "elsewhere" }), ErrInvalidToken},
+		{"expired", withClaims(func(c *Claims) { c.ExpiresAt = now.Add(-time.Second).Unix() }), ErrTokenExpired},
+		{"expiring now", withClaims(func(c *Claims) { c.ExpiresAt = now.Unix() }), ErrTokenExpired},
+		{"no expiry", withClaims(func(c *Claims) { c.ExpiresAt = 0 }), ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseAccessToken(tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ParseAccessToken = %+v, %v, want %v", claims, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	account := &models.Account{ID: "a1", Name: "alice"}
+	oldToken, _ := NewAccessToken(account)
+	oldKid := kidOf(t, oldToken)
+
+	newKid := RotateKey()
+	if newKid == oldKid {
+		t.Fatalf("RotateKey kept the key %q", oldKid)
+	}
+	newToken, _ := NewAccessToken(account)
+	if kid := kidOf(t, newToken); kid != newKid {
+		t.Errorf("signed with %q after rotating to %q", kid, newKid)
+	}
+
+	// the retired key still verifies the tokens it signed
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := ParseAccessToken(token); err != nil {
+			t.Errorf("ParseAccessToken(%s key) = %v", kidOf(t, token), err)
+		}
+	}
+
+	// until none of them can be alive any more, then the next rotation drops it
+	keysMu.Lock()
+	signingKeys[oldKid].Created = time.Now().Add(-keyRotation - accessTTL - time.Minute)
+	keysMu.Unlock()
+	RotateKey()
+	if findKey(oldKid) != nil {
+		t.Errorf("key %q outlived its tokens", oldKid)
+	}
+	if _, err := ParseAccessToken(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of a dropped key = %v, want ErrInvalidToken", err)
+	}
+	if _, err := ParseAccessToken(newToken); err != nil {
+		t.Errorf("token of a retired but recent key = %v", err)
+	}
+}
+
+func TestActiveKeyRotatesItself(t *testing.T) {
+	key := activeKey()
+	if again := activeKey(); again != key {
+		t.Errorf("a fresh key was rotated, %q became %q", key.ID, again.ID)
+	}
+
+	keysMu.Lock()
+	key.Created = time.Now().Add(-keyRotation - time.Second)
+	keysMu.Unlock()
+
+	token, _ := NewAccessToken(&models.Account{ID: "a1", Name: "alice"})
+	if kid := kidOf(t, token); kid == key.ID {
+		t.Errorf("still signing with key %q a day after it was made", kid)
+	}
+	if findKey(key.ID) == nil {
+		t.Errorf("the old key %q was dropped while its tokens are alive", key.ID)
+	}
+}
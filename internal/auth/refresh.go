@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"tictacgo/models"
+	"time"
+)
+
+// Refresh tokens are opaque and kept on the server (hashed), so they can be revoked.
+// each one is good for a single use, refreshing hands back a new pair
+
+const refreshTTL = 30 * 24 * time.Hour
+
+// ErrInvalidRefreshToken covers unknown, used, revoked and expired refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// RefreshToken is stored under the hash of the token handed to the client
+type RefreshToken struct {
+	AccountID string
+	Expires   time.Time
+}
+
+// refresh tokens keyed by hash
+var (
+	refreshMu     sync.Mutex
+	refreshTokens = make(map[string]*RefreshToken)
+)
+
+// TokenPair is what a client gets when it signs in or refreshes
+type TokenPair struct {
+	AccessToken  string
+	Expires      time.Time
+	RefreshToken string
+}
+
+// IssueTokens signs an access token and creates a refresh token for the account
+func IssueTokens(account *models.Account) TokenPair {
+	accessToken, expires := NewAccessToken(account)
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic("unable to generate refresh token: " + err.Error())
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	stored := &RefreshToken{AccountID: account.ID, Expires: time.Now().Add(refreshTTL)}
+	hash := hashRefreshToken(token)
+	refreshMu.Lock()
+	refreshTokens[hash] = stored
+	refreshMu.Unlock()
+	if data, err := json.Marshal(stored); err == nil {
+		if err := redisClient.Set("refresh:"+hash, data, refreshTTL).Err(); err != nil {
+			log.Printf("Error storing refresh token in Redis: %v", err)
+		}
+	}
+
+	return TokenPair{AccessToken: accessToken, Expires: expires, RefreshToken: token}
+}
+
+// Refresh uses up a refresh token and issues a new pair for its account
+func Refresh(token string) (*models.Account, TokenPair, error) {
+	stored := takeRefreshToken(token)
+	if stored == nil || time.Now().After(stored.Expires) {
+		return nil, TokenPair{}, ErrInvalidRefreshToken
+	}
+	account := Find(stored.AccountID)
+	if account == nil {
+		return nil, TokenPair{}, ErrInvalidRefreshToken
+	}
+	return account, IssueTokens(account), nil
+}
+
+// RevokeRefreshToken drops a refresh token, returns false when it wasn't the account's
+func RevokeRefreshToken(account *models.Account, token string) bool {
+	hash := hashRefreshToken(token)
+	stored := loadRefreshToken(hash)
+	if stored == nil || stored.AccountID != account.ID {
+		return false
+	}
+	takeRefreshToken(token)
+	return true
+}
+
+// takeRefreshToken removes a refresh token and returns what it was for.
+// two refreshes racing with the same token get it once, the other gets nil
+func takeRefreshToken(token string) *RefreshToken {
+	hash := hashRefreshToken(token)
+
+	refreshMu.Lock()
+	stored, ok := refreshTokens[hash]
+	delete(refreshTokens, hash)
+	refreshMu.Unlock()
+
+	if ok {
+		redisClient.Del("refresh:" + hash)
+		return stored
+	}
+
+	// issued before a restart, Del tells us whether we were the one to remove it
+	stored = loadRefreshToken(hash)
+	if n, err := redisClient.Del("refresh:" + hash).Result(); err != nil || n == 0 {
+		return nil
+	}
+	return stored
+}
+
+func loadRefreshToken(hash string) *RefreshToken {
+	refreshMu.Lock()
+	stored, ok := refreshTokens[hash]
+	refreshMu.Unlock()
+	if ok {
+		return stored
+	}
+	data, err := redisClient.Get("refresh:" + hash).Result()
+	if err != nil {
+		return nil
+	}
+	stored = &RefreshToken{}
+	if err := json.Unmarshal([]byte(data), stored); err != nil {
+		return nil
+	}
+	return stored
+}
+
+// revokeRefreshTokens drops every refresh token of an account
+func revokeRefreshTokens(accountID string) {
+	var dropped []string
+	refreshMu.Lock()
+	for hash, stored := range refreshTokens {
+		if stored.AccountID == accountID {
+			delete(refreshTokens, hash)
+			dropped = append(dropped, hash)
+		}
+	}
+	refreshMu.Unlock()
+	for _, hash := range dropped {
+		redisClient.Del("refresh:" + hash)
+	}
+
+	// tokens only Redis knows about (issued before a restart)
+	keys, err := redisClient.Keys("refresh:*").Result()
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		data, err := redisClient.Get(key).Result()
+		if err != nil {
+			continue
+		}
+		var stored RefreshToken
+		if json.Unmarshal([]byte(data), &stored) == nil && stored.AccountID == accountID {
+			redisClient.Del(key)
+		}
+	}
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"tictacgo/models"
+	"time"
+)
+
+// SessionCookie holds "<session id>.<signature>", the session itself lives on the server
+const SessionCookie = "session"
+
+// how long a session lasts without being used
+const sessionTTL = 30 * 24 * time.Hour
+
+// key used to sign session cookies, set SESSION_SECRET so sessions survive a restart
+var sessionSecret = loadSessionSecret()
+
+func loadSessionSecret() []byte {
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	// no secret configured, fall back to a random one (everyone is signed out on restart)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("unable to generate session secret: %v", err))
+	}
+	return secret
+}
+
+// Session ties a browser (or API client) to an account
+type Session struct {
+	ID        string
+	AccountID string
+	Expires   time.Time
+}
+
+// active sessions keyed by session ID
+var (
+	sessionsMu sync.RWMutex
+	sessions   = make(map[string]*Session)
+)
+
+// StartSession signs the account in, replacing any session the request already had
+func StartSession(w http.ResponseWriter, r *http.Request, account *models.Account) {
+	EndSession(w, r)
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic(fmt.Sprintf("unable to generate session ID: %v", err))
+	}
+	session := &Session{
+		ID:        base64.RawURLEncoding.EncodeToString(raw),
+		AccountID: account.ID,
+		Expires:   time.Now().Add(sessionTTL),
+	}
+	saveSession(session)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    session.ID + "." + signSession(session.ID),
+		Path:     "/",
+		Expires:  session.Expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// EndSession signs the request's account out and clears the cookie
+func EndSession(w http.ResponseWriter, r *http.Request) {
+	if session := sessionFromRequest(r); session != nil {
+		sessionsMu.Lock()
+		delete(sessions, session.ID)
+		sessionsMu.Unlock()
+		redisClient.Del("session:" + session.ID)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CurrentAccount returns the signed in account from a bearer token (see jwt.go) or the
+// session cookie, nil when neither is valid. a request carrying a bad token is signed out
+// even if it also has a cookie
+func CurrentAccount(r *http.Request) *models.Account {
+	if token := BearerToken(r); token != "" {
+		account, _ := accountFromToken(token)
+		return account
+	}
+
+	session := sessionFromRequest(r)
+	if session == nil {
+		return nil
+	}
+	return Find(session.AccountID)
+}
+
+// sessionFromRequest checks the cookie's signature and looks the session up
+func sessionFromRequest(r *http.Request) *Session {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil
+	}
+	id, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signSession(id))) {
+		return nil
+	}
+
+	session := loadSession(id)
+	if session == nil || time.Now().After(session.Expires) {
+		return nil
+	}
+	return session
+}
+
+func signSession(id string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// loadSession looks in memory first, then in Redis
+func loadSession(id string) *Session {
+	sessionsMu.RLock()
+	session, ok := sessions[id]
+	sessionsMu.RUnlock()
+	if ok {
+		return session
+	}
+
+	data, err := redisClient.Get("session:" + id).Result()
+	if err != nil {
+		return nil
+	}
+	session = &Session{}
+	if err := json.Unmarshal([]byte(data), session); err != nil {
+		log.Printf("Error decoding session: %v", err)
+		return nil
+	}
+	sessionsMu.Lock()
+	sessions[id] = session
+	sessionsMu.Unlock()
+	return session
+}
+
+func saveSession(session *Session) {
+	sessionsMu.Lock()
+	sessions[session.ID] = session
+	sessionsMu.Unlock()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return
+	}
+	if err := redisClient.Set("session:"+session.ID, data, time.Until(session.Expires)).Err(); err != nil {
+		log.Printf("Error storing session in Redis: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"math"
+	"tictacgo/internal/game"
+)
+
+// Result of a single arena game from the first engine's point of view
+type Result int
+
+const (
+	Loss Result = iota
+	Draw
+	Win
+)
+
+// MatchStats adds up an arena match from engine A's point of view
+type MatchStats struct {
+	Games      int
+	Wins       int
+	Draws      int
+	Losses     int
+	WinsAsX    int
+	WinsAsO    int
+	LossesAsX  int
+	LossesAsO  int
+	Forfeits   int // games lost by playing an illegal move, counted in Wins/Losses too
+	TotalMoves int
+}
+
+// PlayGame plays one game between x and o on the game package's rules and returns
+// the result for x and the number of moves played. an engine that returns an
+// illegal move forfeits the game
+func PlayGame(x Engine, o Engine, variant string) (Result, int, bool) {
+	g := game.NewGame()
+	g.Variant = variant
+	g.Start()
+
+	engines := map[string]Engine{"X": x, "O": o}
+	for moves := 1; ; moves++ {
+		symbol := g.CurrentTurn
+		position := engines[symbol].Move(g, symbol)
+
+		result := g.HandleGameMove(position, symbol, engines[symbol].Name())
+		switch result.Next {
+		case "updateTurn":
+			continue
+		case "draw":
+			return Draw, moves, false
+		case "win":
+			if result.Winner == "X" {
+				return Win, moves, false
+			}
+			return Loss, moves, false
+		}
+
+		// anything else is an invalid move
+		if symbol == "X" {
+			return Loss, moves, true
+		}
+		return Win, moves, true
+	}
+}
+
+// Match plays n games between a and b, swapping who plays X every game so neither
+// side keeps the first-move advantage
+func Match(a Engine, b Engine, n int, variant string) MatchStats {
+	var stats MatchStats
+	for i := 0; i < n; i++ {
+		aIsX := i%2 == 0
+
+		var result Result
+		var moves int
+		var forfeit bool
+		if aIsX {
+			result, moves, forfeit = PlayGame(a, b, variant)
+		} else {
+			result, moves, forfeit = PlayGame(b, a, variant)
+			result = Win - result // flip to a's point of view
+		}
+		stats.add(result, aIsX, moves, forfeit)
+	}
+	return stats
+}
+
+func (s *MatchStats) add(result Result, aIsX bool, moves int, forfeit bool) {
+	s.Games++
+	s.TotalMoves += moves
+	if forfeit {
+		s.Forfeits++
+	}
+
+	switch result {
+	case Win:
+		s.Wins++
+		if aIsX {
+			s.WinsAsX++
+		} else {
+			s.WinsAsO++
+		}
+	case Loss:
+		s.Losses++
+		if aIsX {
+			s.LossesAsX++
+		} else {
+			s.LossesAsO++
+		}
+	default:
+		s.Draws++
+	}
+}
+
+// AverageLength is the mean number of moves per game
+func (s MatchStats) AverageLength() float64 {
+	if s.Games == 0 {
+		return 0
+	}
+	return float64(s.TotalMoves) / float64(s.Games)
+}
+
+// Score is A's points per game, a win is 1 and a draw is 0.5
+func (s MatchStats) Score() float64 {
+	if s.Games == 0 {
+		return 0
+	}
+	return (float64(s.Wins) + 0.5*float64(s.Draws)) / float64(s.Games)
+}
+
+// ScoreInterval is the 95% confidence interval of Score, from the per-game variance
+func (s MatchStats) ScoreInterval() (float64, float64) {
+	if s.Games < 2 {
+		return 0, 1
+	}
+	n := float64(s.Games)
+	mean := s.Score()
+	variance := (float64(s.Wins)*math.Pow(1-mean, 2) +
+		float64(s.Draws)*math.Pow(0.5-mean, 2) +
+		float64(s.Losses)*math.Pow(mean, 2)) / (n - 1)
+	margin := 1.96 * math.Sqrt(variance/n)
+	return math.Max(0, mean-margin), math.Min(1, mean+margin)
+}
+
+// LOS is the likelihood of superiority, the chance that A is really the stronger
+// engine given its wins and losses. draws say nothing either way
+func (s MatchStats) LOS() float64 {
+	decisive := float64(s.Wins + s.Losses)
+	if decisive == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf(float64(s.Wins-s.Losses)/math.Sqrt(2*decisive)))
+}
+
+// Elo converts a score to a rating difference, clamped for scores of 0 and 1
+func Elo(score float64) float64 {
+	score = math.Min(math.Max(score, 0.001), 0.999)
+	return 400 * math.Log10(score/(1-score))
+}
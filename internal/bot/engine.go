@@ -0,0 +1,144 @@
+// Package bot holds move engines for computer players. the server's bot API,
+// cmd/tictacgo-bot and the arena all play through the Engine interface.
+package bot
+
+import (
+	"math/rand"
+	"sync"
+	"tictacgo/internal/game"
+)
+
+// Engine picks a move for symbol on the given game, it must return an empty cell (0-8)
+type Engine interface {
+	Name() string
+	Move(g *game.Game, symbol string) int
+}
+
+// New returns an engine by name, nil if there is no such engine
+func New(name string) Engine {
+	switch name {
+	case "random":
+		return Random{}
+	case "minimax":
+		return Minimax{}
+	case "solver":
+		return Solver{}
+	}
+	return nil
+}
+
+// EmptyCells lists the positions still open on the board
+func EmptyCells(board [9]string) []int {
+	var cells []int
+	for i, cell := range board {
+		if cell == "" {
+			cells = append(cells, i)
+		}
+	}
+	return cells
+}
+
+// Random plays any empty cell
+type Random struct{}
+
+func (Random) Name() string { return "random" }
+
+func (Random) Move(g *game.Game, symbol string) int {
+	cells := EmptyCells(g.Board)
+	if len(cells) == 0 {
+		return -1
+	}
+	return cells[rand.Intn(len(cells))]
+}
+
+// Minimax searches the whole game tree using game.CheckWin, so it never loses.
+// ties between equally good moves are broken at random to keep games varied
+type Minimax struct{}
+
+func (Minimax) Name() string { return "minimax" }
+
+func (Minimax) Move(g *game.Game, symbol string) int {
+	// search on a scratch game so the real board and clocks are never touched
+	scratch := &game.Game{Board: g.Board, Variant: g.Variant}
+
+	best := -2
+	var bestMoves []int
+	for _, cell := range EmptyCells(scratch.Board) {
+		scratch.Board[cell] = symbol
+		score := -negamax(scratch, other(symbol), symbol)
+		scratch.Board[cell] = ""
+
+		if score > best {
+			best = score
+			bestMoves = []int{cell}
+		} else if score == best {
+			bestMoves = append(bestMoves, cell)
+		}
+	}
+
+	if len(bestMoves) == 0 {
+		return -1
+	}
+	return bestMoves[rand.Intn(len(bestMoves))]
+}
+
+// negamax scores are cached by variant and canonical position key (see game.Position),
+// the same positions come up over and over in the tree and from game to game. engines
+// can be shared between games running at the same time, hence the lock
+var (
+	scoresMu sync.Mutex
+	scores   = map[string]map[int]int{}
+)
+
+// negamax scores the position for toMove: 1 win, 0 draw, -1 loss. last is the symbol that just moved
+func negamax(g *game.Game, toMove string, last string) int {
+	key := game.Position{Board: g.Board, ToMove: toMove}.CanonicalKey()
+	scoresMu.Lock()
+	score, ok := scores[g.Variant][key]
+	scoresMu.Unlock()
+	if ok {
+		return score
+	}
+
+	score = search(g, toMove, last)
+	scoresMu.Lock()
+	if scores[g.Variant] == nil {
+		scores[g.Variant] = make(map[int]int)
+	}
+	scores[g.Variant][key] = score
+	scoresMu.Unlock()
+	return score
+}
+
+// search is negamax without the cache
+func search(g *game.Game, toMove string, last string) int {
+	if len(g.CheckWin(last)) > 0 {
+		// a line wins for whoever made it, except in misere where it loses
+		if g.Variant == game.VariantMisere {
+			return 1
+		}
+		return -1
+	}
+	if g.CheckStalemate() {
+		return 0
+	}
+
+	best := -2
+	for _, cell := range EmptyCells(g.Board) {
+		g.Board[cell] = toMove
+		score := -negamax(g, last, toMove)
+		g.Board[cell] = ""
+		best = max(best, score)
+		if best == 1 {
+			break
+		}
+	}
+	return best
+}
+
+func other(symbol string) string {
+	if symbol == "X" {
+		return "O"
+	}
+	return "X"
+}
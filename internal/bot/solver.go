@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"sync"
+	"tictacgo/internal/game"
+)
+
+// The solver plays every position out to the end under perfect play: the winning side
+// wins as fast as it can and the losing side holds out as long as it can. it backs
+// /analyze and the post-game review
+
+// outcomes for the side to move, or for the player who made a move
+const (
+	OutcomeWin  = "win"
+	OutcomeDraw = "draw"
+	OutcomeLoss = "loss"
+)
+
+// Evaluation is what a position or move is worth under perfect play
+type Evaluation struct {
+	Outcome string
+	Moves   int // moves until the game ends, both sides counted
+}
+
+// worst to best
+var outcomeRank = map[string]int{OutcomeLoss: 0, OutcomeDraw: 1, OutcomeWin: 2}
+
+// better reports whether e is better than other for the side it belongs to
+func (e Evaluation) better(other Evaluation) bool {
+	if outcomeRank[e.Outcome] != outcomeRank[other.Outcome] {
+		return outcomeRank[e.Outcome] > outcomeRank[other.Outcome]
+	}
+	switch e.Outcome {
+	case OutcomeWin:
+		return e.Moves < other.Moves
+	case OutcomeLoss:
+		return e.Moves > other.Moves
+	}
+	return false
+}
+
+// after turns the evaluation of the position a move leads to (for the opponent, who moves
+// next) into the evaluation of the move for its player
+func (e Evaluation) after() Evaluation {
+	switch e.Outcome {
+	case OutcomeWin:
+		return Evaluation{OutcomeLoss, e.Moves + 1}
+	case OutcomeLoss:
+		return Evaluation{OutcomeWin, e.Moves + 1}
+	}
+	return Evaluation{OutcomeDraw, e.Moves + 1}
+}
+
+// MoveEvaluation is one legal move and what it leads to for the player making it
+type MoveEvaluation struct {
+	Position int
+	Evaluation
+	Best bool // as good as any other move
+}
+
+// solved positions by variant and canonical key, rotations and mirror images play out the same
+var (
+	solvedMu sync.Mutex
+	solved   = map[string]map[int]Evaluation{}
+)
+
+// Solve evaluates a position for its side to move
+func Solve(position game.Position, variant string) Evaluation {
+	key := position.CanonicalKey()
+	solvedMu.Lock()
+	e, ok := solved[variant][key]
+	solvedMu.Unlock()
+	if ok {
+		return e
+	}
+
+	e = solve(position, variant)
+	solvedMu.Lock()
+	if solved[variant] == nil {
+		solved[variant] = make(map[int]Evaluation)
+	}
+	solved[variant][key] = e
+	solvedMu.Unlock()
+	return e
+}
+
+func solve(position game.Position, variant string) Evaluation {
+	// a line is normally the last move's, but positions typed in by hand can have one for either side
+	g := &game.Game{Board: position.Board}
+	for _, symbol := range []string{other(position.ToMove), position.ToMove} {
+		if len(g.CheckWin(symbol)) > 0 {
+			// in misere whoever made the line lost
+			if (symbol == position.ToMove) != (variant == game.VariantMisere) {
+				return Evaluation{OutcomeWin, 0}
+			}
+			return Evaluation{OutcomeLoss, 0}
+		}
+	}
+	if g.CheckStalemate() {
+		return Evaluation{OutcomeDraw, 0}
+	}
+
+	for _, m := range Analyze(position, variant) {
+		if m.Best {
+			return m.Evaluation
+		}
+	}
+	return Evaluation{OutcomeDraw, 0}
+}
+
+// Solver plays the solver's best move: the fastest win, or the longest defence when it is
+// lost. unlike Minimax it always picks the same move, puzzles rely on that
+type Solver struct{}
+
+func (Solver) Name() string { return "solver" }
+
+func (Solver) Move(g *game.Game, symbol string) int {
+	for _, m := range Analyze(game.Position{Board: g.Board, ToMove: symbol}, g.Variant) {
+		if m.Best {
+			return m.Position
+		}
+	}
+	return -1
+}
+
+// Analyze evaluates every legal move in the position, in board order. it is empty when the game is over
+func Analyze(position game.Position, variant string) []MoveEvaluation {
+	if position.Over() {
+		return nil
+	}
+
+	var moves []MoveEvaluation
+	for _, cell := range EmptyCells(position.Board) {
+		next := game.Position{Board: position.Board, ToMove: other(position.ToMove)}
+		next.Board[cell] = position.ToMove
+		moves = append(moves, MoveEvaluation{Position: cell, Evaluation: Solve(next, variant).after()})
+	}
+
+	best := moves[0].Evaluation
+	for _, m := range moves[1:] {
+		if m.Evaluation.better(best) {
+			best = m.Evaluation
+		}
+	}
+	for i := range moves {
+		moves[i].Best = !best.better(moves[i].Evaluation)
+	}
+	return moves
+}
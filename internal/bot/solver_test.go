@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"tictacgo/internal/game"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		variant string
+		want    Evaluation
+		best    []int // the moves Analyze marks best, in board order
+	}{
+		{"empty board", "---------x", game.VariantClassic, Evaluation{OutcomeDraw, 9}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}},
+		{"corners answer the centre", "----x----o", game.VariantClassic, Evaluation{OutcomeDraw, 8}, []int{0, 2, 6, 8}},
+		{"an edge answer to the centre loses", "-o--x----x", game.VariantClassic, Evaluation{OutcomeWin, 5}, []int{0, 2, 3, 5, 6, 8}},
+		{"win in 1", "xx-oo----x", game.VariantClassic, Evaluation{OutcomeWin, 1}, []int{2}},
+		{"the only block", "xx--o----o", game.VariantClassic, Evaluation{OutcomeDraw, 6}, []int{2}},
+		{"an edge against opposite corners", "x---o---xo", game.VariantClassic, Evaluation{OutcomeDraw, 6}, []int{1, 3, 5, 7}},
+		{"already lost", "xxxoo----o", game.VariantClassic, Evaluation{OutcomeLoss, 0}, nil},
+		{"full board", "xoxxoooxxo", game.VariantClassic, Evaluation{OutcomeDraw, 0}, nil},
+		{"misere empty board", "---------x", game.VariantMisere, Evaluation{OutcomeDraw, 9}, []int{4}},
+		{"misere keeps off the line", "xx-oo----x", game.VariantMisere, Evaluation{OutcomeDraw, 5}, []int{6, 7, 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position, err := game.ParsePosition(tt.code)
+			if err != nil {
+				t.Fatalf("ParsePosition(%q): %v", tt.code, err)
+			}
+			if got := Solve(position, tt.variant); got != tt.want {
+				t.Errorf("Solve(%s) = %+v, want %+v", tt.code, got, tt.want)
+			}
+
+			var best []int
+			for _, m := range Analyze(position, tt.variant) {
+				if m.Best {
+					best = append(best, m.Position)
+					if m.Evaluation != tt.want {
+						t.Errorf("best move %d is %+v, the position is %+v", m.Position, m.Evaluation, tt.want)
+					}
+				}
+			}
+			if !reflect.DeepEqual(best, tt.best) {
+				t.Errorf("best moves = %v, want %v", best, tt.best)
+			}
+		})
+	}
+}
+
+// solved positions are cached by canonical key, so every symmetry worked out without the
+// cache has to give the same answer
+func TestSolveSymmetries(t *testing.T) {
+	for _, code := range []string{"-o--x----x", "xx--o----o", "x---o---xo", "x-------ox"} {
+		position, err := game.ParsePosition(code)
+		if err != nil {
+			t.Fatalf("ParsePosition(%q): %v", code, err)
+		}
+		want := Solve(position, game.VariantClassic)
+		for s := game.Symmetry(0); s < 8; s++ {
+			turned := position.Transform(s)
+			if got := solve(turned, game.VariantClassic); got != want {
+				t.Errorf("solve(%s) = %+v, %s is %+v", turned, got, position, want)
+			}
+		}
+	}
+}
+
+func TestSolverMove(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{"xx-oo----x", 2}, // wins
+		{"xx--o----o", 2}, // blocks
+		{"-o--x----x", 0}, // the first of the fastest wins
+	}
+
+	for _, tt := range tests {
+		position, err := game.ParsePosition(tt.code)
+		if err != nil {
+			t.Fatalf("ParsePosition(%q): %v", tt.code, err)
+		}
+		g := &game.Game{Board: position.Board, Variant: game.VariantClassic}
+		if got := (Solver{}).Move(g, position.ToMove); got != tt.want {
+			t.Errorf("Solver.Move(%s) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package chat
+
+import (
+	"tictacgo/models"
+)
+
+// A lobby's chat has channels: all (everyone), players (the two seated players) and
+// spectators (everyone watching), so spectators can talk about the game without
+// coaching the players. whispers go to one player and only they and the sender see them.
+// each channel keeps its own history, all in Lobby.ChatMessages and the others in
+// Lobby.ChannelMessages. IDs are shared, so they still order messages across channels
+
+const (
+	ChannelAll        = "all"
+	ChannelPlayers    = "players"
+	ChannelSpectators = "spectators"
+	ChannelWhisper    = "whisper"
+)
+
+// ValidChannel reports whether channel names a channel, "" is all
+func ValidChannel(channel string) bool {
+	switch channel {
+	case "", ChannelAll, ChannelPlayers, ChannelSpectators, ChannelWhisper:
+		return true
+	}
+	return false
+}
+
+// messages on the all channel are stored with no channel, like before there were channels
+func storedChannel(channel string) string {
+	if channel == ChannelAll {
+		return ""
+	}
+	return channel
+}
+
+// CheckPost decides whether the player may post on channel, to is the player ID a whisper
+// is for. it returns the recipient of a whisper, or a *Rejection saying why not
+func CheckPost(lobby *models.Lobby, playerID string, channel string, to string) (*models.Player, error) {
+	switch storedChannel(channel) {
+	case "":
+		return nil, nil
+	case ChannelPlayers:
+		if !seated(lobby, playerID) {
+			return nil, &Rejection{"not_allowed", "Only seated players can post to the players channel."}
+		}
+		return nil, nil
+	case ChannelSpectators:
+		if !spectating(lobby, playerID) {
+			return nil, &Rejection{"not_allowed", "Only spectators can post to the spectators channel."}
+		}
+		return nil, nil
+	case ChannelWhisper:
+		recipient := findPlayer(lobby, to)
+		if recipient == nil || recipient.IsBot {
+			return nil, &Rejection{"no_recipient", "Whispers need someone in this lobby to go to."}
+		}
+		if recipient.ID == playerID {
+			return nil, &Rejection{"no_recipient", "You can't whisper to yourself."}
+		}
+		// no coaching from the sidelines
+		if lobby.GameStarted && spectating(lobby, playerID) && seated(lobby, recipient.ID) {
+			return nil, &Rejection{"not_allowed", "Spectators can't whisper to players while a game is on."}
+		}
+		return recipient, nil
+	}
+	return nil, &Rejection{"not_allowed", "There is no such channel."}
+}
+
+// CanReadChannel reports whether the player may read a channel's history at all.
+// for whispers they only get the ones they sent or received
+func CanReadChannel(lobby *models.Lobby, playerID string, channel string) bool {
+	switch storedChannel(channel) {
+	case "":
+		return true
+	case ChannelPlayers:
+		return seated(lobby, playerID)
+	case ChannelSpectators:
+		return spectating(lobby, playerID)
+	case ChannelWhisper:
+		return playerID != ""
+	}
+	return false
+}
+
+// CanRead reports whether the player may read a message
+func CanRead(lobby *models.Lobby, playerID string, msg models.ChatMessage) bool {
+	if msg.Channel == ChannelWhisper {
+		return playerID != "" && (playerID == msg.SenderID || playerID == msg.To)
+	}
+	return CanReadChannel(lobby, playerID, msg.Channel)
+}
+
+// channelHistory returns the stored messages of a channel, oldest first
+func channelHistory(lobby *models.Lobby, channel string) []models.ChatMessage {
+	if channel = storedChannel(channel); channel == "" {
+		return lobby.ChatMessages
+	}
+	return lobby.ChannelMessages[channel]
+}
+
+// appendHistory keeps a message in memory with the rest of its channel, dropping the
+// oldest once the channel holds MaxStoredMessages
+func appendHistory(lobby *models.Lobby, msg models.ChatMessage) {
+	if msg.Channel == "" {
+		lobby.ChatMessages = capHistory(append(lobby.ChatMessages, msg))
+		return
+	}
+	if lobby.ChannelMessages == nil {
+		lobby.ChannelMessages = make(map[string][]models.ChatMessage)
+	}
+	lobby.ChannelMessages[msg.Channel] = capHistory(append(lobby.ChannelMessages[msg.Channel], msg))
+}
+
+func capHistory(history []models.ChatMessage) []models.ChatMessage {
+	if len(history) <= MaxStoredMessages {
+		return history
+	}
+	// copy so the dropped messages can be freed
+	return append([]models.ChatMessage{}, history[len(history)-MaxStoredMessages:]...)
+}
+
+// chat can't use the lobby package (it announces through chat), so these are its own
+
+func seated(lobby *models.Lobby, playerID string) bool {
+	for _, p := range lobby.Players {
+		if p.ID == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+func spectating(lobby *models.Lobby, playerID string) bool {
+	for _, p := range lobby.Spectators {
+		if p.ID == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+func findPlayer(lobby *models.Lobby, playerID string) *models.Player {
+	for _, group := range [][]*models.Player{lobby.Players, lobby.Spectators} {
+		for _, p := range group {
+			if p.ID == playerID {
+				return p
+			}
+		}
+	}
+	return nil
+}
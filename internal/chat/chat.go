@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"tictacgo/models"
 
 	"time"
@@ -11,55 +12,72 @@ import (
 	"golang.org/x/net/websocket"
 )
 
-type Message struct {
-	Text   string
-	Sender string
-}
+// messages sent with the initial state and per chatHistory page by default, and the most a page can hold
+const (
+	HistoryWindow   = 50
+	maxHistoryLimit = 100
+)
 
+// HandleChatMessage stores a message in its channel's history under the next ID and
+// sends just that message to the given connections. msg may carry "channel", "senderId",
+// "to" and "toName" (whispers) besides sender and text, callers pick the connections
+// allowed to read the channel
 func HandleChatMessage(lobbyID string, msg map[string]interface{}, connections map[string][]*websocket.Conn) error {
 
 	sender, senderOk := msg["sender"].(string)
 	text, textOk := msg["text"].(string)
 
-	println("sender", sender)
-	println("text", text)
-
 	if !senderOk || !textOk {
 		log.Printf("Invalid chat message: %+v", msg)
 		return nil // Prevent the app from crashing
 	}
 
-	chatMsg := Message{
-		Text:   msg["text"].(string),
-		Sender: msg["sender"].(string),
-	}
-
 	// Find the lobby in models
+	models.LobbiesMu.RLock()
 	l, exists := models.Lobbies[lobbyID]
+	models.LobbiesMu.RUnlock()
 	if !exists {
 		return fmt.Errorf("lobby not found")
 	}
 
-	// Add message to lobby's chat history
-	l.ChatMessages = append(l.ChatMessages, models.ChatMessage{
-		Text:      chatMsg.Text,
-		Sender:    chatMsg.Sender,
+	// /me actions are shown differently but stored like any other message
+	emote, _ := msg["emote"].(bool)
+	channel, _ := msg["channel"].(string)
+	senderID, _ := msg["senderId"].(string)
+	to, _ := msg["to"].(string)
+	toName, _ := msg["toName"].(string)
+
+	// IDs count up per lobby, clients page back through history with them
+	l.ChatSeq++
+	chatMsg := models.ChatMessage{
+		ID:        l.ChatSeq,
+		Text:      text,
+		Sender:    sender,
 		Timestamp: time.Now(),
-	})
+		Emote:     emote,
+		Channel:   storedChannel(channel),
+		SenderID:  senderID,
+		To:        to,
+		ToName:    toName,
+	}
 
-	// Broadcast the updated chat messages
-	return BroadcastChatMessages(lobbyID, l.ChatMessages, connections)
+	// Add message to its channel's history, and to the lobby's list in Redis
+	appendHistory(l, chatMsg)
+	persist(lobbyID, chatMsg)
 
+	// Broadcast only the new message
+	return BroadcastChatMessage(lobbyID, chatMsg, connections)
 }
 
-func BroadcastChatMessages(lobbyID string, messages []models.ChatMessage, connections map[string][]*websocket.Conn) error {
+// BroadcastChatMessage sends one chat message to every client in connections[lobbyID]
+func BroadcastChatMessage(lobbyID string, message models.ChatMessage, connections map[string][]*websocket.Conn) error {
 
 	msg := struct {
-		Type         string               `json:"type"`
-		ChatMessages []models.ChatMessage `json:"chatMessages"`
+		Type    string             `json:"type"`
+		Message models.ChatMessage `json:"message"`
 	}{
-		Type:         "chat",
-		ChatMessages: messages,
+		Type:    "chat",
+		Message: message,
 	}
 
 	// Send message to all clients in the lobby
@@ -74,3 +92,58 @@ func BroadcastChatMessages(lobbyID string, messages []models.ChatMessage, connec
 
 	return nil
 }
+
+// History returns up to limit messages of a channel older than the message with ID before
+// (0 for the newest), oldest first, leaving out the ones playerID can't read. more is true
+// when there are older messages still
+func History(lobby *models.Lobby, channel string, playerID string, before int, limit int) (messages []models.ChatMessage, more bool) {
+	if limit <= 0 {
+		limit = HistoryWindow
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	history := channelHistory(lobby, channel)
+	if storedChannel(channel) == ChannelWhisper {
+		// only the player's own conversations
+		var own []models.ChatMessage
+		for _, m := range history {
+			if CanRead(lobby, playerID, m) {
+				own = append(own, m)
+			}
+		}
+		history = own
+	} else if !CanReadChannel(lobby, playerID, channel) {
+		return []models.ChatMessage{}, false
+	}
+
+	// IDs only grow, so the history is sorted by them
+	end := len(history)
+	if before > 0 {
+		end = sort.Search(len(history), func(i int) bool {
+			return history[i].ID >= before
+		})
+	}
+	start := max(end-limit, 0)
+
+	// copy so later appends to the history can't show through
+	messages = append([]models.ChatMessage{}, history[start:end]...)
+	return messages, start > 0
+}
+
+// Transcript returns every stored message playerID can read, across channels, oldest first
+func Transcript(lobby *models.Lobby, playerID string) []models.ChatMessage {
+	histories := [][]models.ChatMessage{lobby.ChatMessages}
+	for _, history := range lobby.ChannelMessages {
+		histories = append(histories, history)
+	}
+	messages := []models.ChatMessage{}
+	for _, history := range histories {
+		for _, m := range history {
+			if CanRead(lobby, playerID, m) {
+				messages = append(messages, m)
+			}
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages
+}
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tictacgo/models"
+	"time"
+)
+
+// Chat messages starting with "/" are commands. they are registered by the package
+// that can carry them out (see api/handlers/commands.go) and run instead of being
+// posted. replies come from GAMEMASTER and only the issuer sees them
+
+// Permission says who may run a command
+type Permission int
+
+const (
+	AnyPlayer    Permission = iota // anyone who joined the lobby, spectators included
+	SeatedPlayer                   // X or O
+	HostOnly
+	SpectatorOnly
+)
+
+// CommandContext is what a command runs with
+type CommandContext struct {
+	Lobby    *models.Lobby
+	Player   *models.Player // who ran the command
+	IsHost   bool
+	IsSeated bool
+	Args     string            // everything after the command name, trimmed
+	Reply    func(text string) // tells the issuer only
+}
+
+// Command is a slash command
+type Command struct {
+	Name       string // without the slash
+	Args       string // shown in /help, e.g. "<name>"
+	Help       string
+	Permission Permission
+	Run        func(ctx *CommandContext) error // a returned error is replied to the issuer
+}
+
+// registered commands keyed by name
+var commands = make(map[string]*Command)
+
+// RegisterCommand adds a command, replacing any with the same name
+func RegisterCommand(cmd *Command) {
+	commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// Commands lists the registered commands by name
+func Commands() []*Command {
+	list := make([]*Command, 0, len(commands))
+	for _, cmd := range commands {
+		list = append(list, cmd)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsCommand reports whether a chat message is a command
+func IsCommand(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "/")
+}
+
+// Usage is how the command is typed, e.g. "/kick <name>"
+func (cmd *Command) Usage() string {
+	if cmd.Args == "" {
+		return "/" + cmd.Name
+	}
+	return "/" + cmd.Name + " " + cmd.Args
+}
+
+// Allowed reports whether the issuer may run the command
+func (cmd *Command) Allowed(ctx *CommandContext) bool {
+	switch cmd.Permission {
+	case SeatedPlayer:
+		return ctx.IsSeated
+	case HostOnly:
+		return ctx.IsHost
+	case SpectatorOnly:
+		return !ctx.IsSeated
+	}
+	return true
+}
+
+// RunCommand parses "/name args", checks the issuer may run it and runs it
+func RunCommand(ctx *CommandContext, text string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(text), "/"), " ")
+	cmd, ok := commands[strings.ToLower(name)]
+	if !ok {
+		ctx.Reply(fmt.Sprintf("Unknown command /%s, try /help.", name))
+		return
+	}
+
+	if !cmd.Allowed(ctx) {
+		switch cmd.Permission {
+		case SeatedPlayer:
+			ctx.Reply(fmt.Sprintf("Only seated players can use /%s.", cmd.Name))
+		case SpectatorOnly:
+			ctx.Reply(fmt.Sprintf("Only spectators can use /%s.", cmd.Name))
+		default:
+			ctx.Reply(fmt.Sprintf("Only the host can use /%s.", cmd.Name))
+		}
+		return
+	}
+
+	ctx.Args = strings.TrimSpace(args)
+	if err := cmd.Run(ctx); err != nil {
+		ctx.Reply(err.Error())
+	}
+}
+
+// PrivateMessage builds a GAMEMASTER chat message meant for one connection, it isn't
+// kept in the history and has no ID
+func PrivateMessage(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "chat",
+		"private": true,
+		"message": models.ChatMessage{
+			Sender:    "GAMEMASTER",
+			Text:      text,
+			Timestamp: time.Now(),
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"tictacgo/models"
+	"time"
+)
+
+// Messages can be changed after they are posted: their author can edit them for a
+// while, the author or a moderator can delete them and anyone who can read them can
+// react. deleted messages stay in the history as tombstones so IDs and paging don't
+// shift. every change is broadcast as the whole updated message (a chatUpdate) and
+// replaces the stored version of the message, see store.go
+
+// EditWindow is how long after posting the author can still edit a message
+const EditWindow = 5 * time.Minute
+
+// Reactions are the emoji players can react with
+var Reactions = []string{"👍", "👎", "😂", "😮", "😢", "❤️", "🎉", "🔥"}
+
+// errors are safe to show the player
+var (
+	ErrMessageNotFound = errors.New("that message doesn't exist")
+	ErrNotAuthor       = errors.New("you can only change your own messages")
+	ErrEditWindow      = errors.New("messages can only be edited in the first 5 minutes")
+	ErrMessageDeleted  = errors.New("that message was deleted")
+	ErrInvalidReaction = errors.New("that reaction isn't available")
+)
+
+// FindMessage returns the message with ID id if the player can read it, whatever its channel
+func FindMessage(lobby *models.Lobby, playerID string, id int) *models.ChatMessage {
+	histories := [][]models.ChatMessage{lobby.ChatMessages}
+	for _, history := range lobby.ChannelMessages {
+		histories = append(histories, history)
+	}
+	for _, history := range histories {
+		// IDs only grow, so each history is sorted by them
+		i := sort.Search(len(history), func(i int) bool { return history[i].ID >= id })
+		if i < len(history) && history[i].ID == id {
+			if !CanRead(lobby, playerID, history[i]) {
+				return nil
+			}
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// EditMessage changes the text of the player's own message, moderated like a new one.
+// a *Rejection is returned when the new text can't be posted
+func EditMessage(lobby *models.Lobby, playerID string, id int, text string) (*models.ChatMessage, error) {
+	msg := FindMessage(lobby, playerID, id)
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+	if msg.SenderID != playerID {
+		return nil, ErrNotAuthor
+	}
+	if msg.Deleted {
+		return nil, ErrMessageDeleted
+	}
+	if time.Since(msg.Timestamp) > EditWindow {
+		return nil, ErrEditWindow
+	}
+
+	text, err := Moderate(lobby, playerID, text)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	msg.Text = text
+	msg.EditedAt = &now
+	persistChange(lobby.ID, *msg)
+	return msg, nil
+}
+
+// DeleteMessage replaces a message with a tombstone. authors can delete their own,
+// moderators (the host or an admin) anyone's
+func DeleteMessage(lobby *models.Lobby, playerID string, id int, moderator bool) (*models.ChatMessage, error) {
+	msg := FindMessage(lobby, playerID, id)
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+	if msg.SenderID != playerID && !moderator {
+		return nil, ErrNotAuthor
+	}
+	if msg.Deleted {
+		return nil, ErrMessageDeleted
+	}
+
+	msg.Deleted = true
+	msg.Text = ""
+	msg.Emote = false
+	msg.Reactions = nil
+	persistChange(lobby.ID, *msg)
+	return msg, nil
+}
+
+// React toggles the player's reaction to a message.
+// a *Rejection is returned when the player is reacting too quickly
+func React(lobby *models.Lobby, playerID string, id int, emoji string) (*models.ChatMessage, error) {
+	if !slices.Contains(Reactions, emoji) {
+		return nil, ErrInvalidReaction
+	}
+	msg := FindMessage(lobby, playerID, id)
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+	if msg.Deleted {
+		return nil, ErrMessageDeleted
+	}
+	// reactions share the bucket messages take from, so they can't be toggled in a loop
+	if !allowMessage(lobby.ID, playerID) {
+		return nil, errRateLimited
+	}
+
+	if msg.Reactions == nil {
+		msg.Reactions = make(map[string][]string)
+	}
+	reacted := msg.Reactions[emoji]
+	if i := slices.Index(reacted, playerID); i >= 0 {
+		reacted = slices.Delete(reacted, i, i+1)
+	} else {
+		reacted = append(reacted, playerID)
+	}
+	if len(reacted) == 0 {
+		delete(msg.Reactions, emoji)
+	} else {
+		msg.Reactions[emoji] = reacted
+	}
+	persistChange(lobby.ID, *msg)
+	return msg, nil
+}
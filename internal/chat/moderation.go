@@ -0,0 +1,196 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"tictacgo/models"
+	"time"
+	"unicode/utf8"
+)
+
+// Moderation runs on every message a player sends before it is posted. system
+// messages (GAMEMASTER) skip it
+
+const (
+	MaxMessageLength = 280 // characters, not bytes
+
+	// token bucket per player and lobby: a burst of chatBurst messages, then one every chatRefill
+	chatBurst  = 5
+	chatRefill = 2 * time.Second
+)
+
+// Rejection tells the sender why their message wasn't posted
+type Rejection struct {
+	Reason string // "empty", "too_long", "muted", "rate_limited", "not_allowed" or "no_recipient"
+	Text   string
+}
+
+func (r *Rejection) Error() string {
+	return r.Text
+}
+
+var errRateLimited = &Rejection{"rate_limited", "You are sending messages too quickly, wait a moment."}
+
+// Moderate checks a player's message and returns the text to post, with filtered
+// words masked. a *Rejection is returned when the message can't be posted at all
+func Moderate(lobby *models.Lobby, playerID string, text string) (string, error) {
+	if until, muted := MutedUntil(lobby, playerID); muted {
+		left := time.Until(until).Round(time.Second)
+		return "", &Rejection{"muted", fmt.Sprintf("You are muted for another %v.", left)}
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", &Rejection{"empty", "Messages can't be empty."}
+	}
+	if utf8.RuneCountInString(text) > MaxMessageLength {
+		return "", &Rejection{"too_long", fmt.Sprintf("Messages can be at most %d characters.", MaxMessageLength)}
+	}
+	if !allowMessage(lobby.ID, playerID) {
+		return "", errRateLimited
+	}
+	return MaskWords(text), nil
+}
+
+// MutedUntil returns when the player's mute in the lobby ends, muted is false when they aren't
+func MutedUntil(lobby *models.Lobby, playerID string) (until time.Time, muted bool) {
+	until, ok := lobby.Muted[playerID]
+	if !ok {
+		return time.Time{}, false
+	}
+	if time.Now().After(until) {
+		delete(lobby.Muted, playerID)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// rate limiting
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type bucketKey struct {
+	lobbyID  string
+	playerID string
+}
+
+// buckets per lobby and player, shared by the player's connections to the lobby.
+// dropBuckets forgets a lobby's when it closes
+var (
+	bucketsMu sync.Mutex
+	buckets   = make(map[bucketKey]*bucket)
+)
+
+// allowMessage takes a token from the player's bucket, false when it is empty
+func allowMessage(lobbyID string, playerID string) bool {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+
+	now := time.Now()
+	key := bucketKey{lobbyID, playerID}
+	b, ok := buckets[key]
+	if !ok {
+		b = &bucket{tokens: chatBurst, last: now}
+		buckets[key] = b
+	}
+
+	b.tokens = min(chatBurst, b.tokens+now.Sub(b.last).Seconds()/chatRefill.Seconds())
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// dropBuckets forgets the rate limits of a closed lobby
+func dropBuckets(lobbyID string) {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	for key := range buckets {
+		if key.lobbyID == lobbyID {
+			delete(buckets, key)
+		}
+	}
+}
+
+// word filter
+
+// used when neither CHAT_FILTER_WORDS nor CHAT_FILTER_FILE is set
+var defaultFilterWords = []string{"fuck", "shit", "bitch", "cunt", "asshole", "bastard", "dick", "piss"}
+
+// the compiled filter, nil when it is off. SetFilterWords can swap it while messages are checked
+var (
+	filterMu sync.RWMutex
+	filter   = loadFilter()
+)
+
+// loadFilter reads the filtered words from CHAT_FILTER_FILE (one per line, # for comments)
+// or CHAT_FILTER_WORDS (comma separated). CHAT_FILTER_WORDS=none turns the filter off
+func loadFilter() *regexp.Regexp {
+	words := defaultFilterWords
+	if path := os.Getenv("CHAT_FILTER_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error reading chat filter, using the default words: %v", err)
+		} else {
+			defer f.Close()
+			words = nil
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+					words = append(words, line)
+				}
+			}
+		}
+	} else if list := os.Getenv("CHAT_FILTER_WORDS"); list == "none" {
+		words = nil
+	} else if list != "" {
+		words = strings.Split(list, ",")
+	}
+	return compileFilter(words)
+}
+
+// SetFilterWords replaces the filtered words, an empty list turns the filter off
+func SetFilterWords(words []string) {
+	re := compileFilter(words)
+	filterMu.Lock()
+	filter = re
+	filterMu.Unlock()
+}
+
+// compileFilter matches whole words, ignoring case, along with common endings ("words", "worded")
+func compileFilter(words []string) *regexp.Regexp {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)(?:s|es|ed|er|ers|ing)?\b`)
+}
+
+// MaskWords replaces every letter but the first of each filtered word with *
+func MaskWords(text string) string {
+	filterMu.RLock()
+	re := filter
+	filterMu.RUnlock()
+	if re == nil {
+		return text
+	}
+	return re.ReplaceAllStringFunc(text, func(word string) string {
+		first, size := utf8.DecodeRuneInString(word)
+		return string(first) + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+	})
+}
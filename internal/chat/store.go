@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"tictacgo/models"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Chat is kept out of the lobby:<id> blob in its own Redis keys, so posting a message
+// doesn't rewrite the whole lobby. chat:<id>:messages is a hash of message ID to the
+// latest version of the message, edits, deletions and reactions overwrite their field.
+// chat:<id>:ids lists the IDs of the all channel in order, chat:<id>:ids:<channel> those
+// of the other channels. like in memory each list is capped at MaxStoredMessages (oldest
+// dropped first, along with their field), so a busy channel can't push a quiet one out.
+// all of them expire ChatTTL after the last message
+
+var redisClient = redis.NewClient(&redis.Options{
+	Addr: os.Getenv("REDIS_ADDRESS"), // Use environment variable
+})
+
+var (
+	// CHAT_RETENTION, messages kept per channel of a lobby
+	MaxStoredMessages = envInt("CHAT_RETENTION", 1000)
+	// CHAT_TTL_HOURS, how long a quiet lobby's chat is kept
+	ChatTTL = time.Duration(envInt("CHAT_TTL_HOURS", 7*24)) * time.Hour
+)
+
+// envInt reads a positive number from the environment, def when it is missing or invalid
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring %s=%q, using %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+func messagesKey(lobbyID string) string {
+	return "chat:" + lobbyID + ":messages"
+}
+
+// idsKey is the list of message IDs of one channel, "" being the all channel
+func idsKey(lobbyID string, channel string) string {
+	if channel = storedChannel(channel); channel == "" {
+		return "chat:" + lobbyID + ":ids"
+	}
+	return "chat:" + lobbyID + ":ids:" + channel
+}
+
+// storedChannels are the channels with their own history, see appendHistory
+var storedChannels = []string{"", ChannelPlayers, ChannelSpectators, ChannelWhisper}
+
+// persist stores a new message at the end of its channel, dropping the channel's oldest
+// once there are more than MaxStoredMessages
+func persist(lobbyID string, msg models.ChatMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding chat message %d: %v", msg.ID, err)
+		return
+	}
+
+	messages, ids := messagesKey(lobbyID), idsKey(lobbyID, msg.Channel)
+	pipe := redisClient.TxPipeline()
+	pipe.HSet(messages, strconv.Itoa(msg.ID), data)
+	pipe.RPush(ids, msg.ID)
+	dropped := pipe.LRange(ids, 0, int64(-MaxStoredMessages-1))
+	pipe.LTrim(ids, int64(-MaxStoredMessages), -1)
+	pipe.Expire(messages, ChatTTL)
+	for _, channel := range storedChannels {
+		// a quiet channel's list lives as long as the lobby's chat does
+		pipe.Expire(idsKey(lobbyID, channel), ChatTTL)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("Error storing chat message in Redis: %v", err)
+		return
+	}
+
+	if old := dropped.Val(); len(old) > 0 {
+		if err := redisClient.HDel(messages, old...).Err(); err != nil {
+			log.Printf("Error dropping old chat messages in Redis: %v", err)
+		}
+	}
+}
+
+// persistChange overwrites the stored version of an edited, deleted or reacted to message
+func persistChange(lobbyID string, msg models.ChatMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error encoding chat message %d: %v", msg.ID, err)
+		return
+	}
+
+	// only while the message is still stored, a late change to a dropped one is lost
+	// rather than left behind in the hash
+	messages := messagesKey(lobbyID)
+	field := strconv.Itoa(msg.ID)
+	exists, err := redisClient.HExists(messages, field).Result()
+	if err != nil {
+		log.Printf("Error storing chat change in Redis: %v", err)
+		return
+	}
+	if !exists {
+		return
+	}
+	if err := redisClient.HSet(messages, field, data).Err(); err != nil {
+		log.Printf("Error storing chat change in Redis: %v", err)
+	}
+}
+
+// Migrate stores the chat of a lobby blob saved before chat had its own keys. it does
+// nothing once the lobby has chat stored, so only the first load of such a lobby copies it
+func Migrate(lobbyID string, legacy []models.ChatMessage) {
+	if len(legacy) == 0 {
+		return
+	}
+	stored, err := redisClient.Exists(messagesKey(lobbyID)).Result()
+	if err != nil {
+		log.Printf("Error checking chat for lobby %s: %v", lobbyID, err)
+		return
+	}
+	if stored > 0 {
+		return
+	}
+	sort.Slice(legacy, func(i, j int) bool { return legacy[i].ID < legacy[j].ID })
+	for _, msg := range legacy {
+		persist(lobbyID, msg)
+	}
+	log.Printf("Moved %d chat messages of lobby %s to their own keys", len(legacy), lobbyID)
+}
+
+// Load reads a lobby's chat back from Redis into its channel histories, for lobbies
+// restored from the lobby:<id> blob, which has no chat in it
+func Load(lobby *models.Lobby) {
+	var ids []string
+	for _, channel := range storedChannels {
+		channelIDs, err := redisClient.LRange(idsKey(lobby.ID, channel), 0, -1).Result()
+		if err != nil {
+			log.Printf("Error loading chat for lobby %s: %v", lobby.ID, err)
+			return
+		}
+		ids = append(ids, channelIDs...)
+	}
+	var entries []interface{}
+	if len(ids) > 0 {
+		var err error
+		entries, err = redisClient.HMGet(messagesKey(lobby.ID), ids...).Result()
+		if err != nil {
+			log.Printf("Error loading chat for lobby %s: %v", lobby.ID, err)
+			return
+		}
+	}
+
+	messages := make([]models.ChatMessage, 0, len(entries))
+	for _, entry := range entries {
+		data, ok := entry.(string)
+		if !ok {
+			continue // listed but already dropped
+		}
+		var msg models.ChatMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			log.Printf("Error decoding chat message in lobby %s: %v", lobby.ID, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	lobby.ChatMessages = []models.ChatMessage{}
+	lobby.ChannelMessages = make(map[string][]models.ChatMessage)
+	for _, msg := range messages {
+		appendHistory(lobby, msg)
+		// the lobby blob isn't saved for every message, so its count can be behind
+		lobby.ChatSeq = max(lobby.ChatSeq, msg.ID)
+	}
+}
+
+// Drop deletes a lobby's stored chat and rate limits, for closed lobbies
+func Drop(lobbyID string) {
+	dropBuckets(lobbyID)
+	keys := []string{messagesKey(lobbyID)}
+	for _, channel := range storedChannels {
+		keys = append(keys, idsKey(lobbyID, channel))
+	}
+	if err := redisClient.Del(keys...).Err(); err != nil {
+		log.Printf("Error deleting chat for lobby %s: %v", lobbyID, err)
+	}
+}
@@ -2,6 +2,13 @@ package game
 
 import (
 	"fmt"
+	"time"
+)
+
+// supported rule sets
+const (
+	VariantClassic = "classic" // three in a row wins
+	VariantMisere  = "misere"  // three in a row loses
 )
 
 type Game struct {
@@ -11,6 +18,21 @@ type Game struct {
 	UserCount      int
 	SpectatorCount int
 	Players        []string // track player names/symbols
+	Variant        string
+	FirstTurn      string                   // symbol that opens each game
+	TimeControl    time.Duration            // clock per player for a whole game, 0 for untimed
+	Clock          map[string]time.Duration // time left per symbol
+	TurnStarted    time.Time                // when the current turn's clock started running
+	Started        time.Time                // when the current (or last) game started
+	Moves          []Move                   // moves of the current game, kept after it ends until the next Start
+	StartPosition  *Position                // every game starts from here instead of an empty board, for practice
+}
+
+// Move is one move played on the board
+type Move struct {
+	Symbol   string
+	Position int
+	Time     time.Time
 }
 
 type GameMessage struct {
@@ -20,6 +42,8 @@ type GameMessage struct {
 	Winner   string `json:"winner"`
 	Position int    `json:"position"`
 	Symbol   string `json:"symbol"`
+
+	Termination string `json:"termination,omitempty"` // resign, timeout or agreed for games not decided on the board
 }
 
 // --------------------------------------------------------------------------------- GAME / SERVER COMMUNICATION
@@ -33,10 +57,27 @@ func (g *Game) HandleGameMove(position int, symbol string, username string) Game
 		}
 	}
 
+	// a player whose clock ran out loses before the move lands
+	if !g.chargeClock(symbol) {
+		return g.Timeout(symbol, username)
+	}
+
 	g.Board[position] = symbol
+	g.Moves = append(g.Moves, Move{Symbol: symbol, Position: position, Time: time.Now()})
 
 	if winPatterns := g.CheckWin(symbol); len(winPatterns) > 0 {
 		g.Reset()
+		// in misere whoever completes a line loses
+		if g.Variant == VariantMisere {
+			return GameMessage{
+				Type:     "move",
+				Text:     fmt.Sprintf("%s completed a line and loses!", username),
+				Next:     "win",
+				Winner:   opponent(symbol),
+				Position: position,
+				Symbol:   symbol,
+			}
+		}
 		return GameMessage{
 			Type:     "move",
 			Text:     fmt.Sprintf("%s wins!", username),
@@ -68,22 +109,107 @@ func (g *Game) HandleGameMove(position int, symbol string, username string) Game
 	}
 }
 
+// Resign ends the game as a loss for symbol, position is -1 as no move was played
+func (g *Game) Resign(symbol string, username string) GameMessage {
+	g.Reset()
+	return GameMessage{
+		Type:     "move",
+		Text:     fmt.Sprintf("%s resigned!", username),
+		Next:     "resign",
+		Winner:   opponent(symbol),
+		Position: -1,
+		Symbol:   symbol,
+
+		Termination: TerminationResign,
+	}
+}
+
+// Timeout ends the game as a loss for the player whose clock ran out
+func (g *Game) Timeout(symbol string, username string) GameMessage {
+	g.Reset()
+	return GameMessage{
+		Type:     "move",
+		Text:     fmt.Sprintf("%s ran out of time!", username),
+		Next:     "timeout",
+		Winner:   opponent(symbol),
+		Position: -1,
+		Symbol:   symbol,
+
+		Termination: TerminationTimeout,
+	}
+}
+
+// AgreeDraw ends the game as a draw both players agreed to
+func (g *Game) AgreeDraw() GameMessage {
+	g.Reset()
+	return GameMessage{
+		Type:     "move",
+		Text:     "Draw agreed!",
+		Next:     "draw",
+		Winner:   "none",
+		Position: -1,
+
+		Termination: TerminationAgreed,
+	}
+}
+
 // / -------------------------------------------------------------------------------- GAME LOGIC
 
 // inits new instance of Game, with default values
 func NewGame() *Game {
 	return &Game{
 		Board:       [9]string{"", "", "", "", "", "", "", "", ""},
-		CurrentTurn: "X", // X always starts
+		CurrentTurn: "X", // X starts unless FirstTurn says otherwise
 		GameStarted: false,
 		UserCount:   0,
 		Players:     []string{},
+		Variant:     VariantClassic,
+		FirstTurn:   "X",
 	}
 }
 
-// Marks the game as started by setting GameStarted to true.
+// Marks the game as started by setting GameStarted to true, and winds both clocks.
 func (g *Game) Start() {
 	g.GameStarted = true
+	g.Started = time.Now()
+	g.Moves = nil
+	if g.TimeControl > 0 {
+		g.Clock = map[string]time.Duration{"X": g.TimeControl, "O": g.TimeControl}
+		g.TurnStarted = time.Now()
+	}
+}
+
+// deducts the time spent on this turn from the mover's clock and restarts it for
+// the next turn. returns false when the mover has run out of time
+func (g *Game) chargeClock(symbol string) bool {
+	if g.TimeControl <= 0 || g.Clock == nil {
+		return true
+	}
+
+	now := time.Now()
+	g.Clock[symbol] -= now.Sub(g.TurnStarted)
+	g.TurnStarted = now
+	return g.Clock[symbol] > 0
+}
+
+// TimeRemaining returns the time left on a symbol's clock, counting the turn in progress
+func (g *Game) TimeRemaining(symbol string) time.Duration {
+	if g.TimeControl <= 0 || g.Clock == nil {
+		return 0
+	}
+	remaining := g.Clock[symbol]
+	if g.GameStarted && g.CurrentTurn == symbol {
+		remaining -= time.Since(g.TurnStarted)
+	}
+	return max(remaining, 0)
+}
+
+// returns the other player's symbol
+func opponent(symbol string) string {
+	if symbol == "X" {
+		return "O"
+	}
+	return "X"
 }
 
 // Handles player moves on the game board.
@@ -131,9 +257,23 @@ func (g *Game) CheckStalemate() bool {
 	return true
 }
 
+// SetStartPosition makes every game start from p, whose side to move opens
+func (g *Game) SetStartPosition(p Position) {
+	g.StartPosition = &p
+	g.FirstTurn = p.ToMove
+	g.Reset()
+}
+
 // reset game after win or draw
 func (g *Game) Reset() {
 	g.Board = [9]string{"", "", "", "", "", "", "", "", ""}
-	g.CurrentTurn = "X"
+	if g.StartPosition != nil {
+		g.Board = g.StartPosition.Board
+	}
+	g.CurrentTurn = g.FirstTurn
+	if g.CurrentTurn == "" {
+		g.CurrentTurn = "X"
+	}
 	g.GameStarted = false
+	g.Clock = nil
 }
@@ -0,0 +1,337 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Games are written down in a notation modelled on chess PGN: header tags, a blank line,
+// then the numbered moves and the result
+//
+//	[Event "alice's Lobby"]
+//	[Date "2026.10.19"]
+//	[X "alice"]
+//	[O "bob"]
+//	[Variant "classic"]
+//	[Result "1-0"]
+//
+//	1. a1 b2 2. b1 c3 3. c1 1-0
+//
+// squares are a column (a-c, left to right) and a row (1-3, top to bottom), so a1 is
+// position 0 and c3 position 8. comments in {braces} are skipped when parsing. games
+// that didn't start on an empty board have a Position tag with the start position's code
+
+// tag names the writer puts first, in this order
+var standardTags = []string{"Event", "Site", "Date", "X", "O", "Variant", "FirstTurn", "Position", "Result", "Termination"}
+
+// results, as in PGN the first number is X's score
+const (
+	ResultXWins   = "1-0"
+	ResultOWins   = "0-1"
+	ResultDraw    = "1/2-1/2"
+	ResultOngoing = "*"
+)
+
+// terminations of games that didn't end on the board
+const (
+	TerminationResign  = "resign"
+	TerminationTimeout = "timeout"
+	TerminationAgreed  = "agreed" // a draw both players took
+
+	// a line or a full board. game records keep it, notation leaves the tag out
+	TerminationBoard = "board"
+)
+
+// Record is a game in notation form
+type Record struct {
+	Tags  map[string]string
+	Moves []int // positions, in the order they were played
+}
+
+// Tag returns a header tag, "" when it isn't set
+func (r *Record) Tag(name string) string {
+	return r.Tags[name]
+}
+
+// ResultFor turns a winner ("X", "O" or "none") into a result, finished is false for
+// games still in progress
+func ResultFor(winner string, finished bool) string {
+	switch {
+	case !finished:
+		return ResultOngoing
+	case winner == "X":
+		return ResultXWins
+	case winner == "O":
+		return ResultOWins
+	}
+	return ResultDraw
+}
+
+// Square names a position, e.g. 0 is "a1"
+func Square(position int) string {
+	return fmt.Sprintf("%c%d", 'a'+position%3, position/3+1)
+}
+
+// ParseSquare reads a square like "b2" (any case) back into a position
+func ParseSquare(square string) (int, error) {
+	square = strings.ToLower(square)
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'c' || square[1] < '1' || square[1] > '3' {
+		return 0, fmt.Errorf("%q isn't a square, use a1 to c3", square)
+	}
+	return int(square[1]-'1')*3 + int(square[0]-'a'), nil
+}
+
+// FormatNotation writes a record out, the standard tags first and any others sorted after
+func FormatNotation(r Record) string {
+	var b strings.Builder
+	written := make(map[string]bool)
+	writeTag := func(name string) {
+		if value, ok := r.Tags[name]; ok && !written[name] {
+			fmt.Fprintf(&b, "[%s %s]\n", name, strconv.Quote(value))
+			written[name] = true
+		}
+	}
+	for _, name := range standardTags {
+		writeTag(name)
+	}
+	var others []string
+	for name := range r.Tags {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		writeTag(name)
+	}
+	b.WriteString("\n")
+
+	// moves numbered in pairs, wrapped at 80 columns
+	var tokens []string
+	for i, position := range r.Moves {
+		if i%2 == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d.", i/2+1))
+		}
+		tokens = append(tokens, Square(position))
+	}
+	result := r.Tags["Result"]
+	if result == "" {
+		result = ResultOngoing
+	}
+	tokens = append(tokens, result)
+
+	line := 0
+	for i, token := range tokens {
+		if i > 0 {
+			if line+1+len(token) > 80 {
+				b.WriteString("\n")
+				line = 0
+			} else {
+				b.WriteString(" ")
+				line++
+			}
+		}
+		b.WriteString(token)
+		line += len(token)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ParseNotation reads a game written by FormatNotation, or by hand. it only checks the
+// syntax, Replay checks the moves are legal
+func ParseNotation(text string) (*Record, error) {
+	r := &Record{Tags: make(map[string]string)}
+	var movetext []string
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			movetext = append(movetext, line)
+			continue
+		}
+		if len(movetext) > 0 && strings.TrimSpace(strings.Join(movetext, "")) != "" {
+			return nil, fmt.Errorf("line %d: tags go before the moves", i+1)
+		}
+
+		name, value, err := parseTag(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		r.Tags[name] = value
+	}
+
+	result := ""
+	for _, token := range moveTokens(strings.Join(movetext, "\n")) {
+		if result != "" {
+			return nil, fmt.Errorf("%q after the result", token)
+		}
+		switch {
+		case token == ResultXWins || token == ResultOWins || token == ResultDraw || token == ResultOngoing:
+			result = token
+		case isMoveNumber(token):
+			// numbering is only for readers
+		default:
+			position, err := ParseSquare(token)
+			if err != nil {
+				return nil, err
+			}
+			r.Moves = append(r.Moves, position)
+		}
+	}
+
+	// the result can be a tag, after the moves or both, but they have to agree
+	switch tag := r.Tags["Result"]; {
+	case tag != "" && result != "" && tag != result:
+		return nil, fmt.Errorf("the Result tag says %s but the moves end in %s", tag, result)
+	case tag == "" && result == "":
+		r.Tags["Result"] = ResultOngoing
+	case tag == "":
+		r.Tags["Result"] = result
+	}
+	return r, nil
+}
+
+// parseTag reads `[Name "value"]`
+func parseTag(line string) (string, string, error) {
+	if !strings.HasSuffix(line, "]") {
+		return "", "", fmt.Errorf("tag %s isn't closed with ]", line)
+	}
+	name, quoted, ok := strings.Cut(strings.TrimSpace(line[1:len(line)-1]), " ")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("tag %s needs a name and a quoted value", line)
+	}
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			return "", "", fmt.Errorf("tag name %q can only have letters, digits and _", name)
+		}
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(quoted))
+	if err != nil {
+		return "", "", fmt.Errorf("tag %s needs a quoted value", name)
+	}
+	return name, value, nil
+}
+
+// moveTokens splits movetext on spaces, dropping {comments} and splitting "1.a1" style numbers off
+func moveTokens(movetext string) []string {
+	var tokens []string
+	var token strings.Builder
+	inComment := false
+	flush := func() {
+		if token.Len() == 0 {
+			return
+		}
+		// "1.a1" is a number and a move
+		text := token.String()
+		if rest := strings.TrimLeft(text, "0123456789"); rest != text && strings.HasPrefix(rest, ".") {
+			move := strings.TrimLeft(rest, ".")
+			tokens = append(tokens, strings.TrimSuffix(text, move))
+			text = move
+		}
+		if text != "" {
+			tokens = append(tokens, text)
+		}
+		token.Reset()
+	}
+	for _, c := range movetext {
+		switch {
+		case inComment:
+			inComment = c != '}'
+		case c == '{':
+			flush()
+			inComment = true
+		case unicode.IsSpace(c):
+			flush()
+		default:
+			token.WriteRune(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// isMoveNumber matches "1." and "1..." (a move number before O's move)
+func isMoveNumber(token string) bool {
+	digits := strings.TrimRight(token, ".")
+	if digits == "" || len(digits) == len(token) {
+		return false
+	}
+	_, err := strconv.Atoi(digits)
+	return err == nil
+}
+
+// Replay plays a record's moves on a new game through HandleGameMove, checking each is
+// legal and that the game ends the way the Result tag says. it returns the final board
+// and the result of the last move
+func Replay(r *Record) (board [9]string, last GameMessage, err error) {
+	g := NewGame()
+	if variant := r.Tag("Variant"); variant != "" {
+		if variant != VariantClassic && variant != VariantMisere {
+			return board, last, fmt.Errorf("variant %q isn't classic or misere", variant)
+		}
+		g.Variant = variant
+	}
+	if first := r.Tag("FirstTurn"); first != "" {
+		if first != "X" && first != "O" {
+			return board, last, fmt.Errorf("FirstTurn must be X or O, not %q", first)
+		}
+		g.FirstTurn = first
+		g.CurrentTurn = first
+	}
+	if code := r.Tag("Position"); code != "" {
+		position, err := ParsePosition(code)
+		if err != nil {
+			return board, last, err
+		}
+		if position.Over() {
+			return board, last, fmt.Errorf("the start position is already won or drawn")
+		}
+		// the position says who moves first
+		g.SetStartPosition(position)
+		board = position.Board
+	}
+	g.Start()
+
+	names := map[string]string{"X": r.Tag("X"), "O": r.Tag("O")}
+	finished := false
+	for i, position := range r.Moves {
+		if finished {
+			return board, last, fmt.Errorf("move %d (%s) comes after the game ended", i+1, Square(position))
+		}
+		symbol := g.CurrentTurn
+		last = g.HandleGameMove(position, symbol, names[symbol])
+		if last.Type == "invalidMove" {
+			return board, last, fmt.Errorf("move %d (%s) is on a square that's already taken", i+1, Square(position))
+		}
+		// HandleGameMove clears the board when the game ends, so keep our own
+		board[position] = symbol
+		finished = last.Next != "updateTurn"
+	}
+
+	result := r.Tag("Result")
+	if finished {
+		if want := ResultFor(last.Winner, true); result != want {
+			return board, last, fmt.Errorf("the moves end in %s, not %s", want, result)
+		}
+		return board, last, nil
+	}
+
+	// a game that didn't end on the board needs a termination to have a result
+	switch termination := r.Tag("Termination"); {
+	case result == ResultOngoing:
+	case result == ResultDraw && termination == TerminationAgreed:
+		last = GameMessage{Type: "move", Next: "draw", Winner: "none", Position: -1}
+	case (result == ResultXWins || result == ResultOWins) && (termination == TerminationResign || termination == TerminationTimeout):
+		winner := "X"
+		if result == ResultOWins {
+			winner = "O"
+		}
+		last = GameMessage{Type: "move", Next: termination, Winner: winner, Position: -1, Symbol: opponent(winner)}
+	default:
+		return board, last, fmt.Errorf("the game isn't over on the board, so %s needs a Termination of resign, timeout or agreed", result)
+	}
+	return board, last, nil
+}
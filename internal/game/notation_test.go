@@ -0,0 +1,238 @@
+package game
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSquares(t *testing.T) {
+	for position := 0; position < 9; position++ {
+		square := Square(position)
+		got, err := ParseSquare(square)
+		if err != nil || got != position {
+			t.Errorf("ParseSquare(%q) = %d, %v, want %d", square, got, err, position)
+		}
+		if upper, err := ParseSquare(strings.ToUpper(square)); err != nil || upper != position {
+			t.Errorf("ParseSquare(%q) = %d, %v, want %d", strings.ToUpper(square), upper, err, position)
+		}
+	}
+	if Square(0) != "a1" || Square(4) != "b2" || Square(8) != "c3" {
+		t.Errorf("squares are %s, %s and %s, want a1, b2 and c3", Square(0), Square(4), Square(8))
+	}
+
+	for _, square := range []string{"", "a", "a0", "a4", "d1", "1a", "a11"} {
+		if _, err := ParseSquare(square); err == nil {
+			t.Errorf("ParseSquare(%q) succeeded", square)
+		}
+	}
+}
+
+// every game is written out, read back and replayed, and has to come back as it went in
+func TestNotationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		tags   map[string]string
+		moves  []int
+		board  string // after the last move, as a position code without the side to move
+		winner string
+		next   string
+	}{
+		{
+			name:   "X wins on the top row",
+			tags:   map[string]string{"Event": "alice's Lobby", "X": "alice", "O": "bob", "Result": ResultXWins},
+			moves:  []int{0, 3, 1, 4, 2},
+			board:  "xxxoo----",
+			winner: "X",
+			next:   "win",
+		},
+		{
+			name:   "full board draw",
+			tags:   map[string]string{"Result": ResultDraw},
+			moves:  []int{0, 4, 8, 2, 6, 3, 5, 7, 1},
+			board:  "xxoooxxox",
+			winner: "none",
+			next:   "draw",
+		},
+		{
+			name:   "O moves first",
+			tags:   map[string]string{"FirstTurn": "O", "Result": ResultOWins},
+			moves:  []int{0, 3, 1, 4, 2},
+			board:  "oooxx----",
+			winner: "O",
+			next:   "win",
+		},
+		{
+			name:   "misere, the line loses",
+			tags:   map[string]string{"Variant": VariantMisere, "Result": ResultOWins},
+			moves:  []int{0, 3, 1, 4, 2},
+			board:  "xxxoo----",
+			winner: "O",
+			next:   "win",
+		},
+		{
+			name:   "from a start position",
+			tags:   map[string]string{"Position": "x---o----x", "Result": ResultXWins},
+			moves:  []int{8, 2, 6, 3, 7},
+			board:  "x-ooo-xxx",
+			winner: "X",
+			next:   "win",
+		},
+		{
+			name:   "resigned",
+			tags:   map[string]string{"Result": ResultOWins, "Termination": TerminationResign},
+			moves:  []int{4},
+			board:  "----x----",
+			winner: "O",
+			next:   TerminationResign,
+		},
+		{
+			name:   "out of time",
+			tags:   map[string]string{"Result": ResultXWins, "Termination": TerminationTimeout},
+			moves:  []int{4, 0},
+			board:  "o---x----",
+			winner: "X",
+			next:   TerminationTimeout,
+		},
+		{
+			name:   "agreed draw",
+			tags:   map[string]string{"Result": ResultDraw, "Termination": TerminationAgreed},
+			moves:  []int{4, 0, 8},
+			board:  "o---x---x",
+			winner: "none",
+			next:   "draw",
+		},
+		{
+			name:  "still going",
+			tags:  map[string]string{"Result": ResultOngoing, "Site": "tictacgo", "Lobby": "[1] \"quoted\""},
+			moves: []int{4},
+			board: "----x----",
+			next:  "updateTurn",
+		},
+		{
+			name:  "no moves",
+			tags:  map[string]string{"Result": ResultOngoing},
+			board: "---------",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := FormatNotation(Record{Tags: tt.tags, Moves: tt.moves})
+			r, err := ParseNotation(text)
+			if err != nil {
+				t.Fatalf("ParseNotation:\n%s\n%v", text, err)
+			}
+			if !reflect.DeepEqual(r.Tags, tt.tags) {
+				t.Errorf("tags = %v, want %v", r.Tags, tt.tags)
+			}
+			if len(r.Moves) != len(tt.moves) || (len(tt.moves) > 0 && !reflect.DeepEqual(r.Moves, tt.moves)) {
+				t.Errorf("moves = %v, want %v", r.Moves, tt.moves)
+			}
+			// writing it again gives the same text
+			if again := FormatNotation(*r); again != text {
+				t.Errorf("written again as\n%s\nwant\n%s", again, text)
+			}
+
+			board, last, err := Replay(r)
+			if err != nil {
+				t.Fatalf("Replay:\n%s\n%v", text, err)
+			}
+			if got := strings.TrimSuffix(Position{Board: board, ToMove: "X"}.Code(), "x"); got != tt.board {
+				t.Errorf("board = %s, want %s", got, tt.board)
+			}
+			if last.Next != tt.next || (tt.winner != "" && last.Winner != tt.winner) {
+				t.Errorf("last move = %s won by %q, want %s won by %q", last.Next, last.Winner, tt.next, tt.winner)
+			}
+		})
+	}
+}
+
+func TestParseNotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		moves  []int
+		result string
+	}{
+		{"by hand", "1. a1 b2 2. c3 *", []int{0, 4, 8}, ResultOngoing},
+		{"numbers stuck to moves", "1.a1 b2 2.c3 1/2-1/2", []int{0, 4, 8}, ResultDraw},
+		{"O's move number", "1. a1 1... b2", []int{0, 4}, ResultOngoing},
+		{"comments", "1. b2 {the centre} a1 {a corner,\nfine} *", []int{4, 0}, ResultOngoing},
+		{"upper case squares", "1. B2 A1", []int{4, 0}, ResultOngoing},
+		{"result only in the tag", "[Result \"1-0\"]\n\n1. a1 a2 2. b1 b2 3. c1", []int{0, 3, 1, 4, 2}, ResultXWins},
+		{"windows line endings", "[X \"alice\"]\r\n\r\n1. a1 0-1\r\n", []int{0}, ResultOWins},
+		{"empty", "", nil, ResultOngoing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseNotation(tt.text)
+			if err != nil {
+				t.Fatalf("ParseNotation(%q): %v", tt.text, err)
+			}
+			if !reflect.DeepEqual(r.Moves, tt.moves) {
+				t.Errorf("moves = %v, want %v", r.Moves, tt.moves)
+			}
+			if got := r.Tag("Result"); got != tt.result {
+				t.Errorf("result = %q, want %q", got, tt.result)
+			}
+		})
+	}
+}
+
+func TestParseNotationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"tag after the moves", "1. a1\n[X \"alice\"]"},
+		{"tag not closed", "[X \"alice\""},
+		{"tag without a value", "[X]"},
+		{"tag value not quoted", "[X alice]"},
+		{"bad tag name", "[X-Player \"alice\"]"},
+		{"bad square", "1. a1 d4"},
+		{"move after the result", "1. a1 * b2"},
+		{"results disagree", "[Result \"1-0\"]\n\n1. a1 0-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if r, err := ParseNotation(tt.text); err == nil {
+				t.Errorf("ParseNotation(%q) = %+v, want an error", tt.text, r)
+			}
+		})
+	}
+}
+
+// ParseNotation only checks the syntax, Replay turns down games that couldn't have been played
+func TestReplayErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"square taken", "1. a1 a1 *"},
+		{"move after the game ended", "1. a1 a2 2. b1 b2 3. c1 c2 1-0"},
+		{"wrong result", "1. a1 a2 2. b1 b2 3. c1 0-1"},
+		{"decisive result without a termination", "1. a1 1-0"},
+		{"draw without a termination", "1. a1 1/2-1/2"},
+		{"agreed isn't for wins", "[Termination \"agreed\"]\n\n1. a1 1-0"},
+		{"unknown variant", "[Variant \"wild\"]\n\n1. a1 *"},
+		{"bad first turn", "[FirstTurn \"Z\"]\n\n1. a1 *"},
+		{"bad start position", "[Position \"xx-------x\"]\n\n*"},
+		{"start position already won", "[Position \"xxxoo----o\"]\n\n*"},
+		{"start position square taken", "[Position \"x---o----x\"]\n\n1. a1 *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseNotation(tt.text)
+			if err != nil {
+				t.Fatalf("ParseNotation(%q): %v", tt.text, err)
+			}
+			if _, _, err := Replay(r); err == nil {
+				t.Errorf("Replay(%q) succeeded", tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Position is a board and whose turn it is. it has two encodings:
+//   - a code for URLs, the nine cells row by row as x, o or - and then the side to
+//     move, e.g. "x---o----x" (X in a1, O in b2, X to move)
+//   - a key for caches, the cells as base 3 digits (0 empty, 1 X, 2 O) times two plus
+//     the side to move (0 X, 1 O), so every position is a number below MaxPositionKey
+//
+// rotating or mirroring the board doesn't change a position's value, so Canonical picks
+// one of its 8 symmetries to stand for all of them, the one with the lowest key
+type Position struct {
+	Board  [9]string
+	ToMove string // "X" or "O"
+}
+
+// MaxPositionKey is one more than the largest key, 3^9 * 2
+const MaxPositionKey = 39366
+
+// Symmetry is one of the 8 ways to turn or flip the board, 0 leaves it as is
+type Symmetry int
+
+// each symmetry as cell i of the transformed board = cell symmetries[s][i] of the original
+var symmetries = [8][9]int{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8}, // identity
+	{6, 3, 0, 7, 4, 1, 8, 5, 2}, // quarter turn clockwise
+	{8, 7, 6, 5, 4, 3, 2, 1, 0}, // half turn
+	{2, 5, 8, 1, 4, 7, 0, 3, 6}, // quarter turn anticlockwise
+	{2, 1, 0, 5, 4, 3, 8, 7, 6}, // mirrored left to right
+	{6, 7, 8, 3, 4, 5, 0, 1, 2}, // mirrored top to bottom
+	{0, 3, 6, 1, 4, 7, 2, 5, 8}, // across the a1-c3 diagonal
+	{8, 5, 2, 7, 4, 1, 6, 3, 0}, // across the c1-a3 diagonal
+}
+
+// ErrInvalidPosition is wrapped by the errors of ParsePosition and Position.Validate
+var ErrInvalidPosition = errors.New("invalid position")
+
+// PositionOf returns the game's board and whose turn it is
+func PositionOf(g *Game) Position {
+	return Position{Board: g.Board, ToMove: g.CurrentTurn}
+}
+
+// Code encodes the position for URLs, see Position
+func (p Position) Code() string {
+	var b strings.Builder
+	for _, cell := range p.Board {
+		switch cell {
+		case "X":
+			b.WriteByte('x')
+		case "O":
+			b.WriteByte('o')
+		default:
+			b.WriteByte('-')
+		}
+	}
+	b.WriteString(strings.ToLower(p.ToMove))
+	return b.String()
+}
+
+func (p Position) String() string {
+	return p.Code()
+}
+
+// Key encodes the position as a number below MaxPositionKey, see Position
+func (p Position) Key() int {
+	key := 0
+	for _, cell := range p.Board {
+		key *= 3
+		switch cell {
+		case "X":
+			key += 1
+		case "O":
+			key += 2
+		}
+	}
+	key *= 2
+	if p.ToMove == "O" {
+		key++
+	}
+	return key
+}
+
+// PositionFromKey decodes a key made by Key
+func PositionFromKey(key int) (Position, error) {
+	if key < 0 || key >= MaxPositionKey {
+		return Position{}, fmt.Errorf("%w: key must be between 0 and %d", ErrInvalidPosition, MaxPositionKey-1)
+	}
+	p := Position{ToMove: "X"}
+	if key%2 == 1 {
+		p.ToMove = "O"
+	}
+	key /= 2
+	for i := 8; i >= 0; i-- {
+		switch key % 3 {
+		case 1:
+			p.Board[i] = "X"
+		case 2:
+			p.Board[i] = "O"
+		}
+		key /= 3
+	}
+	return p, nil
+}
+
+// ParsePosition reads a code made by Code, or a key written as a number, and validates it
+func ParsePosition(text string) (Position, error) {
+	if key, err := strconv.Atoi(text); err == nil {
+		p, err := PositionFromKey(key)
+		if err != nil {
+			return p, err
+		}
+		return p, p.Validate()
+	}
+
+	text = strings.ToLower(text)
+	if len(text) != 10 {
+		return Position{}, fmt.Errorf("%w: a code is 9 cells (x, o or -) and the side to move (x or o)", ErrInvalidPosition)
+	}
+	var p Position
+	for i := 0; i < 9; i++ {
+		switch text[i] {
+		case 'x':
+			p.Board[i] = "X"
+		case 'o':
+			p.Board[i] = "O"
+		case '-':
+		default:
+			return Position{}, fmt.Errorf("%w: cell %s is %q, use x, o or -", ErrInvalidPosition, Square(i), text[i])
+		}
+	}
+	switch text[9] {
+	case 'x':
+		p.ToMove = "X"
+	case 'o':
+		p.ToMove = "O"
+	default:
+		return Position{}, fmt.Errorf("%w: the side to move is %q, use x or o", ErrInvalidPosition, text[9])
+	}
+	return p, p.Validate()
+}
+
+// Validate checks the position could come up in a game: the counts of X and O are at
+// most one apart and the side with fewer moves is the one to move. positions that are
+// already won or drawn are fine, see Over
+func (p Position) Validate() error {
+	if p.ToMove != "X" && p.ToMove != "O" {
+		return fmt.Errorf("%w: the side to move must be X or O", ErrInvalidPosition)
+	}
+	counts := map[string]int{}
+	for _, cell := range p.Board {
+		if cell != "" && cell != "X" && cell != "O" {
+			return fmt.Errorf("%w: cells must be X, O or empty", ErrInvalidPosition)
+		}
+		counts[cell]++
+	}
+	diff := counts["X"] - counts["O"]
+	if diff < -1 || diff > 1 {
+		return fmt.Errorf("%w: X has %d moves and O %d, they take turns", ErrInvalidPosition, counts["X"], counts["O"])
+	}
+	if (diff == 1 && p.ToMove == "X") || (diff == -1 && p.ToMove == "O") {
+		return fmt.Errorf("%w: %s has played more moves, so it's %s to move", ErrInvalidPosition, p.ToMove, opponent(p.ToMove))
+	}
+	return nil
+}
+
+// Over reports whether the game is already decided in the position, a line or a full board
+func (p Position) Over() bool {
+	g := &Game{Board: p.Board}
+	return len(g.CheckWin("X")) > 0 || len(g.CheckWin("O")) > 0 || g.CheckStalemate()
+}
+
+// Transform returns the position turned or flipped by s
+func (p Position) Transform(s Symmetry) Position {
+	t := Position{ToMove: p.ToMove}
+	for i, from := range symmetries[s] {
+		t.Board[i] = p.Board[from]
+	}
+	return t
+}
+
+// Canonical returns the symmetry of the position with the lowest key, and the symmetry
+// that turns p into it. use s.Original to map a cell of the canonical board back
+func (p Position) Canonical() (Position, Symmetry) {
+	best, bestSymmetry := p, Symmetry(0)
+	bestKey := p.Key()
+	for s := Symmetry(1); s < 8; s++ {
+		t := p.Transform(s)
+		if key := t.Key(); key < bestKey {
+			best, bestSymmetry, bestKey = t, s, key
+		}
+	}
+	return best, bestSymmetry
+}
+
+// CanonicalKey is the key of the canonical position, the same for all 8 symmetries
+func (p Position) CanonicalKey() int {
+	canonical, _ := p.Canonical()
+	return canonical.Key()
+}
+
+// Original maps a cell of a board transformed by s back to the cell it came from
+func (s Symmetry) Original(cell int) int {
+	return symmetries[s][cell]
+}
+
+// Transformed maps a cell of the original board to where s puts it
+func (s Symmetry) Transformed(cell int) int {
+	for i, from := range symmetries[s] {
+		if from == cell {
+			return i
+		}
+	}
+	return -1
+}
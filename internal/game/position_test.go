@@ -0,0 +1,207 @@
+package game
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPositionEncodings(t *testing.T) {
+	tests := []struct {
+		code string
+		key  int
+	}{
+		{"---------x", 0},
+		{"---------o", 1},
+		{"x--------o", 13123}, // X in a1 is 3^8, times two, plus one for O to move
+		{"--------xo", 3},
+		{"x---o----x", 2*(6561+2*81) + 0},
+		{"xoxoxooxxo", 2*(6561+2*2187+729+2*243+81+2*27+2*9+3+1) + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			p, err := ParsePosition(tt.code)
+			if err != nil {
+				t.Fatalf("ParsePosition(%q): %v", tt.code, err)
+			}
+			if got := p.Code(); got != tt.code {
+				t.Errorf("Code() = %q, want %q", got, tt.code)
+			}
+			if got := p.Key(); got != tt.key {
+				t.Errorf("Key() = %d, want %d", got, tt.key)
+			}
+
+			// the key is accepted wherever a code is
+			fromKey, err := ParsePosition(strconv.Itoa(tt.key))
+			if err != nil {
+				t.Fatalf("ParsePosition(%d): %v", tt.key, err)
+			}
+			if fromKey != p {
+				t.Errorf("ParsePosition(%d) = %s, want %s", tt.key, fromKey, p)
+			}
+			// codes can be typed in upper case
+			if upper, err := ParsePosition(strings.ToUpper(tt.code)); err != nil || upper != p {
+				t.Errorf("ParsePosition(%q) = %s, %v", strings.ToUpper(tt.code), upper, err)
+			}
+		})
+	}
+}
+
+// every key below MaxPositionKey decodes to a position that encodes back to it,
+// whether or not the position could come up in a game
+func TestPositionKeysRoundTrip(t *testing.T) {
+	for key := 0; key < MaxPositionKey; key++ {
+		p, err := PositionFromKey(key)
+		if err != nil {
+			t.Fatalf("PositionFromKey(%d): %v", key, err)
+		}
+		if got := p.Key(); got != key {
+			t.Fatalf("PositionFromKey(%d).Key() = %d", key, got)
+		}
+	}
+}
+
+func TestParsePositionInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"too short", "x---o---x"},
+		{"too long", "x---o----xx"},
+		{"bad cell", "x---q----x"},
+		{"bad side to move", "x---o----z"},
+		{"X too far ahead", "xx-------o"},
+		{"O too far ahead", "oo-o-----x"},
+		{"X moved last but moves again", "x--------x"},
+		{"O moved last but moves again", "o--------o"},
+		{"negative key", "-1"},
+		{"key too large", strconv.Itoa(MaxPositionKey)},
+		{"key of an impossible position", strconv.Itoa(2 * (6561 + 2187))}, // xx-------x
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePosition(tt.text)
+			if !errors.Is(err, ErrInvalidPosition) {
+				t.Errorf("ParsePosition(%q) = %s, %v, want ErrInvalidPosition", tt.text, p, err)
+			}
+		})
+	}
+}
+
+func TestPositionOver(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"---------x", false},
+		{"xxxoo----o", true},  // a row
+		{"xo-xo-x--o", true},  // a column
+		{"ox-xo-x-ox", true},  // a diagonal for O
+		{"xoxxoooxxo", true},  // full board
+		{"xx-oo----x", false}, // a line to make, but not made
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePosition(tt.code)
+		if err != nil {
+			t.Fatalf("ParsePosition(%q): %v", tt.code, err)
+		}
+		if got := p.Over(); got != tt.want {
+			t.Errorf("%s.Over() = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+// numbered tells the cells apart, Transform moves them without looking at them
+var numbered = Position{Board: [9]string{"0", "1", "2", "3", "4", "5", "6", "7", "8"}, ToMove: "X"}
+
+func boardString(p Position) string {
+	return strings.Join(p.Board[:], "")
+}
+
+func TestSymmetries(t *testing.T) {
+	// the numbered board after each symmetry, row by row
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"identity", "012345678"},
+		{"quarter turn clockwise", "630741852"},
+		{"half turn", "876543210"},
+		{"quarter turn anticlockwise", "258147036"},
+		{"mirrored left to right", "210543876"},
+		{"mirrored top to bottom", "678345012"},
+		{"across the a1-c3 diagonal", "036147258"},
+		{"across the c1-a3 diagonal", "852741630"},
+	}
+
+	for i, tt := range tests {
+		s := Symmetry(i)
+		t.Run(tt.name, func(t *testing.T) {
+			turned := numbered.Transform(s)
+			if got := boardString(turned); got != tt.want {
+				t.Errorf("Transform(%d) = %s, want %s", s, got, tt.want)
+			}
+			if turned.ToMove != numbered.ToMove {
+				t.Errorf("Transform(%d) changed the side to move to %s", s, turned.ToMove)
+			}
+			for cell := 0; cell < 9; cell++ {
+				if got := s.Original(s.Transformed(cell)); got != cell {
+					t.Errorf("Original(Transformed(%d)) = %d", cell, got)
+				}
+				if turned.Board[s.Transformed(cell)] != numbered.Board[cell] {
+					t.Errorf("Transformed(%d) = %d, but cell %d went to %s", cell, s.Transformed(cell), cell, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSymmetriesCompose(t *testing.T) {
+	quarter := func(p Position) Position { return p.Transform(1) }
+	tests := []struct {
+		name string
+		got  Position
+		want Symmetry
+	}{
+		{"two quarter turns", quarter(quarter(numbered)), 2},
+		{"three quarter turns", quarter(quarter(quarter(numbered))), 3},
+		{"four quarter turns", quarter(quarter(quarter(quarter(numbered)))), 0},
+		{"both mirrors", numbered.Transform(4).Transform(5), 2},
+		{"both diagonals", numbered.Transform(6).Transform(7), 2},
+		{"mirror then quarter turn", quarter(numbered.Transform(4)), 7},
+	}
+
+	for _, tt := range tests {
+		if want := numbered.Transform(tt.want); tt.got != want {
+			t.Errorf("%s = %s, want %s", tt.name, boardString(tt.got), boardString(want))
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	for _, code := range []string{"---------x", "x--------o", "-x-------o", "x---o----x", "xx-oo----x", "x-o-x-o-ox"} {
+		p, err := ParsePosition(code)
+		if err != nil {
+			t.Fatalf("ParsePosition(%q): %v", code, err)
+		}
+		canonical, s := p.Canonical()
+		if p.Transform(s) != canonical {
+			t.Errorf("%s.Canonical() = %s, %d, but the symmetry turns it into %s", p, canonical, s, p.Transform(s))
+		}
+
+		for i := Symmetry(0); i < 8; i++ {
+			turned := p.Transform(i)
+			if turned.Key() < canonical.Key() {
+				t.Errorf("%s has a lower key than its canonical position %s", turned, canonical)
+			}
+			if got := turned.CanonicalKey(); got != canonical.Key() {
+				t.Errorf("%s.CanonicalKey() = %d, %s has %d", turned, got, p, canonical.Key())
+			}
+		}
+	}
+}
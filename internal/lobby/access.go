@@ -0,0 +1,166 @@
+package lobby
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"tictacgo/models"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how long an invite link stays valid after it is handed out
+const inviteTTL = 24 * time.Hour
+
+// key used to sign invite tokens, set INVITE_SECRET so links survive a restart
+var inviteSecret = loadInviteSecret()
+
+func loadInviteSecret() []byte {
+	if secret := os.Getenv("INVITE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	// no secret configured, fall back to a random one (invites die with the process)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("unable to generate invite secret: %v", err))
+	}
+	return secret
+}
+
+// API clients send the passcode in this header, the lobby page posts it in a form.
+// it is never read from the query string, where it would end up in logs and history
+const passcodeHeader = "X-Lobby-Passcode"
+
+// bcrypt ignores anything past 72 bytes, longer passcodes are refused
+const maxPasscodeLength = 72
+
+var ErrPasscodeTooLong = fmt.Errorf("passcode must be at most %d bytes", maxPasscodeLength)
+
+// checkPasscode validates a passcode before a lobby is created with it
+func checkPasscode(passcode string) error {
+	if len(passcode) > maxPasscodeLength {
+		return ErrPasscodeTooLong
+	}
+	return nil
+}
+
+// hashPasscode hashes the passcode with bcrypt, which salts it too
+func hashPasscode(passcode string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passcode), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NewInviteToken signs a token granting access to a lobby until the given time.
+// format is "<unix expiry>.<base64 signature>"
+func NewInviteToken(lobbyID string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + signInvite(lobbyID, expiry)
+}
+
+func signInvite(lobbyID string, expiry string) string {
+	mac := hmac.New(sha256.New, inviteSecret)
+	mac.Write([]byte(lobbyID + ":" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidInviteToken reports whether the token was signed for this lobby and has not expired
+func ValidInviteToken(lobbyID string, token string) bool {
+	expiry, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+
+	expected := signInvite(lobbyID, expiry)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// ValidPasscode compares a passcode against the one stored on the lobby
+func ValidPasscode(lobby *models.Lobby, passcode string) bool {
+	if lobby.PasscodeHash == "" || passcode == "" {
+		return false
+	}
+
+	// lobbies saved before passcodes moved to bcrypt hold sha256(lobbyID:passcode) in hex
+	if !strings.HasPrefix(lobby.PasscodeHash, "$2") {
+		sum := sha256.Sum256([]byte(lobby.ID + ":" + passcode))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(lobby.PasscodeHash)) == 1
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(lobby.PasscodeHash), []byte(passcode))
+	return err == nil
+}
+
+// CanAccess checks a request for a private lobby, public lobbies are always open.
+// access is granted by an "invite" token in the query string, the passcode header,
+// or the per-lobby cookie set by ServeLobby
+func CanAccess(lobby *models.Lobby, r *http.Request) bool {
+	if !lobby.Private {
+		return true
+	}
+
+	if token := r.URL.Query().Get("invite"); token != "" && ValidInviteToken(lobby.ID, token) {
+		return true
+	}
+	if passcode := r.Header.Get(passcodeHeader); passcode != "" && ValidPasscode(lobby, passcode) {
+		return true
+	}
+
+	if cookie, err := r.Cookie(accessCookieName(lobby.ID)); err == nil {
+		return ValidInviteToken(lobby.ID, cookie.Value)
+	}
+
+	return false
+}
+
+// requestScheme is "https" when the request came in over TLS, directly or through a proxy
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	// proxies chaining the header list the client-facing scheme first
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	if strings.EqualFold(strings.TrimSpace(proto), "https") {
+		return "https"
+	}
+	return "http"
+}
+
+func accessCookieName(lobbyID string) string {
+	return "lobby_" + lobbyID
+}
+
+// grantAccess remembers a successful check in a cookie so refreshing the page
+// (and the websocket upgrade that follows) don't need the query string again
+func grantAccess(w http.ResponseWriter, lobbyID string) string {
+	expires := time.Now().Add(inviteTTL)
+	token := NewInviteToken(lobbyID, expires)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookieName(lobbyID),
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return token
+}
@@ -0,0 +1,251 @@
+package lobby
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"tictacgo/internal/chat"
+	"tictacgo/models"
+	"time"
+)
+
+// export formats
+const (
+	ExportJSON = "json"
+	ExportText = "txt"
+	ExportCSV  = "csv"
+)
+
+// Export is a lobby's chat transcript and games, downloaded from /lobby/{id}/export for
+// post-match reviews. chat is what the requester can read, GAMEMASTER events included
+type Export struct {
+	LobbyID    string               `json:"lobbyId"`
+	Name       string               `json:"name"`
+	Settings   models.LobbySettings `json:"settings"`
+	ExportedAt time.Time            `json:"exportedAt"`
+	Chat       []ExportMessage      `json:"chat"`
+	Games      []ExportGame         `json:"games"`
+}
+
+type ExportMessage struct {
+	ID        int        `json:"id"`
+	Timestamp time.Time  `json:"timestamp"`
+	Sender    string     `json:"sender"`
+	SenderID  string     `json:"senderId,omitempty"` // missing for GAMEMASTER events
+	Channel   string     `json:"channel"`            // "all", "players", "spectators" or "whisper"
+	To        string     `json:"to,omitempty"`       // name of a whisper's recipient
+	Text      string     `json:"text"`
+	Emote     bool       `json:"emote,omitempty"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+}
+
+type ExportGame struct {
+	Number  int          `json:"number"`
+	X       string       `json:"x"`
+	O       string       `json:"o"`
+	Variant string       `json:"variant"`
+	Started time.Time    `json:"started"`
+	Ended   *time.Time   `json:"ended,omitempty"` // nil for the game in progress
+	Result  string       `json:"result"`          // "win", "draw", "timeout", "resign" or "in_progress"
+	Winner  string       `json:"winner"`
+	Moves   []ExportMove `json:"moves"`
+}
+
+type ExportMove struct {
+	Number   int       `json:"number"` // counts from 1
+	Symbol   string    `json:"symbol"`
+	Player   string    `json:"player"`
+	Position int       `json:"position"` // 0-8, left to right, top to bottom
+	Time     time.Time `json:"time"`
+}
+
+// ValidExportFormat reports whether format is json, txt or csv
+func ValidExportFormat(format string) bool {
+	return format == ExportJSON || format == ExportText || format == ExportCSV
+}
+
+// BuildExport gathers the lobby's chat as playerID can read it ("" for the all channel
+// only) and its finished games, plus the one in progress
+func BuildExport(lobby *models.Lobby, playerID string) Export {
+	export := Export{
+		LobbyID:    lobby.ID,
+		Name:       lobby.Name,
+		Settings:   lobby.Settings,
+		ExportedAt: time.Now(),
+		Chat:       []ExportMessage{},
+		Games:      []ExportGame{},
+	}
+
+	for _, m := range chat.Transcript(lobby, playerID) {
+		channel := m.Channel
+		if channel == "" {
+			channel = chat.ChannelAll
+		}
+		export.Chat = append(export.Chat, ExportMessage{
+			ID:        m.ID,
+			Timestamp: m.Timestamp,
+			Sender:    m.Sender,
+			SenderID:  m.SenderID,
+			Channel:   channel,
+			To:        m.ToName,
+			Text:      m.Text,
+			Emote:     m.Emote,
+			EditedAt:  m.EditedAt,
+			Deleted:   m.Deleted,
+		})
+	}
+
+	for _, record := range lobby.Games {
+		export.Games = append(export.Games, exportGame(record, true))
+	}
+	if current := CurrentGame(lobby); current != nil {
+		export.Games = append(export.Games, exportGame(*current, false))
+	}
+	return export
+}
+
+func exportGame(record models.GameRecord, finished bool) ExportGame {
+	g := ExportGame{
+		Number:  record.Number,
+		X:       record.X,
+		O:       record.O,
+		Variant: record.Variant,
+		Started: record.Started,
+		Result:  record.Result,
+		Winner:  record.Winner,
+		Moves:   []ExportMove{},
+	}
+	if finished {
+		ended := record.Ended
+		g.Ended = &ended
+	} else {
+		g.Result = "in_progress"
+		g.Winner = "none"
+	}
+	for i, move := range record.Moves {
+		player := record.X
+		if move.Symbol == "O" {
+			player = record.O
+		}
+		g.Moves = append(g.Moves, ExportMove{i + 1, move.Symbol, player, move.Position, move.Time})
+	}
+	return g
+}
+
+// timestamps in text and csv exports
+const exportTimeFormat = "2006-01-02 15:04:05"
+
+// WriteText writes the export as a readable transcript, chat first and then each game
+func WriteText(w io.Writer, export Export) error {
+	fmt.Fprintf(w, "%s (%s)\nExported %s UTC\n\nChat\n", export.Name, export.LobbyID, export.ExportedAt.UTC().Format(exportTimeFormat))
+	if len(export.Chat) == 0 {
+		fmt.Fprintln(w, "  no messages")
+	}
+	for _, m := range export.Chat {
+		fmt.Fprintf(w, "[%s] %s\n", m.Timestamp.UTC().Format(exportTimeFormat), messageLine(m))
+	}
+
+	fmt.Fprintln(w, "\nGames")
+	if len(export.Games) == 0 {
+		fmt.Fprintln(w, "  none played")
+	}
+	for _, g := range export.Games {
+		fmt.Fprintf(w, "Game %d: %s (X) vs %s (O), %s, %s\n", g.Number, g.X, g.O, g.Variant, resultText(g))
+		for _, move := range g.Moves {
+			fmt.Fprintf(w, "  %d. [%s] %s %s plays %d\n", move.Number, move.Time.UTC().Format(exportTimeFormat), move.Symbol, move.Player, move.Position)
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// messageLine is a chat message as one line of a transcript, without its time
+func messageLine(m ExportMessage) string {
+	var channel string
+	switch m.Channel {
+	case chat.ChannelAll:
+	case chat.ChannelWhisper:
+		channel = fmt.Sprintf("(whisper to %s) ", m.To)
+	default:
+		channel = fmt.Sprintf("(%s) ", m.Channel)
+	}
+
+	switch {
+	case m.Deleted:
+		return fmt.Sprintf("%s%s: message deleted", channel, m.Sender)
+	case m.Emote:
+		return fmt.Sprintf("%s* %s %s", channel, m.Sender, m.Text)
+	case m.EditedAt != nil:
+		return fmt.Sprintf("%s%s: %s (edited)", channel, m.Sender, m.Text)
+	}
+	return fmt.Sprintf("%s%s: %s", channel, m.Sender, m.Text)
+}
+
+func resultText(g ExportGame) string {
+	switch g.Result {
+	case "in_progress":
+		return "in progress"
+	case "draw":
+		return "draw"
+	case "timeout":
+		return fmt.Sprintf("%s wins on time", g.Winner)
+	case "resign":
+		return fmt.Sprintf("%s wins by resignation", g.Winner)
+	}
+	return fmt.Sprintf("%s wins", g.Winner)
+}
+
+// WriteCSV writes the export as one timeline: a row per chat message, move and game result
+func WriteCSV(w io.Writer, export Export) error {
+	type row struct {
+		time   time.Time
+		fields []string
+	}
+	var rows []row
+	for _, m := range export.Chat {
+		// players can't post without an ID, only the server's own messages have none
+		kind := "chat"
+		if m.SenderID == "" {
+			kind = "event"
+		}
+		text := m.Text
+		if m.Deleted {
+			text = "message deleted"
+		}
+		rows = append(rows, row{m.Timestamp, []string{kind, "", m.Sender, m.Channel, m.To, "", "", text}})
+	}
+	for _, g := range export.Games {
+		game := strconv.Itoa(g.Number)
+		for _, move := range g.Moves {
+			rows = append(rows, row{move.Time, []string{"move", game, move.Player, "", "", move.Symbol, strconv.Itoa(move.Position), ""}})
+		}
+		if g.Ended != nil {
+			rows = append(rows, row{*g.Ended, []string{"result", game, "", "", "", g.Winner, "", resultText(g)}})
+		}
+	}
+	// chat, moves and results interleaved as they happened
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].time.Before(rows[j].time) })
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"time", "type", "game", "sender", "channel", "to", "symbol", "position", "text"})
+	for _, r := range rows {
+		for i, field := range r.fields {
+			r.fields[i] = csvSafe(field)
+		}
+		out.Write(append([]string{r.time.UTC().Format(time.RFC3339)}, r.fields...))
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// csvSafe keeps spreadsheets from running a cell as a formula, chat is whatever players typed
+func csvSafe(field string) string {
+	if field != "" && strings.ContainsRune("=+-@\t\r", rune(field[0])) {
+		return "'" + field
+	}
+	return field
+}
@@ -0,0 +1,117 @@
+package lobby
+
+import (
+	"strconv"
+	"tictacgo/internal/game"
+	"tictacgo/models"
+	"time"
+)
+
+// finished games kept per lobby, the oldest are dropped first
+const maxGameRecords = 100
+
+// RecordGame adds the game that just ended to the lobby's history, result is the
+// move result that ended it. call it before the game is reset for the next one
+func RecordGame(lobby *models.Lobby, result game.GameMessage) {
+	record := gameRecord(lobby)
+	record.Ended = time.Now()
+	record.Result = result.Next
+	record.Winner = result.Winner
+	record.Termination = result.Termination
+	if record.Termination == "" {
+		record.Termination = game.TerminationBoard
+	}
+
+	lobby.Games = append(lobby.Games, record)
+	if len(lobby.Games) > maxGameRecords {
+		lobby.Games = append([]models.GameRecord{}, lobby.Games[len(lobby.Games)-maxGameRecords:]...)
+	}
+}
+
+// CurrentGame returns the game in progress as a record with no result, nil between games
+func CurrentGame(lobby *models.Lobby) *models.GameRecord {
+	if !lobby.GameStarted {
+		return nil
+	}
+	record := gameRecord(lobby)
+	return &record
+}
+
+func gameRecord(lobby *models.Lobby) models.GameRecord {
+	record := models.GameRecord{
+		Number:    1,
+		Variant:   lobby.Game.Variant,
+		FirstTurn: lobby.Game.FirstTurn,
+		Position:  lobby.Settings.StartPosition,
+		Started:   lobby.Game.Started,
+		Moves:     append([]game.Move{}, lobby.Game.Moves...),
+	}
+	if n := len(lobby.Games); n > 0 {
+		record.Number = lobby.Games[n-1].Number + 1
+	}
+	if p := seatedPlayer(lobby, "X"); p != nil {
+		record.X = p.Name
+	}
+	if p := seatedPlayer(lobby, "O"); p != nil {
+		record.O = p.Name
+	}
+	return record
+}
+
+// FindGame returns the finished game with the given number, nil when it isn't kept
+func FindGame(lobby *models.Lobby, number int) *models.GameRecord {
+	for i := range lobby.Games {
+		if lobby.Games[i].Number == number {
+			return &lobby.Games[i]
+		}
+	}
+	return nil
+}
+
+// Notation turns a finished game into its notation record, see internal/game/notation.go
+func Notation(lobby *models.Lobby, record models.GameRecord) game.Record {
+	r := game.Record{Tags: map[string]string{
+		"Event":     lobby.Name,
+		"Site":      "/lobby/" + lobby.ID,
+		"Date":      record.Started.UTC().Format("2006.01.02"),
+		"X":         record.X,
+		"O":         record.O,
+		"Variant":   record.Variant,
+		"FirstTurn": record.FirstTurn,
+		"Result":    game.ResultFor(record.Winner, true),
+		"Game":      strconv.Itoa(record.Number),
+	}}
+	if r.Tags["FirstTurn"] == "" {
+		r.Tags["FirstTurn"] = "X"
+	}
+	if record.Position != "" {
+		r.Tags["Position"] = record.Position
+	}
+
+	if termination := termination(record); termination != game.TerminationBoard {
+		r.Tags["Termination"] = termination
+	}
+
+	for _, move := range record.Moves {
+		r.Moves = append(r.Moves, move.Position)
+	}
+	return r
+}
+
+// termination is how a finished game ended. older records don't say, for those the
+// result tells resignations and timeouts apart, and a draw on an empty-board start
+// that didn't fill the board was agreed
+func termination(record models.GameRecord) string {
+	if record.Termination != "" {
+		return record.Termination
+	}
+	switch {
+	case record.Result == "resign":
+		return game.TerminationResign
+	case record.Result == "timeout":
+		return game.TerminationTimeout
+	case record.Result == "draw" && record.Position == "" && len(record.Moves) < 9:
+		return game.TerminationAgreed
+	}
+	return game.TerminationBoard
+}
@@ -0,0 +1,238 @@
+package lobby
+
+import (
+	"fmt"
+	"strings"
+	"tictacgo/internal/auth"
+	"tictacgo/models"
+	"time"
+)
+
+// IsHost reports whether the player ID belongs to the lobby host
+func IsHost(lobby *models.Lobby, playerID string) bool {
+	return playerID != "" && lobby.HostID == playerID
+}
+
+// IsBanned reports whether the account has been banned from the lobby
+func IsBanned(lobby *models.Lobby, accountID string) bool {
+	return accountID != "" && lobby.Banned[accountID]
+}
+
+// FindPlayerByName looks up a seated player or spectator by name, ignoring case
+func FindPlayerByName(lobby *models.Lobby, name string) *models.Player {
+	for _, group := range [][]*models.Player{lobby.Players, lobby.Spectators} {
+		for _, p := range group {
+			if strings.EqualFold(p.Name, name) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// FindPlayer looks up a seated player or spectator by ID, returns nil if not found
+func FindPlayer(lobby *models.Lobby, playerID string) *models.Player {
+	for _, p := range lobby.Players {
+		if p.ID == playerID {
+			return p
+		}
+	}
+	for _, p := range lobby.Spectators {
+		if p.ID == playerID {
+			return p
+		}
+	}
+	return nil
+}
+
+// removes a player from the lobby along with their ready state
+func removePlayer(lobby *models.Lobby, playerID string) *models.Player {
+	if p := unseat(lobby, playerID); p != nil {
+		return p
+	}
+	for i, p := range lobby.Spectators {
+		if p.ID == playerID {
+			lobby.Spectators = append(lobby.Spectators[:i], lobby.Spectators[i+1:]...)
+			return p
+		}
+	}
+	return nil
+}
+
+// finds the player sitting in the X or O seat
+func seatedPlayer(lobby *models.Lobby, symbol string) *models.Player {
+	for _, p := range lobby.Players {
+		if p.Symbol == symbol {
+			return p
+		}
+	}
+	return nil
+}
+
+// FreeSeat returns the first empty seat, X before O, or "" when both are taken
+func FreeSeat(lobby *models.Lobby) string {
+	for _, symbol := range []string{"X", "O"} {
+		if seatedPlayer(lobby, symbol) == nil {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// checks shared by every host action, returns the target player
+func hostTarget(lobby *models.Lobby, hostID string, targetID string) (*models.Player, error) {
+	if !IsHost(lobby, hostID) {
+		return nil, fmt.Errorf("only the host can do that")
+	}
+	if targetID == hostID {
+		return nil, fmt.Errorf("you cannot target yourself")
+	}
+	target := FindPlayer(lobby, targetID)
+	if target == nil {
+		return nil, fmt.Errorf("player not found")
+	}
+	return target, nil
+}
+
+// Kick removes a player from the lobby, they are free to join again
+func Kick(lobby *models.Lobby, hostID string, targetID string) (*models.Player, error) {
+	if _, err := hostTarget(lobby, hostID, targetID); err != nil {
+		return nil, err
+	}
+	return removePlayer(lobby, targetID), nil
+}
+
+// Ban removes a player from the lobby and refuses their account when they reconnect,
+// bots by their bot ID
+func Ban(lobby *models.Lobby, hostID string, targetID string) (*models.Player, error) {
+	target, err := hostTarget(lobby, hostID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if lobby.Banned == nil {
+		lobby.Banned = make(map[string]bool)
+	}
+	lobby.Banned[target.ID] = true
+	return removePlayer(lobby, target.ID), nil
+}
+
+// SwapSeats exchanges the X and O players, returns the players whose symbol changed
+func SwapSeats(lobby *models.Lobby, hostID string) ([]*models.Player, error) {
+	if !IsHost(lobby, hostID) {
+		return nil, fmt.Errorf("only the host can do that")
+	}
+	if lobby.GameStarted {
+		return nil, fmt.Errorf("seats cannot be changed during a game")
+	}
+
+	x, o := seatedPlayer(lobby, "X"), seatedPlayer(lobby, "O")
+	var changed []*models.Player
+	if x != nil {
+		x.Symbol = "O"
+		changed = append(changed, x)
+	}
+	if o != nil {
+		o.Symbol = "X"
+		changed = append(changed, o)
+	}
+	return changed, nil
+}
+
+// Promote moves a spectator into a seat. symbol picks the seat, when empty the
+// first free seat is used. whoever sat there before becomes a spectator.
+// returns the players whose symbol changed
+func Promote(lobby *models.Lobby, hostID string, targetID string, symbol string) ([]*models.Player, error) {
+	target, err := hostTarget(lobby, hostID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if lobby.GameStarted {
+		return nil, fmt.Errorf("seats cannot be changed during a game")
+	}
+	if IsSeated(lobby, target.ID) {
+		return nil, fmt.Errorf("%s is not spectating", target.Name)
+	}
+
+	if symbol == "" {
+		symbol = FreeSeat(lobby)
+		if symbol == "" {
+			symbol = "X"
+		}
+	}
+	if symbol != "X" && symbol != "O" {
+		return nil, fmt.Errorf("invalid seat %q", symbol)
+	}
+
+	changed := []*models.Player{target}
+	if occupant := seatedPlayer(lobby, symbol); occupant != nil {
+		// host promotions may take the spectator list over its cap
+		unseat(lobby, occupant.ID)
+		occupant.Symbol = "S"
+		lobby.Spectators = append(lobby.Spectators, occupant)
+		changed = append(changed, occupant)
+	}
+	removePlayer(lobby, target.ID)
+	seat(lobby, target, symbol)
+	return changed, nil
+}
+
+// mutes without a duration last defaultMute, none can last longer than maxMute
+const (
+	defaultMute = 5 * time.Minute
+	maxMute     = 24 * time.Hour
+)
+
+// CanModerate reports whether a player may mute others in the lobby: the host, or an admin
+func CanModerate(lobby *models.Lobby, playerID string) bool {
+	return IsHost(lobby, playerID) || auth.IsAdmin(auth.Find(playerID))
+}
+
+// Mute stops a player chatting in the lobby for a while, returns the player and how long
+func Mute(lobby *models.Lobby, moderatorID string, targetID string, duration time.Duration) (*models.Player, time.Duration, error) {
+	if !CanModerate(lobby, moderatorID) {
+		return nil, 0, fmt.Errorf("only the host can do that")
+	}
+	if targetID == moderatorID {
+		return nil, 0, fmt.Errorf("you cannot target yourself")
+	}
+	target := FindPlayer(lobby, targetID)
+	if target == nil {
+		return nil, 0, fmt.Errorf("player not found")
+	}
+
+	if duration <= 0 {
+		duration = defaultMute
+	}
+	duration = min(duration, maxMute)
+	if lobby.Muted == nil {
+		lobby.Muted = make(map[string]time.Time)
+	}
+	lobby.Muted[targetID] = time.Now().Add(duration)
+	return target, duration, nil
+}
+
+// Unmute lets a muted player chat again
+func Unmute(lobby *models.Lobby, moderatorID string, targetID string) (*models.Player, error) {
+	if !CanModerate(lobby, moderatorID) {
+		return nil, fmt.Errorf("only the host can do that")
+	}
+	target := FindPlayer(lobby, targetID)
+	if target == nil {
+		return nil, fmt.Errorf("player not found")
+	}
+	if _, muted := lobby.Muted[targetID]; !muted {
+		return nil, fmt.Errorf("%s isn't muted", target.Name)
+	}
+	delete(lobby.Muted, targetID)
+	return target, nil
+}
+
+// TransferHost hands host powers to another player in the lobby
+func TransferHost(lobby *models.Lobby, hostID string, targetID string) (*models.Player, error) {
+	target, err := hostTarget(lobby, hostID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	lobby.HostID = target.ID
+	return target, nil
+}
@@ -2,14 +2,19 @@ package lobby
 
 import (
 	"encoding/json" // Used to encode Go data structures into JSON format.
+	"errors"
 	"fmt"
 	"html/template" // Provides functions for parsing and executing HTML templates, allowing the rendering of HTML content with dynamic data.
 	"log"
 	"net/http" // handles http requests
+	"net/url"
 	"os"
+	"strconv"
+	"tictacgo/internal/auth"
 	"tictacgo/internal/chat"
-	"tictacgo/internal/game"
+	"tictacgo/internal/profile"
 	"tictacgo/models"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/google/uuid" // generate uuids
@@ -20,10 +25,27 @@ var redisClient = redis.NewClient(&redis.Options{
 	Addr: os.Getenv("REDIS_ADDRESS"), // Use environment variable
 })
 
+// request body for creating a lobby, the settings fields sit at the top level
+type createLobbyRequest struct {
+	models.LobbySettings
+	Username string `json:"username"` // names the lobby when signed out, the account's name wins otherwise
+	Passcode string `json:"passcode"` // only used for private lobbies
+}
+
+// CreateLobby handles /create-lobby.
+// POST takes a JSON body of settings and answers with the new lobby's ID and URL,
+// GET is the older form using query parameters and redirects to the lobby page
 func CreateLobby(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		createLobbyFromJSON(w, r)
+		return
+	}
 
+	// the lobby is named after the signed in account, the Name parameter is for signed out callers
 	username := r.URL.Query().Get("Name")
-	println(username)
+	if account := auth.CurrentAccount(r); account != nil {
+		username = account.Name
+	}
 
 	if username == "" {
 		// Handle the case where no username is passed (optional)
@@ -31,14 +53,96 @@ func CreateLobby(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read the username from the cookie
-	cookie, err := r.Cookie("Name")
-	if err == nil { // Only access cookie.Value if there is no error
-		username = cookie.Value
+	// private lobbies are only reachable with an invite link here, a passcode
+	// can't be set since it would sit in the URL. POST a JSON body for one
+	settings := DefaultSettings(username)
+	if r.URL.Query().Get("private") == "true" {
+		settings.Visibility = "private"
+	}
+	// shared positions link here to practice them
+	if position := r.URL.Query().Get("position"); position != "" {
+		settings.StartPosition = position
+	}
+	// onboarding links hand out a few hints per game
+	if hints := r.URL.Query().Get("hints"); hints != "" {
+		n, err := strconv.Atoi(hints)
+		if err != nil {
+			http.Error(w, "hints must be a number", http.StatusBadRequest)
+			return
+		}
+		settings.HintsPerGame = n
+	}
+	// the Name parameter isn't checked anywhere else, this catches overlong lobby names too
+	if err := ValidateSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newLobby := NewLobby(settings, "", hostFor(r))
+
+	// redirects the user to the newly created lobby's page
+	http.Redirect(w, r, PageURL(newLobby), http.StatusSeeOther)
+}
+
+func createLobbyFromJSON(w http.ResponseWriter, r *http.Request) {
+	newLobby, err := CreateFromJSON(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       newLobby.ID,
+		"url":      PageURL(newLobby),
+		"settings": newLobby.Settings,
+	})
+}
+
+// CreateFromJSON decodes and validates a create-lobby body, then creates the lobby.
+// errors are safe to show to the client
+func CreateFromJSON(r *http.Request) (*models.Lobby, error) {
+	// start from the defaults so missing fields keep them, the name comes from the body
+	var req createLobbyRequest
+	req.LobbySettings = DefaultSettings("")
+	req.Name = ""
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.New("invalid JSON body")
+	}
+	if account := auth.CurrentAccount(r); account != nil {
+		req.Username = account.Name
 	}
 
-	// creates a new instance of a game using a function defined in the game package.
-	newGame := game.NewGame()
+	// an unnamed lobby is named after its creator
+	if req.Name == "" && req.Username != "" {
+		req.Name = fmt.Sprintf("%s's Lobby", req.Username)
+	}
+
+	if err := ValidateSettings(&req.LobbySettings); err != nil {
+		return nil, err
+	}
+	if err := checkPasscode(req.Passcode); err != nil {
+		return nil, err
+	}
+
+	return NewLobby(req.LobbySettings, req.Passcode, hostFor(r)), nil
+}
+
+// hostFor is the signed in creator of a lobby. without one the lobby is
+// claimed by the first player to sit down
+func hostFor(r *http.Request) string {
+	if account := auth.CurrentAccount(r); account != nil {
+		return account.ID
+	}
+	return ""
+}
+
+// NewLobby creates a lobby from validated settings and registers it in models.Lobbies
+func NewLobby(settings models.LobbySettings, passcode string, hostID string) *models.Lobby {
+	// creates a new instance of a game with the chosen rules
+	newGame := newGameWithSettings(settings)
 
 	// enerates a unique ID for the new lobby using UUID.
 	lobbyID := uuid.New().String()
@@ -46,138 +150,283 @@ func CreateLobby(w http.ResponseWriter, r *http.Request) {
 	// A new models.Lobby is created with a unique lobbyID, a name, max of 2 players (MaxPlayers: 2), and the newly created game (Game: newGame).
 	// & goes in front of a variable when you want to get that variable's memory address
 	newLobby := &models.Lobby{
-		ID:           lobbyID,
-		Name:         fmt.Sprintf("%s's Lobby", username),
-		MaxPlayers:   2,
-		Game:         newGame, // Initialize the Game here
-		Players:      []*models.Player{},
-		ReadyPlayers: make(map[string]bool), // ✅ Initialize the map
-		ChatMessages: []models.ChatMessage{},
+		ID:              lobbyID,
+		Name:            settings.Name,
+		MaxPlayers:      2,
+		Game:            newGame, // Initialize the Game here
+		Players:         []*models.Player{},
+		Spectators:      []*models.Player{},
+		MaxSpectators:   settings.SpectatorLimit,
+		ReadyPlayers:    make(map[string]bool), // ✅ Initialize the map
+		ChatMessages:    []models.ChatMessage{},
+		ChannelMessages: make(map[string][]models.ChatMessage),
+		Private:         settings.Visibility == "private",
+		HostID:          hostID,
+		Banned:          make(map[string]bool),
+		Settings:        settings,
+		SeriesScore:     make(map[string]int),
+	}
+
+	if newLobby.Private && passcode != "" {
+		// the lobby stays reachable by invite link if hashing fails
+		hash, err := hashPasscode(passcode)
+		if err != nil {
+			log.Printf("Error hashing passcode for lobby %s: %v", lobbyID, err)
+		}
+		newLobby.PasscodeHash = hash
 	}
 
 	// stores the newly created lobby in a global
+	models.LobbiesMu.Lock()
 	models.Lobbies[lobbyID] = newLobby
+	models.LobbiesMu.Unlock()
+	return newLobby
+}
 
-	// redirects the user to the newly created lobby's page
-	http.Redirect(w, r, "/lobby/"+lobbyID, http.StatusSeeOther)
+// PageURL is the page for a new lobby,
+// the creator of a private lobby gets an invite token so they are let straight in
+func PageURL(lobby *models.Lobby) string {
+	if !lobby.Private {
+		return "/lobby/" + lobby.ID
+	}
+	token := NewInviteToken(lobby.ID, time.Now().Add(inviteTTL))
+	return "/lobby/" + lobby.ID + "?invite=" + url.QueryEscape(token)
+}
+
+// ErrNotFound is returned by Load when a lobby is neither in memory nor in Redis
+var ErrNotFound = errors.New("lobby not found")
+
+// Load returns a lobby from memory, falling back to the copy stored in Redis
+func Load(lobbyID string) (*models.Lobby, error) {
+	// Check if the lobby exists in memory
+	lobby, exists := Lookup(lobbyID)
+	if exists {
+		return lobby, nil
+	}
+
+	// Fetch from Redis if not in memory
+	lobbyData, err := redisClient.Get("lobby:" + lobbyID).Result()
+	if err != nil {
+		log.Printf("Lobby %s not found in Redis: %v", lobbyID, err)
+		return nil, ErrNotFound
+	}
+
+	// Create a new pointer for the lobby
+	lobby = &models.Lobby{}
+	if err := json.Unmarshal([]byte(lobbyData), lobby); err != nil { // <-- FIXED
+		return nil, fmt.Errorf("decoding lobby %s: %w", lobbyID, err)
+	}
+	// lobbies saved before there was a spectator limit don't have one, 0 would turn
+	// every spectator away. a saved 0 is a lobby that disabled spectating
+	var saved struct {
+		MaxSpectators *int
+		// chat was in the blob before it got its own keys
+		ChatMessages    []models.ChatMessage
+		ChannelMessages map[string][]models.ChatMessage
+	}
+	if err := json.Unmarshal([]byte(lobbyData), &saved); err == nil {
+		if saved.MaxSpectators == nil {
+			lobby.MaxSpectators = DefaultMaxSpectators
+		}
+		legacy := saved.ChatMessages
+		for _, messages := range saved.ChannelMessages {
+			legacy = append(legacy, messages...)
+		}
+		chat.Migrate(lobbyID, legacy)
+	}
+	// chat isn't in the blob, it has its own keys
+	chat.Load(lobby)
+
+	// Store in models.Lobbies so it persists in memory,
+	// unless another request loaded it first while this one was reading Redis
+	models.LobbiesMu.Lock()
+	defer models.LobbiesMu.Unlock()
+	if loaded, exists := models.Lobbies[lobbyID]; exists {
+		return loaded, nil
+	}
+	models.Lobbies[lobbyID] = lobby
+	return lobby, nil
 }
 
 func ServeLobby(w http.ResponseWriter, r *http.Request) {
 	lobbyID := r.URL.Path[len("/lobby/"):]
 
-	// Check if the lobby exists in memory
-	lobby, exists := models.Lobbies[lobbyID]
-	if !exists {
-		// Fetch from Redis if not in memory
-		lobbyData, err := redisClient.Get("lobby:" + lobbyID).Result()
-		if err != nil {
-			log.Printf("Lobby %s not found in Redis: %v", lobbyID, err)
-			http.NotFound(w, r)
+	lobby, err := Load(lobbyID)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Printf("Error loading lobby %s: %v", lobbyID, err)
+		http.Error(w, "Failed to load lobby", http.StatusInternalServerError)
+		return
+	}
+
+	// page data, InviteURL is only set for private lobbies
+	page := struct {
+		*models.Lobby
+		InviteURL string
+		SignedIn  bool // visitors without an account (e.g. following an invite link) are made a guest by the page
+	}{Lobby: lobby, SignedIn: auth.CurrentAccount(r) != nil}
+
+	if lobby.Private {
+		// the passcode form posts back here, a right passcode sets the access cookie
+		if r.Method == http.MethodPost {
+			if ValidPasscode(lobby, r.PostFormValue("passcode")) {
+				grantAccess(w, lobby.ID)
+				http.Redirect(w, r, "/lobby/"+lobby.ID, http.StatusSeeOther)
+				return
+			}
+			servePasscodeForm(w, lobby, "Wrong passcode, try again")
 			return
 		}
 
-		// Create a new pointer for the lobby
-		lobby = &models.Lobby{}
-		if err := json.Unmarshal([]byte(lobbyData), lobby); err != nil { // <-- FIXED
-			log.Printf("Error decoding lobby %s: %v", lobbyID, err)
-			http.Error(w, "Failed to load lobby", http.StatusInternalServerError)
+		if !CanAccess(lobby, r) {
+			servePasscodeForm(w, lobby, "")
 			return
 		}
 
-		// Store in models.Lobbies so it persists in memory
-		models.Lobbies[lobbyID] = lobby
+		// refresh the access cookie and hand out a fresh link to share
+		token := grantAccess(w, lobby.ID)
+		page.InviteURL = fmt.Sprintf("%s://%s/lobby/%s?invite=%s", requestScheme(r), r.Host, lobby.ID, url.QueryEscape(token))
 	}
 
 	// Render the lobby page
 	tmpl, _ := template.ParseFiles("./web/templates/lobby.html")
-	tmpl.Execute(w, lobby)
+	tmpl.Execute(w, page)
 }
 
-// AssignAndNotifyPlayer assigns a symbol to a player and notifies the lobby
-func AssignAndNotifyPlayer(lobby *models.Lobby, ws *websocket.Conn, username string, id string, lobbyConnections map[string][]*websocket.Conn) {
-
-	var player *models.Player
-
-	// Check if an ID is provided
-	if id != "" {
-		// Search for an existing player with the given ID
-		for _, existingPlayer := range lobby.Players {
-			if existingPlayer.ID == id {
-				// Player found, send assignPlayer message without modifying lobby.Players
-				messageToUser := map[string]interface{}{
-					"type":     "assignPlayer",
-					"username": existingPlayer.Name,
-					"symbol":   existingPlayer.Symbol,
-					"id":       existingPlayer.ID,
-				}
-				sendJSON(ws, messageToUser)
-				return // Exit function, no further processing needed
-			}
-		}
-		// If ID is provided but no match is found, proceed as new player with given ID
-		player = &models.Player{ID: id, Name: username, Ready: false}
-	} else {
-		// No ID provided, generate a new one
-		playerID := uuid.New().String()
-		player = &models.Player{ID: playerID, Name: username, Ready: false}
-	}
-
-	// Assign symbol based on number of players
-	if len(lobby.Players) < 2 {
-		symbol := "X"
-		if len(lobby.Players) == 1 {
-			symbol = "O"
-		}
-		player.Symbol = symbol
-		lobby.Players = append(lobby.Players, player)
-
-		// Notify the new player
-		messageToUser := map[string]interface{}{
-			"type":     "assignPlayer",
-			"username": player.Name,
-			"symbol":   player.Symbol,
-			"id":       player.ID,
-		}
-		sendJSON(ws, messageToUser)
+// servePasscodeForm answers a visitor without access to a private lobby with a form asking for the passcode
+func servePasscodeForm(w http.ResponseWriter, lobby *models.Lobby, problem string) {
+	page := struct {
+		ID      string
+		Name    string
+		Problem string
+	}{ID: lobby.ID, Name: lobby.Name, Problem: problem}
+
+	w.WriteHeader(http.StatusForbidden)
+	tmpl, _ := template.ParseFiles("./web/templates/passcode.html")
+	tmpl.Execute(w, page)
+}
 
-		// Notify chat about the new player
-		gameMasterMessage := map[string]interface{}{
-			"type":   "chat",
-			"sender": "GAMEMASTER",
-			"text":   fmt.Sprintf("%v has joined the game!", player.Name),
-		}
-		chat.HandleChatMessage(lobby.ID, gameMasterMessage, lobbyConnections)
-
-	} else {
-		// Assign additional connections as spectators
-		player.Symbol = "S"
-		lobby.Players = append(lobby.Players, player)
-
-		playerAssign := map[string]interface{}{
-			"type":     "assignPlayer",
-			"username": player.Name,
-			"symbol":   player.Symbol,
-			"id":       player.ID,
+// reasons a player is turned away by Join
+var (
+	ErrBanned    = errors.New("you have been banned from this lobby")
+	ErrLobbyFull = errors.New("the lobby is full and has no room for more spectators")
+	ErrNoAccount = errors.New("sign in or play as a guest before joining a lobby")
+)
+
+// Join adds the signed in account to the lobby, seated if there is a free seat and
+// spectating otherwise. the account ID is the player ID, so bans stick to the account.
+// a known ID gets their existing player back, joined is false in that case
+func Join(lobby *models.Lobby, username string, accountID string) (player *models.Player, joined bool, err error) {
+	if accountID == "" {
+		return nil, false, ErrNoAccount
+	}
+	// banned players are refused no matter how they reconnect
+	if IsBanned(lobby, accountID) {
+		return nil, false, ErrBanned
+	}
+
+	// Search for an existing player with the given ID
+	if existingPlayer := FindPlayer(lobby, accountID); existingPlayer != nil {
+		// Player found, no changes to the lobby needed
+		return existingPlayer, false, nil
+	}
+	player = &models.Player{ID: accountID, Name: username, Ready: false}
+
+	// Assign the first free seat, X before O
+	if symbol := FreeSeat(lobby); symbol != "" {
+		seat(lobby, player, symbol)
+
+		// lobbies created without a known creator are claimed by the first to sit down
+		if lobby.HostID == "" {
+			lobby.HostID = player.ID
 		}
+		return player, true, nil
+	}
+
+	// No seats and no room to watch
+	if spectatorsFull(lobby) {
+		return nil, false, ErrLobbyFull
+	}
 
-		sendJSON(ws, playerAssign)
-		// Notify spectator
-		messageToUser := map[string]interface{}{
+	// Assign additional players as spectators
+	player.Symbol = "S"
+	lobby.Spectators = append(lobby.Spectators, player)
+	return player, true, nil
+}
+
+// AssignAndNotifyPlayer assigns a symbol to a player and notifies the lobby
+// returns the player bound to this connection, nil if they were turned away (banned or full)
+func AssignAndNotifyPlayer(lobby *models.Lobby, ws *websocket.Conn, username string, id string, lobbyConnections map[string][]*websocket.Conn) *models.Player {
+	player, joined, err := Join(lobby, username, id)
+	if errors.Is(err, ErrBanned) {
+		sendJSON(ws, map[string]interface{}{
+			"type": "banned",
+			"text": "You have been banned from this lobby.",
+		})
+		return nil
+	} else if errors.Is(err, ErrLobbyFull) {
+		// turn the connection away
+		sendJSON(ws, map[string]interface{}{
 			"type":     "lobbyFull",
-			"userName": player.Name,
-			"text":     "The lobby is full, you are now spectating.",
-			"ID":       player.ID,
-		}
-		sendJSON(ws, messageToUser)
+			"userName": username,
+			"text":     "The lobby is full and has no room for more spectators.",
+		})
+		return nil
+	} else if err != nil {
+		sendJSON(ws, map[string]interface{}{
+			"type": "error",
+			"text": err.Error(),
+		})
+		return nil
+	}
 
-		// Notify chat about the spectator
-		gameMasterMessage := map[string]interface{}{
-			"type":   "chat",
-			"sender": "GAMEMASTER",
-			"text":   fmt.Sprintf("%v is now spectating!", player.Name),
-		}
-		chat.HandleChatMessage(lobby.ID, gameMasterMessage, lobbyConnections)
+	// Notify the player
+	sendJSON(ws, AssignPlayerMessage(lobby, player))
 
+	if joined {
+		AnnounceJoin(lobby, player, lobbyConnections)
+	}
+	return player
+}
+
+// AnnounceJoin tells the lobby chat a new player sat down or started spectating,
+// sending everyone their profile first so the chat can show it
+func AnnounceJoin(lobby *models.Lobby, player *models.Player, lobbyConnections map[string][]*websocket.Conn) {
+	profileMessage := map[string]interface{}{
+		"type":    "profile",
+		"profile": profile.For(player),
+		"symbol":  player.Symbol, // "S" for spectators
+	}
+	for _, conn := range lobbyConnections[lobby.ID] {
+		sendJSON(conn, profileMessage)
+	}
+
+	text := fmt.Sprintf("%v has joined the game!", player.Name)
+	if !IsSeated(lobby, player.ID) {
+		text = fmt.Sprintf("%v is now spectating!", player.Name)
+	}
+
+	gameMasterMessage := map[string]interface{}{
+		"type":   "chat",
+		"sender": "GAMEMASTER",
+		"text":   text,
+	}
+	chat.HandleChatMessage(lobby.ID, gameMasterMessage, lobbyConnections)
+}
+
+// AssignPlayerMessage builds the assignPlayer message telling a client who they are
+func AssignPlayerMessage(lobby *models.Lobby, player *models.Player) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "assignPlayer",
+		"username": player.Name,
+		"symbol":   player.Symbol,
+		"id":       player.ID,
+		"isHost":   IsHost(lobby, player.ID),
+		"role":     Role(lobby, player.ID),
+		"canReady": IsSeated(lobby, player.ID), // spectators never get a ready button
+		"profile":  profile.For(player),
 	}
 }
 
@@ -195,7 +444,24 @@ func sendJSON(ws *websocket.Conn, msg map[string]interface{}) {
 	}
 }
 
-func fetchLobbiesFromRedis() ([]models.Lobby, error) {
+// LobbySummary is a lobby as listed by /lobbies. the field names are the ones clients
+// have always read, the rest of models.Lobby (host, bans, mutes, passcode hash) stays on the server
+type LobbySummary struct {
+	ID         string
+	Name       string
+	MaxPlayers int
+	Players    []PlayerSummary
+	Settings   models.LobbySettings
+}
+
+// PlayerSummary is a seated player in a LobbySummary
+type PlayerSummary struct {
+	ID     string
+	Name   string
+	Symbol string
+}
+
+func fetchLobbiesFromRedis() ([]LobbySummary, error) {
 	// Get all keys matching "lobby:*"
 	keys, err := redisClient.Keys("lobby:*").Result()
 	if err != nil {
@@ -203,7 +469,7 @@ func fetchLobbiesFromRedis() ([]models.Lobby, error) {
 	}
 
 	// create variable to store lobbies in
-	var lobbies []models.Lobby
+	lobbies := []LobbySummary{}
 	for _, key := range keys {
 		// Fetch data from Redis
 		data, err := redisClient.Get(key).Result()
@@ -218,8 +484,16 @@ func fetchLobbiesFromRedis() ([]models.Lobby, error) {
 			log.Printf("Error unmarshalling %s: %v", key, err)
 			continue
 		}
+		// private lobbies are never listed, and puzzle lobbies are for one player
+		if lobby.Private || lobby.Settings.Puzzle != 0 {
+			continue
+		}
 		// add parsed lobby to list of lobbies
-		lobbies = append(lobbies, lobby)
+		summary := LobbySummary{ID: lobby.ID, Name: lobby.Name, MaxPlayers: lobby.MaxPlayers, Players: []PlayerSummary{}, Settings: lobby.Settings}
+		for _, p := range lobby.Players {
+			summary.Players = append(summary.Players, PlayerSummary{ID: p.ID, Name: p.Name, Symbol: p.Symbol})
+		}
+		lobbies = append(lobbies, summary)
 	}
 
 	return lobbies, nil
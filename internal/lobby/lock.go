@@ -0,0 +1,60 @@
+package lobby
+
+import (
+	"sync"
+	"tictacgo/models"
+)
+
+// every change to a lobby (websocket messages, REST calls, bot moves, timers) runs
+// holding the lobby's lock, so two moves can't land on the same turn. the locks live
+// here and not in models.Lobby since lobbies get copied around by value
+
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*sync.Mutex)
+)
+
+// Lock takes the lobby's lock and returns the func releasing it.
+// it isn't reentrant, take it where a request comes in and not in the helpers it calls
+func Lock(lobbyID string) (unlock func()) {
+	locksMu.Lock()
+	mu, ok := locks[lobbyID]
+	if !ok {
+		mu = &sync.Mutex{}
+		locks[lobbyID] = mu
+	}
+	locksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Lookup returns the lobby from memory
+func Lookup(lobbyID string) (*models.Lobby, bool) {
+	models.LobbiesMu.RLock()
+	defer models.LobbiesMu.RUnlock()
+	currentLobby, ok := models.Lobbies[lobbyID]
+	return currentLobby, ok
+}
+
+// All returns the lobbies in memory
+func All() []*models.Lobby {
+	models.LobbiesMu.RLock()
+	defer models.LobbiesMu.RUnlock()
+	lobbies := make([]*models.Lobby, 0, len(models.Lobbies))
+	for _, l := range models.Lobbies {
+		lobbies = append(lobbies, l)
+	}
+	return lobbies
+}
+
+// Forget removes a closed lobby and its lock from memory
+func Forget(lobbyID string) {
+	models.LobbiesMu.Lock()
+	delete(models.Lobbies, lobbyID)
+	models.LobbiesMu.Unlock()
+
+	locksMu.Lock()
+	delete(locks, lobbyID)
+	locksMu.Unlock()
+}
@@ -0,0 +1,58 @@
+package lobby
+
+import (
+	"fmt"
+	"tictacgo/internal/puzzle"
+	"tictacgo/models"
+)
+
+// A puzzle lobby is an ordinary lobby set up for one player: it starts from the puzzle's
+// position, the solver sits in the seat that defends and is always ready, and the player
+// who joins takes the seat with the move. every game in it is an attempt
+
+// the solver's seat in puzzle lobbies, it plays in the server and not over the bot API
+const (
+	SolverID   = "solver"
+	SolverName = "Solver"
+)
+
+// NewPuzzleLobby creates a lobby for a puzzle, /lobbies doesn't list it
+func NewPuzzleLobby(p *puzzle.Puzzle, hostID string) *models.Lobby {
+	settings := DefaultSettings("")
+	settings.Name = fmt.Sprintf("Puzzle %d", p.ID)
+	settings.StartPosition = p.Position.Code()
+	settings.FirstMove = p.Position.ToMove
+	settings.Puzzle = p.ID
+
+	lobby := NewLobby(settings, "", hostID)
+	seat(lobby, &models.Player{ID: SolverID, Name: SolverName, IsBot: true, Ready: true}, opponentSymbol(p.Position.ToMove))
+	lobby.ReadyPlayers[SolverName] = true
+	return lobby
+}
+
+// PuzzleSolved reports whether a finished game in a puzzle lobby won the puzzle: the side
+// to move won, in no more moves than the puzzle allows
+func PuzzleSolved(p *puzzle.Puzzle, record models.GameRecord) bool {
+	if record.Winner != p.Position.ToMove {
+		return false
+	}
+	moves := 0
+	for _, m := range record.Moves {
+		if m.Symbol == p.Position.ToMove {
+			moves++
+		}
+	}
+	return moves <= p.WinIn
+}
+
+// PuzzlePlayer returns the player attempting the puzzle, nil when the seat is empty. only
+// the host, who opened the puzzle, attempts it: a spectator who takes the seat after they
+// leave it plays for practice and isn't rated
+func PuzzlePlayer(lobby *models.Lobby) *models.Player {
+	for _, p := range lobby.Players {
+		if p.ID != SolverID && IsHost(lobby, p.ID) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package lobby
+
+import (
+	"fmt"
+	"strings"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+	"tictacgo/models"
+)
+
+// A review replays a finished game through the solver and marks the moves that threw
+// away a better result. it is shown on request (/review, the REST API) and announced
+// after every game in lobbies with the postGameReview setting
+
+// marks given to moves, from least to most costly
+const (
+	MarkInaccuracy = "inaccuracy" // still winning, but slower than the best move
+	MarkMistake    = "mistake"    // a win turned into a draw, or a draw into a loss
+	MarkBlunder    = "blunder"    // a win turned into a loss
+)
+
+// ReviewedMove is a move of a game next to the best one available
+type ReviewedMove struct {
+	Number    int
+	Symbol    string
+	Player    string
+	Position  int
+	Played    bot.Evaluation // what the move led to for its player
+	Best      bot.Evaluation // the best any move could do
+	BestMoves []int          // every move that would have done as well as Best
+	Mark      string         // "" for a good move
+}
+
+// Review replays a finished game and grades every move
+func Review(record models.GameRecord) []ReviewedMove {
+	position := game.Position{ToMove: record.FirstTurn}
+	if record.Position != "" {
+		// only valid positions are saved as a lobby's start position
+		position, _ = game.ParsePosition(record.Position)
+	}
+	if position.ToMove == "" {
+		position.ToMove = "X"
+	}
+
+	var reviewed []ReviewedMove
+	for i, move := range record.Moves {
+		r := ReviewedMove{Number: i + 1, Symbol: move.Symbol, Player: record.X, Position: move.Position}
+		if move.Symbol == "O" {
+			r.Player = record.O
+		}
+		// whose move it was comes straight from the record
+		position.ToMove = move.Symbol
+
+		for _, m := range bot.Analyze(position, record.Variant) {
+			if m.Best {
+				r.Best = m.Evaluation
+				r.BestMoves = append(r.BestMoves, m.Position)
+			}
+			if m.Position == move.Position {
+				r.Played = m.Evaluation
+			}
+		}
+		r.Mark = mark(r.Played, r.Best)
+		reviewed = append(reviewed, r)
+
+		position.Board[move.Position] = move.Symbol
+	}
+	return reviewed
+}
+
+func mark(played bot.Evaluation, best bot.Evaluation) string {
+	switch {
+	case best.Outcome == bot.OutcomeWin && played.Outcome == bot.OutcomeLoss:
+		return MarkBlunder
+	case best.Outcome != played.Outcome:
+		return MarkMistake
+	case best.Outcome == bot.OutcomeWin && played.Moves > best.Moves:
+		return MarkInaccuracy
+	}
+	return ""
+}
+
+// ReviewText sums up a review for chat, one line per marked move
+func ReviewText(record models.GameRecord, reviewed []ReviewedMove) []string {
+	lines := []string{fmt.Sprintf("Review of game %d, %s (X) vs %s (O):", record.Number, record.X, record.O)}
+	for _, r := range reviewed {
+		if r.Mark == "" {
+			continue
+		}
+		var best []string
+		for _, position := range r.BestMoves {
+			best = append(best, game.Square(position))
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s %s played %s, a %s: it %s where %s %s.",
+			r.Number, r.Symbol, r.Player, game.Square(r.Position), r.Mark,
+			EvaluationText(r.Played), strings.Join(best, " or "), EvaluationText(r.Best)))
+	}
+	if len(lines) == 1 {
+		lines = append(lines, "No mistakes, both players played perfectly.")
+	}
+	return lines
+}
+
+// EvaluationText reads an evaluation out for chat, also used for hints, e.g. "wins in 3"
+func EvaluationText(e bot.Evaluation) string {
+	switch e.Outcome {
+	case bot.OutcomeWin:
+		return fmt.Sprintf("wins in %d", e.Moves)
+	case bot.OutcomeLoss:
+		return fmt.Sprintf("loses in %d", e.Moves)
+	}
+	return "draws"
+}
@@ -0,0 +1,180 @@
+package lobby
+
+import (
+	"fmt"
+	"strings"
+	"tictacgo/internal/game"
+	"tictacgo/models"
+	"time"
+)
+
+// limits enforced on lobby settings
+const (
+	maxLobbyNameLength = 40
+	maxTimeControl     = 60 * 60 // one hour per player
+	maxSpectatorLimit  = 50
+	maxSeriesLength    = 9
+	maxHintsPerGame    = 5
+)
+
+// DefaultSettings are used for anything the creator leaves out
+func DefaultSettings(username string) models.LobbySettings {
+	return models.LobbySettings{
+		Name:           fmt.Sprintf("%s's Lobby", username),
+		Variant:        game.VariantClassic,
+		BoardSize:      3,
+		TimeControl:    0,
+		Visibility:     "public",
+		SpectatorLimit: DefaultMaxSpectators,
+		ChatEnabled:    true,
+		SeriesLength:   1,
+		FirstMove:      "X",
+	}
+}
+
+// ValidateSettings checks settings sent by a client, trimming the name in place
+func ValidateSettings(settings *models.LobbySettings) error {
+	settings.Name = strings.TrimSpace(settings.Name)
+	if settings.Name == "" || len(settings.Name) > maxLobbyNameLength {
+		return fmt.Errorf("name must be between 1 and %d characters", maxLobbyNameLength)
+	}
+
+	if settings.Variant != game.VariantClassic && settings.Variant != game.VariantMisere {
+		return fmt.Errorf("variant must be %q or %q", game.VariantClassic, game.VariantMisere)
+	}
+
+	// the board is a fixed 3x3 grid for now
+	if settings.BoardSize != 3 {
+		return fmt.Errorf("boardSize must be 3")
+	}
+
+	if settings.TimeControl < 0 || settings.TimeControl > maxTimeControl {
+		return fmt.Errorf("timeControl must be between 0 and %d seconds", maxTimeControl)
+	}
+
+	if settings.Visibility != "public" && settings.Visibility != "private" {
+		return fmt.Errorf("visibility must be \"public\" or \"private\"")
+	}
+
+	if settings.SpectatorLimit < 0 || settings.SpectatorLimit > maxSpectatorLimit {
+		return fmt.Errorf("spectatorLimit must be between 0 and %d", maxSpectatorLimit)
+	}
+
+	if settings.SeriesLength < 1 || settings.SeriesLength > maxSeriesLength || settings.SeriesLength%2 == 0 {
+		return fmt.Errorf("seriesLength must be an odd number between 1 and %d", maxSeriesLength)
+	}
+
+	switch settings.FirstMove {
+	case "X", "O", "alternate":
+	default:
+		return fmt.Errorf("firstMove must be \"X\", \"O\" or \"alternate\"")
+	}
+
+	if settings.HintsPerGame < 0 || settings.HintsPerGame > maxHintsPerGame {
+		return fmt.Errorf("hintsPerGame must be between 0 and %d", maxHintsPerGame)
+	}
+	// hints are for casual games
+	if settings.Rated && settings.HintsPerGame > 0 {
+		return fmt.Errorf("rated lobbies can't give hints, set hintsPerGame to 0")
+	}
+
+	// puzzle lobbies come from NewPuzzleLobby, which seats the solver
+	if settings.Puzzle != 0 {
+		return fmt.Errorf("puzzle lobbies are started from /puzzle, not created")
+	}
+
+	// practice lobbies start every game from the same position, which says who moves first
+	if settings.StartPosition != "" {
+		position, err := game.ParsePosition(settings.StartPosition)
+		if err != nil {
+			return fmt.Errorf("startPosition: %v", err)
+		}
+		if position.Over() {
+			return fmt.Errorf("startPosition is already won or drawn")
+		}
+		if settings.FirstMove == "alternate" {
+			return fmt.Errorf("firstMove can't alternate from a startPosition, the position says whose turn it is")
+		}
+		settings.StartPosition = position.Code()
+		settings.FirstMove = position.ToMove
+	}
+
+	return nil
+}
+
+// applies validated settings to a fresh game
+func newGameWithSettings(settings models.LobbySettings) *game.Game {
+	g := game.NewGame()
+	g.Variant = settings.Variant
+	g.TimeControl = time.Duration(settings.TimeControl) * time.Second
+
+	// alternating series open with X, RecordResult flips it after each game
+	if settings.FirstMove == "O" {
+		g.FirstTurn = "O"
+	}
+	g.CurrentTurn = g.FirstTurn
+
+	if settings.StartPosition != "" {
+		// checked by ValidateSettings
+		position, _ := game.ParsePosition(settings.StartPosition)
+		g.SetStartPosition(position)
+	}
+	return g
+}
+
+// RecordResult updates the series after a game, winner is "X", "O" or "none" for a draw.
+// returns a GAMEMASTER announcement when the series is decided, "" otherwise
+func RecordResult(lobby *models.Lobby, winner string) string {
+	if lobby.Settings.FirstMove == "alternate" {
+		lobby.Game.FirstTurn = opponentSymbol(lobby.Game.FirstTurn)
+		lobby.Game.CurrentTurn = lobby.Game.FirstTurn
+	}
+
+	// single games aren't a series
+	if lobby.Settings.SeriesLength <= 1 {
+		return ""
+	}
+
+	if lobby.SeriesScore == nil {
+		lobby.SeriesScore = make(map[string]int)
+	}
+	lobby.SeriesGames++
+
+	var champion *models.Player
+	if p := seatedPlayer(lobby, winner); p != nil {
+		lobby.SeriesScore[p.ID]++
+		if lobby.SeriesScore[p.ID] > lobby.Settings.SeriesLength/2 {
+			champion = p
+		}
+	}
+
+	if champion == nil && lobby.SeriesGames < lobby.Settings.SeriesLength {
+		return ""
+	}
+
+	// out of games, whoever is ahead takes it
+	if champion == nil {
+		x, o := seatedPlayer(lobby, "X"), seatedPlayer(lobby, "O")
+		if x != nil && o != nil && lobby.SeriesScore[x.ID] != lobby.SeriesScore[o.ID] {
+			champion = x
+			if lobby.SeriesScore[o.ID] > lobby.SeriesScore[x.ID] {
+				champion = o
+			}
+		}
+	}
+
+	// series decided, start the next one from scratch
+	lobby.SeriesScore = make(map[string]int)
+	lobby.SeriesGames = 0
+	if champion == nil {
+		return fmt.Sprintf("The best of %d series ends without a winner!", lobby.Settings.SeriesLength)
+	}
+	return fmt.Sprintf("%v wins the best of %d series!", champion.Name, lobby.Settings.SeriesLength)
+}
+
+func opponentSymbol(symbol string) string {
+	if symbol == "X" {
+		return "O"
+	}
+	return "X"
+}
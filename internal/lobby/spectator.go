@@ -0,0 +1,104 @@
+package lobby
+
+import (
+	"fmt"
+	"tictacgo/models"
+)
+
+// spectators allowed per lobby unless configured otherwise
+const DefaultMaxSpectators = 10
+
+// IsSeated reports whether the player holds the X or O seat
+func IsSeated(lobby *models.Lobby, playerID string) bool {
+	for _, p := range lobby.Players {
+		if p.ID == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Role describes how a player takes part in the lobby, "player" or "spectator"
+func Role(lobby *models.Lobby, playerID string) string {
+	if IsSeated(lobby, playerID) {
+		return "player"
+	}
+	return "spectator"
+}
+
+// spectatorsFull reports whether the lobby has hit its spectator cap
+func spectatorsFull(lobby *models.Lobby) bool {
+	return len(lobby.Spectators) >= lobby.MaxSpectators
+}
+
+// puts a player into the given seat
+func seat(lobby *models.Lobby, player *models.Player, symbol string) {
+	player.Symbol = symbol
+	lobby.Players = append(lobby.Players, player)
+}
+
+// takes a player out of their seat, clearing their ready state. returns nil if they weren't seated
+func unseat(lobby *models.Lobby, playerID string) *models.Player {
+	for i, p := range lobby.Players {
+		if p.ID == playerID {
+			lobby.Players = append(lobby.Players[:i], lobby.Players[i+1:]...)
+			delete(lobby.ReadyPlayers, p.Name)
+			p.Ready = false
+			return p
+		}
+	}
+	return nil
+}
+
+// TakeSeat moves a spectator into an empty seat
+func TakeSeat(lobby *models.Lobby, playerID string) (*models.Player, error) {
+	if IsSeated(lobby, playerID) {
+		return nil, fmt.Errorf("you already have a seat")
+	}
+	player := FindPlayer(lobby, playerID)
+	if player == nil {
+		return nil, fmt.Errorf("you are not in this lobby")
+	}
+	symbol := FreeSeat(lobby)
+	if symbol == "" {
+		return nil, fmt.Errorf("there are no free seats")
+	}
+
+	removePlayer(lobby, playerID)
+	seat(lobby, player, symbol)
+	return player, nil
+}
+
+// LeaveSeat gives up a player's seat, they stay on as a spectator when there is room.
+// returns the player and whether they are still in the lobby
+func LeaveSeat(lobby *models.Lobby, playerID string) (*models.Player, bool, error) {
+	if lobby.GameStarted {
+		return nil, false, fmt.Errorf("you cannot leave your seat during a game")
+	}
+	player := unseat(lobby, playerID)
+	if player == nil {
+		return nil, false, fmt.Errorf("you do not have a seat")
+	}
+
+	player.Symbol = "S"
+	if spectatorsFull(lobby) {
+		return player, false, nil
+	}
+	lobby.Spectators = append(lobby.Spectators, player)
+	return player, true, nil
+}
+
+// SeatBot puts a bot in the first free seat, bots are always ready
+func SeatBot(lobby *models.Lobby, botID string, name string) (*models.Player, error) {
+	if FindPlayer(lobby, botID) != nil {
+		return nil, fmt.Errorf("%s is already in this lobby", name)
+	}
+	symbol := FreeSeat(lobby)
+	if symbol == "" {
+		return nil, fmt.Errorf("there are no free seats")
+	}
+
+	player := &models.Player{ID: botID, Name: name, IsBot: true, Ready: true}
+	seat(lobby, player, symbol)
+	return player, nil
+}
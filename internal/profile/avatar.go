@@ -0,0 +1,202 @@
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the decoders for image.Decode
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"tictacgo/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Avatars are stored on local disk as PNGs, whatever format they were uploaded in.
+// re-encoding drops metadata and anything hiding after the image data
+
+const (
+	MaxAvatarBytes  = 1 << 20 // largest upload accepted
+	maxAvatarPixels = 1024    // largest width or height, checked before decoding
+	avatarSize      = 256     // stored avatars are square and this wide
+	thumbnailSize   = 48      // chat thumbnails
+)
+
+// AvatarURL is where avatars are served from, see routes.go
+const AvatarURL = "/avatars/"
+
+// errors are safe to show to the client
+var (
+	ErrAvatarTooLarge = fmt.Errorf("avatars must be under %d KB and %dx%d pixels", MaxAvatarBytes/1024, maxAvatarPixels, maxAvatarPixels)
+	ErrAvatarType     = errors.New("avatars must be PNG, JPEG or GIF images")
+)
+
+// image formats accepted, sniffed from the data and not trusted from the upload's headers
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// AvatarDir is where avatar files are written, AVATAR_DIR or ./data/avatars
+func AvatarDir() string {
+	if dir := os.Getenv("AVATAR_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("data", "avatars")
+}
+
+// SetAvatar validates an uploaded image, stores it with a thumbnail and points the
+// player's profile at them. returns the updated profile
+func SetAvatar(playerID string, data []byte) (*models.Profile, error) {
+	// player IDs end up in file names
+	if _, err := uuid.Parse(playerID); err != nil {
+		return nil, fmt.Errorf("invalid player ID %q", playerID)
+	}
+	if len(data) > MaxAvatarBytes {
+		return nil, ErrAvatarTooLarge
+	}
+	if !avatarTypes[http.DetectContentType(data)] {
+		return nil, ErrAvatarType
+	}
+
+	// refuse huge dimensions before decoding allocates for them
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return nil, ErrAvatarType
+	}
+	if config.Width > maxAvatarPixels || config.Height > maxAvatarPixels {
+		return nil, ErrAvatarTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarType
+	}
+
+	if err := os.MkdirAll(AvatarDir(), 0o755); err != nil {
+		return nil, err
+	}
+	square := cropSquare(img)
+	if err := writePNG(avatarPath(playerID, ""), scaleSquare(square, avatarSize)); err != nil {
+		return nil, err
+	}
+	if err := writePNG(avatarPath(playerID, "-thumb"), scaleSquare(square, thumbnailSize)); err != nil {
+		return nil, err
+	}
+
+	// the version stops browsers showing the previous avatar from cache
+	version := fmt.Sprintf("?v=%d", time.Now().Unix())
+	return Update(playerID, func(profile *models.Profile) {
+		profile.Avatar = AvatarURL + playerID + ".png" + version
+		profile.Thumbnail = AvatarURL + playerID + "-thumb.png" + version
+	}), nil
+}
+
+// RemoveAvatar deletes the player's avatar files, returns the updated profile
+func RemoveAvatar(playerID string) *models.Profile {
+	for _, suffix := range []string{"", "-thumb"} {
+		if err := os.Remove(avatarPath(playerID, suffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error removing avatar: %v", err)
+		}
+	}
+	return Update(playerID, func(profile *models.Profile) {
+		profile.Avatar = ""
+		profile.Thumbnail = ""
+	})
+}
+
+// ServeAvatar handles GET /avatars/{file}, where file is "<player ID>.png" or
+// "<player ID>-thumb.png". single files only, listing the directory would give away every player ID
+func ServeAvatar(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".png")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	playerID, suffix := name, ""
+	if id, found := strings.CutSuffix(name, "-thumb"); found {
+		playerID, suffix = id, "-thumb"
+	}
+	if _, err := uuid.Parse(playerID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, avatarPath(playerID, suffix))
+}
+
+func avatarPath(playerID string, suffix string) string {
+	return filepath.Join(AvatarDir(), playerID+suffix+".png")
+}
+
+// writePNG writes through a temporary file so a half written avatar is never served
+func writePNG(path string, img image.Image) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// cropSquare copies the middle square of img into an RGBA image. draw.Draw has fast
+// paths for what the decoders return (YCbCr, paletted, RGBA...), so this is the only
+// pass over the upload and scaleSquare can read the pixels straight from Pix
+func cropSquare(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	left := b.Min.X + (b.Dx()-side)/2
+	top := b.Min.Y + (b.Dy()-side)/2
+
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, image.Pt(left, top), draw.Src)
+	return square
+}
+
+// scaleSquare scales a square image to size x size, averaging the source pixels
+// behind each destination pixel. the colors are premultiplied so averaging them is right
+func scaleSquare(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		if y1 == y0 {
+			y1 = y0 + 1 // scaling up, repeat the nearest pixel
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r, g, b, a = r+uint32(row[i]), g+uint32(row[i+1]), b+uint32(row[i+2]), a+uint32(row[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
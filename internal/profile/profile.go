@@ -0,0 +1,157 @@
+// Package profile keeps what players show each other: their display name, avatar,
+// symbol colors and a summary of the games they've played. profiles are keyed by
+// player ID, which is the account ID
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"regexp"
+	"tictacgo/internal/auth"
+	"tictacgo/models"
+
+	"github.com/go-redis/redis"
+)
+
+var redisClient = redis.NewClient(&redis.Options{
+	Addr: os.Getenv("REDIS_ADDRESS"), // Use environment variable
+})
+
+// ErrInvalidColor is returned for colors that aren't "#rrggbb"
+var ErrInvalidColor = errors.New("colors must look like #1a2b3c")
+
+var validColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Get returns a copy of a player's profile, creating an empty one on first use.
+// nil when the player has no account (bots). change profiles with Update
+func Get(playerID string) *models.Profile {
+	return Update(playerID, nil)
+}
+
+// Update applies change to the player's profile and saves it, change may be nil.
+// it runs holding models.ProfilesMu, so it must not call back into this package.
+// returns a copy of the profile afterwards, nil when the player has no account
+func Update(playerID string, change func(profile *models.Profile)) *models.Profile {
+	account := auth.Find(playerID)
+	if account == nil {
+		return nil
+	}
+	load(playerID)
+
+	models.ProfilesMu.Lock()
+	profile, ok := models.Profiles[playerID]
+	if !ok {
+		profile = &models.Profile{PlayerID: playerID}
+		models.Profiles[playerID] = profile
+	}
+	// the account owns the name, the profile just shows it
+	profile.DisplayName = account.Name
+	if change != nil {
+		change(profile)
+	}
+	saved := *profile
+	models.ProfilesMu.Unlock()
+
+	if change != nil {
+		store(&saved)
+	}
+	return &saved
+}
+
+// For returns the profile shown for a lobby player, bots get a bare one with their name
+func For(player *models.Player) *models.Profile {
+	if player.IsBot {
+		return &models.Profile{PlayerID: player.ID, DisplayName: player.Name}
+	}
+	if profile := Get(player.ID); profile != nil {
+		return profile
+	}
+	return &models.Profile{PlayerID: player.ID, DisplayName: player.Name}
+}
+
+// ForLobby returns the profile of everyone seated or spectating, keyed by player ID
+func ForLobby(lobby *models.Lobby) map[string]*models.Profile {
+	profiles := make(map[string]*models.Profile)
+	for _, group := range [][]*models.Player{lobby.Players, lobby.Spectators} {
+		for _, p := range group {
+			profiles[p.ID] = For(p)
+		}
+	}
+	return profiles
+}
+
+// SetColors changes the colors a player's symbols are drawn in, empty resets to the default
+func SetColors(playerID string, colors models.SymbolColors) error {
+	for _, color := range []string{colors.X, colors.O} {
+		if color != "" && !validColor.MatchString(color) {
+			return ErrInvalidColor
+		}
+	}
+	Update(playerID, func(profile *models.Profile) {
+		profile.Colors = colors
+	})
+	return nil
+}
+
+// RecordGame adds a finished game to the stats of both seated players, winner is
+// the winning symbol or "none" for a draw. bots don't keep stats
+func RecordGame(lobby *models.Lobby, winner string) {
+	for _, p := range lobby.Players {
+		if p.IsBot {
+			continue
+		}
+		symbol := p.Symbol
+		Update(p.ID, func(profile *models.Profile) {
+			profile.Stats.Played++
+			switch winner {
+			case symbol:
+				profile.Stats.Wins++
+			case "X", "O":
+				profile.Stats.Losses++
+			default:
+				profile.Stats.Draws++
+			}
+		})
+	}
+}
+
+// load brings a saved profile into memory from Redis, if it isn't there already
+func load(playerID string) {
+	models.ProfilesMu.RLock()
+	_, ok := models.Profiles[playerID]
+	models.ProfilesMu.RUnlock()
+	if ok {
+		return
+	}
+
+	data, err := redisClient.Get("profile:" + playerID).Result()
+	if err != nil {
+		return
+	}
+	var profile models.Profile
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		log.Printf("Error decoding profile %s: %v", playerID, err)
+		return
+	}
+
+	// another request may have loaded or changed it meanwhile, that one wins
+	models.ProfilesMu.Lock()
+	if _, ok := models.Profiles[playerID]; !ok {
+		models.Profiles[playerID] = &profile
+	}
+	models.ProfilesMu.Unlock()
+}
+
+// store writes a copy of the profile taken by Update to Redis
+func store(profile *models.Profile) {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		log.Printf("Error encoding profile %s: %v", profile.PlayerID, err)
+		return
+	}
+	if err := redisClient.Set("profile:"+profile.PlayerID, data, 0).Err(); err != nil {
+		log.Printf("Error storing profile in Redis: %v", err)
+	}
+}
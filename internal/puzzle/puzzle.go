@@ -0,0 +1,283 @@
+// Package puzzle is the "win in N" puzzle library. every position where the side to move
+// can force a win is a puzzle: the player has to win in N moves against the solver,
+// which defends as long as it can. puzzles and players have ratings that move after
+// each first attempt, Elo style
+package puzzle
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"tictacgo/internal/bot"
+	"tictacgo/internal/game"
+	"tictacgo/models"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var redisClient = redis.NewClient(&redis.Options{
+	Addr: os.Getenv("REDIS_ADDRESS"), // Use environment variable
+})
+
+const (
+	// DefaultRating is where players start
+	DefaultRating = 1200
+
+	// how far one attempt moves the ratings
+	playerK = 32
+	puzzleK = 16
+
+	// next picks at random among this many unattempted puzzles closest to the player's rating
+	nextChoices = 10
+
+	// how long to wait before reading the stored ratings again after Redis failed
+	statsRetry = time.Minute
+)
+
+// Puzzle is a position where the side to move can force a win
+type Puzzle struct {
+	ID       int // the canonical key of the position, see game.Position
+	Position game.Position
+	WinIn    int // moves of the side to move, against the solver's longest defence
+	Rating   int
+	Attempts int // first attempts only, retries are practice
+	Solved   int
+}
+
+// what is kept in Redis for a puzzle, the rest comes from the position
+type puzzleStats struct {
+	Rating   int `json:"rating"`
+	Attempts int `json:"attempts"`
+	Solved   int `json:"solved"`
+}
+
+// the library is built on first use, puzzles in ID order. ratings change from lobbies
+// running at the same time, hence the lock
+var (
+	once      sync.Once
+	mu        sync.Mutex
+	library   []*Puzzle
+	byID      map[int]*Puzzle
+	attempted = map[string]map[int]bool{} // by player ID
+
+	statsLoaded   bool      // the stored ratings have been read into the library
+	nextStatsLoad time.Time // when to try again after a failed read
+)
+
+// build solves every position once and keeps the canonical ones the side to move wins.
+// a puzzle needs at least one move that doesn't win, or there is nothing to find
+func build() {
+	byID = make(map[int]*Puzzle)
+	for key := 0; key < game.MaxPositionKey; key++ {
+		position, err := game.PositionFromKey(key)
+		if err != nil || position.Validate() != nil || position.Over() || position.CanonicalKey() != key {
+			continue
+		}
+		result := bot.Solve(position, game.VariantClassic)
+		if result.Outcome != bot.OutcomeWin {
+			continue
+		}
+
+		moves := bot.Analyze(position, game.VariantClassic)
+		var best int
+		for _, m := range moves {
+			if m.Best {
+				best++
+			}
+		}
+		if best == len(moves) {
+			continue
+		}
+
+		p := &Puzzle{ID: key, Position: position, WinIn: (result.Moves + 1) / 2}
+		p.Rating = startRating(p.WinIn, best, len(moves))
+		library = append(library, p)
+		byID[key] = p
+	}
+}
+
+// load builds the library and reads the stored ratings into it, both on first use
+func load() {
+	once.Do(build)
+	mu.Lock()
+	loadStats()
+	mu.Unlock()
+}
+
+// loadStats reads the ratings that have moved since the puzzles were first rated, mu is
+// held. a failed read is tried again statsRetry later, until then Record doesn't write
+// ratings back so the stored ones aren't overwritten with the starting ones
+func loadStats() {
+	if statsLoaded || time.Now().Before(nextStatsLoad) {
+		return
+	}
+	stored, err := redisClient.HGetAll("puzzles").Result()
+	if err != nil {
+		log.Printf("Error loading puzzle ratings from Redis: %v", err)
+		nextStatsLoad = time.Now().Add(statsRetry)
+		return
+	}
+	statsLoaded = true
+	for field, data := range stored {
+		id, _ := strconv.Atoi(field)
+		p := byID[id]
+		if p == nil {
+			continue
+		}
+		var stats puzzleStats
+		if err := json.Unmarshal([]byte(data), &stats); err != nil {
+			log.Printf("Error decoding puzzle %d: %v", id, err)
+			continue
+		}
+		p.Rating, p.Attempts, p.Solved = stats.Rating, stats.Attempts, stats.Solved
+	}
+}
+
+// startRating guesses how hard a puzzle is before anyone has tried it: longer wins are
+// harder, and so are positions with fewer winning moves among the legal ones
+func startRating(winIn int, best int, legal int) int {
+	rating := 800 + 200*(winIn-1) + 400*(legal-best)/legal
+	return rating / 10 * 10
+}
+
+// All returns the library in ID order
+func All() []*Puzzle {
+	load()
+	return library
+}
+
+// Find returns the puzzle with the given ID, nil if there is none
+func Find(id int) *Puzzle {
+	load()
+	return byID[id]
+}
+
+// Stats returns a puzzle's rating and how often it was attempted and solved, read under
+// the lock as Record moves them
+func Stats(p *Puzzle) (rating int, attempts int, solved int) {
+	mu.Lock()
+	defer mu.Unlock()
+	return p.Rating, p.Attempts, p.Solved
+}
+
+// Daily returns the puzzle of the day, the same for everyone. win in 1 is too easy for it
+func Daily(day time.Time) *Puzzle {
+	var candidates []*Puzzle
+	for _, p := range All() {
+		if p.WinIn > 1 {
+			candidates = append(candidates, p)
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(day.UTC().Format("2006-01-02")))
+	return candidates[h.Sum32()%uint32(len(candidates))]
+}
+
+// Next picks a puzzle the player hasn't tried yet, close to their rating. when they have
+// tried them all it picks among every puzzle
+func Next(playerID string, rating int) *Puzzle {
+	if rating == 0 {
+		rating = DefaultRating
+	}
+	puzzles := All()
+
+	mu.Lock()
+	tried := attemptsOf(playerID)
+	var candidates []*Puzzle
+	for _, p := range puzzles {
+		if !tried[p.ID] {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, puzzles...)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return abs(candidates[i].Rating-rating) < abs(candidates[j].Rating-rating)
+	})
+	mu.Unlock()
+	return candidates[rand.Intn(min(nextChoices, len(candidates)))]
+}
+
+// Record scores an attempt and moves the player's and the puzzle's ratings. only the first
+// attempt at a puzzle is rated, rated is false for retries. change is the player's new
+// rating minus the old one
+func Record(p *Puzzle, playerID string, stats *models.PuzzleStats, solved bool) (change int, rated bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	// checked and marked under one lock, so two lobbies finishing together rate it once
+	tried := attemptsOf(playerID)
+	if tried[p.ID] {
+		return 0, false
+	}
+	tried[p.ID] = true
+	// another try at the stored ratings before moving them
+	loadStats()
+	if err := redisClient.SAdd("puzzles:attempted:"+playerID, p.ID).Err(); err != nil {
+		log.Printf("Error storing puzzle attempt in Redis: %v", err)
+	}
+
+	if stats.Rating == 0 {
+		stats.Rating = DefaultRating
+	}
+	score := 0.0
+	if solved {
+		score = 1
+		stats.Solved++
+		p.Solved++
+	} else {
+		stats.Failed++
+	}
+	p.Attempts++
+
+	// the chance the player had of solving it, going by the ratings
+	expected := 1 / (1 + math.Pow(10, float64(p.Rating-stats.Rating)/400))
+	change = int(math.Round(playerK * (score - expected)))
+	stats.Rating += change
+	p.Rating -= int(math.Round(puzzleK * (score - expected)))
+
+	// the stored ratings couldn't be read, writing this one would overwrite them
+	if !statsLoaded {
+		return change, true
+	}
+	data, _ := json.Marshal(puzzleStats{p.Rating, p.Attempts, p.Solved})
+	if err := redisClient.HSet("puzzles", strconv.Itoa(p.ID), data).Err(); err != nil {
+		log.Printf("Error storing puzzle rating in Redis: %v", err)
+	}
+	return change, true
+}
+
+// attemptsOf returns the puzzle IDs the player has tried, loaded from Redis on first use.
+// mu is held
+func attemptsOf(playerID string) map[int]bool {
+	if tried, ok := attempted[playerID]; ok {
+		return tried
+	}
+
+	tried := make(map[int]bool)
+	ids, err := redisClient.SMembers("puzzles:attempted:" + playerID).Result()
+	if err != nil {
+		log.Printf("Error loading puzzle attempts from Redis: %v", err)
+	}
+	for _, id := range ids {
+		n, _ := strconv.Atoi(id)
+		tried[n] = true
+	}
+	attempted[playerID] = tried
+	return tried
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"tictacgo/api/handlers"
 	"tictacgo/internal/lobby"
+	"tictacgo/internal/profile"
 
 	"golang.org/x/net/websocket"
 )
@@ -22,8 +23,68 @@ func SetupRoutes() {
 	http.HandleFunc("/create-lobby", lobby.CreateLobby)
 	http.HandleFunc("/lobbies", lobby.HandleLobbies)
 	http.HandleFunc("/lobby/", lobby.ServeLobby)
+	http.HandleFunc("GET /lobby/{id}/export", handlers.ExportLobby) // chat transcript and moves as json, txt or csv
+
+	// Solver, perfect play for every move of ?position=
+	http.HandleFunc("GET /analyze", handlers.APIAnalyze)
+
+	// Puzzles, ?id= is a puzzle ID, daily or next
+	http.HandleFunc("GET /puzzle", handlers.PlayPuzzle)
+
+	// Accounts, the session cookie identifies the player on every other route
+	http.HandleFunc("POST /api/v1/auth/register", handlers.APIRegister)
+	http.HandleFunc("POST /api/v1/auth/login", handlers.APILogin)
+	http.HandleFunc("POST /api/v1/auth/guest", handlers.APIGuest)
+	http.HandleFunc("POST /api/v1/auth/upgrade", handlers.APIUpgrade)
+	http.HandleFunc("POST /api/v1/auth/logout", handlers.APILogout)
+	http.HandleFunc("GET /api/v1/auth/me", handlers.APIMe)
+	http.HandleFunc("POST /api/v1/auth/token", handlers.APIToken)
+	http.HandleFunc("POST /api/v1/auth/token/revoke", handlers.APIRevokeToken)
+
+	// Profiles, avatars are served from AVATAR_DIR
+	http.HandleFunc("GET /api/v1/profile", handlers.APIMyProfile)
+	http.HandleFunc("PATCH /api/v1/profile", handlers.APIUpdateProfile)
+	http.HandleFunc("PUT /api/v1/profile/avatar", handlers.APIUploadAvatar)
+	http.HandleFunc("DELETE /api/v1/profile/avatar", handlers.APIDeleteAvatar)
+	http.HandleFunc("GET /api/v1/profiles/{id}", handlers.APIGetProfile)
+	http.HandleFunc("GET "+profile.AvatarURL+"{file}", profile.ServeAvatar)
+
+	// REST API, versioned so the websocket protocol and API can evolve separately
+	http.HandleFunc("POST /api/v1/lobbies", handlers.APICreateLobby)
+	http.HandleFunc("GET /api/v1/lobbies/{id}", handlers.APIGetLobby)
+	http.HandleFunc("DELETE /api/v1/lobbies/{id}", handlers.APIDeleteLobby)
+	http.HandleFunc("GET /api/v1/lobbies/{id}/game", handlers.APIGetGame)
+	http.HandleFunc("POST /api/v1/lobbies/{id}/moves", handlers.APIMove)
+	http.HandleFunc("GET /api/v1/lobbies/{id}/players", handlers.APIListPlayers)
+	http.HandleFunc("POST /api/v1/lobbies/{id}/players", handlers.APIJoinLobby)
+	http.HandleFunc("POST /api/v1/lobbies/{id}/ready", handlers.APIReady)
+	http.HandleFunc("GET /api/v1/lobbies/{id}/chat", handlers.APIChatHistory)
+	http.HandleFunc("GET /api/v1/lobbies/{id}/games/{number}/notation", handlers.APIGameNotation)
+	http.HandleFunc("GET /api/v1/lobbies/{id}/games/{number}/review", handlers.APIGameReview)
+	http.HandleFunc("POST /api/v1/games/import", handlers.APIImportGame)
+	http.HandleFunc("GET /api/v1/positions/{position}", handlers.APIGetPosition)
+	http.HandleFunc("GET /api/v1/puzzles/{id}", handlers.APIGetPuzzle)
+	http.HandleFunc("POST /api/v1/puzzles/{id}/play", handlers.APIPlayPuzzle)
+
+	// Bot API, bots play over their own websocket on /bot
+	http.HandleFunc("POST /api/v1/bots", handlers.APIRegisterBot)
+	http.HandleFunc("GET /api/v1/bots", handlers.APIListBots)
+	http.HandleFunc("POST /api/v1/lobbies/{id}/bots", handlers.APIAddBot)
+	http.Handle("/bot", websocket.Handler(handlers.HandleBotSocket))
+
+	// API descriptions, api/client is kept in step with openapi.json
+	http.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./api/openapi.json")
+	})
+	http.HandleFunc("/asyncapi.json", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./api/asyncapi.json")
+	})
 
 	// WebSocket handler
 	slog.Info("Web socket handler")
-	http.Handle("/ws", websocket.Handler(handlers.HandleWebSocket))
+	// the upgrade is refused unless it carries a valid bearer token or session cookie
+	http.Handle("/ws", websocket.Server{
+		Handshake: handlers.AuthenticateUpgrade,
+		Handler:   handlers.HandleWebSocket,
+	})
 }
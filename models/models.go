@@ -1,6 +1,7 @@
 package models
 
 import (
+	"sync"
 	"tictacgo/internal/game"
 	"time"
 )
@@ -8,6 +9,24 @@ import (
 // A global map storing active game lobbies.
 var Lobbies = make(map[string]*Lobby)
 
+// guards the Lobbies map itself, a lobby's own state is guarded by its lock (see lobby.Lock)
+var LobbiesMu sync.RWMutex
+
+// registered bots, keyed by bot ID
+var Bots = make(map[string]*Bot)
+
+// player accounts, registered and guest, keyed by account ID
+var Accounts = make(map[string]*Account)
+
+// guards the Accounts map and the names of the accounts in it, see auth
+var AccountsMu sync.RWMutex
+
+// player profiles, keyed by player (account) ID
+var Profiles = make(map[string]*Profile)
+
+// guards the Profiles map and the profiles in it, see profile.Update
+var ProfilesMu sync.RWMutex
+
 // NOTE: Go’s structs are typed collections of fields. They’re useful for grouping data together to form records.
 
 type Player struct {
@@ -15,18 +34,122 @@ type Player struct {
 	Symbol string
 	Name   string
 	Ready  bool
+	IsBot  bool // seated through the bot API, moves come from the bot's connection
 }
 
-type Lobby struct {
+// Bot is an external AI player registered through the bot API
+type Bot struct {
+	ID        string
+	Name      string
+	TokenHash string // sha256 of the bot's token, the token itself is only shown once
+	Created   time.Time
+}
+
+// Account is who a player is across lobbies, its ID is used as their player ID
+type Account struct {
 	ID           string
-	Name         string
-	MaxPlayers   int
-	Players      []*Player
-	Game         *game.Game
-	ReadyPlayers map[string]bool
-	GameStarted  bool
-	ChatMessages []ChatMessage
-	CurrentTurn  string
+	Username     string // login name, empty for guests
+	Name         string // shown in lobbies, the username once registered
+	PasswordHash string // bcrypt, empty for guests
+	Guest        bool
+	Created      time.Time
+
+	TokenVersion int // bumped to revoke every access token issued so far, see auth.RevokeAllTokens
+}
+
+// Profile is what other players see next to the board and in chat
+type Profile struct {
+	PlayerID    string       `json:"playerId"`
+	DisplayName string       `json:"displayName"`         // always the account's name, unique across accounts
+	Avatar      string       `json:"avatar,omitempty"`    // URL of the uploaded avatar, empty for none
+	Thumbnail   string       `json:"thumbnail,omitempty"` // small version of Avatar for chat
+	Colors      SymbolColors `json:"colors"`
+	Stats       PlayerStats  `json:"stats"`
+	Puzzles     PuzzleStats  `json:"puzzles"`
+}
+
+// SymbolColors are the colors a player wants their symbols drawn in, "#rrggbb" or empty for the default
+type SymbolColors struct {
+	X string `json:"x,omitempty"`
+	O string `json:"o,omitempty"`
+}
+
+// PlayerStats sums up every finished game a player was seated for
+type PlayerStats struct {
+	Played int `json:"played"`
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+}
+
+// PuzzleStats is a player's puzzle record, puzzle games don't count in PlayerStats
+type PuzzleStats struct {
+	Rating int `json:"rating"` // 0 until the first rated attempt, see puzzle.DefaultRating
+	Solved int `json:"solved"`
+	Failed int `json:"failed"`
+}
+
+type Lobby struct {
+	ID              string
+	Name            string
+	MaxPlayers      int
+	Players         []*Player // seated players, X and O only
+	Spectators      []*Player
+	MaxSpectators   int
+	Game            *game.Game
+	ReadyPlayers    map[string]bool
+	GameStarted     bool
+	DrawOffer       string                   // player ID who offered a draw in the game in progress, cleared by the next move
+	HintsUsed       map[string]int           // hints taken per player ID in the game in progress
+	ChatMessages    []ChatMessage            `json:"-"` // the all channel, stored apart in Redis (see internal/chat/store.go)
+	ChannelMessages map[string][]ChatMessage `json:"-"` // the players, spectators and whisper channels, stored with the all channel
+	ChatSeq         int                      // ID of the last chat message
+	CurrentTurn     string
+	Private         bool                 // hidden from /lobbies, joinable by passcode or invite link only
+	PasscodeHash    string               // bcrypt hash of the passcode (salted sha256 in older saves), empty when there is none
+	HostID          string               // player ID of the lobby creator, or whoever host was transferred to
+	Banned          map[string]bool      // account IDs refused on (re)connect
+	Muted           map[string]time.Time // player IDs who can't chat until the given time
+	Settings        LobbySettings
+	SeriesScore     map[string]int // wins per player ID in the current series
+	SeriesGames     int            // games played in the current series
+	Games           []GameRecord   // finished games, oldest first, see lobby.RecordGame
+}
+
+// GameRecord is a finished game, kept for exports and reviews
+type GameRecord struct {
+	Number    int // counts up from 1 in each lobby
+	X         string
+	O         string // names of the players who had each symbol
+	Variant   string
+	FirstTurn string // "X" or "O"
+	Position  string // code of the start position, empty for an empty board
+	Started   time.Time
+	Ended     time.Time
+	Moves     []game.Move
+	Result    string // how it ended: "win", "draw", "timeout" or "resign"
+	Winner    string // "X", "O" or "none"
+
+	// "board", "resign", "timeout" or "agreed" (game.Termination*), empty in records saved before it was kept
+	Termination string
+}
+
+// LobbySettings are chosen when the lobby is created and validated by the server
+type LobbySettings struct {
+	Name           string `json:"name"`
+	Variant        string `json:"variant"`        // "classic" or "misere"
+	BoardSize      int    `json:"boardSize"`      // rows/columns, only 3 is supported
+	TimeControl    int    `json:"timeControl"`    // seconds on each player's clock, 0 for untimed
+	Visibility     string `json:"visibility"`     // "public" or "private"
+	SpectatorLimit int    `json:"spectatorLimit"` // 0 disables spectating
+	ChatEnabled    bool   `json:"chatEnabled"`
+	SeriesLength   int    `json:"seriesLength"`            // best of N games, odd
+	FirstMove      string `json:"firstMove"`               // "X", "O" or "alternate"
+	StartPosition  string `json:"startPosition,omitempty"` // position code every game starts from, for practice, see game.Position
+	PostGameReview bool   `json:"postGameReview"`          // GAMEMASTER points out the mistakes after every game
+	Rated          bool   `json:"rated"`                   // competitive, no hints
+	HintsPerGame   int    `json:"hintsPerGame"`            // solver hints each player may ask for per game, 0 turns them off
+	Puzzle         int    `json:"puzzle,omitempty"`        // puzzle ID in puzzle lobbies, only set by lobby.NewPuzzleLobby
 }
 
 type Message struct {
@@ -40,7 +163,17 @@ type Message struct {
 }
 
 type ChatMessage struct {
+	ID        int // counts up from 1 in each lobby
 	Text      string
 	Sender    string
 	Timestamp time.Time
+	Emote     bool   `json:",omitempty"` // sent with /me, shown as "* Sender Text"
+	Channel   string `json:",omitempty"` // "players", "spectators" or "whisper", empty for everyone
+	SenderID  string `json:",omitempty"` // player ID of the sender, empty for GAMEMASTER
+	To        string `json:",omitempty"` // player ID a whisper is for
+	ToName    string `json:",omitempty"`
+
+	EditedAt  *time.Time          `json:",omitempty"` // last edit by the author
+	Deleted   bool                `json:",omitempty"` // a tombstone, the text is gone
+	Reactions map[string][]string `json:",omitempty"` // player IDs by emoji, the count is the length
 }
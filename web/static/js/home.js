@@ -8,74 +8,197 @@ document.addEventListener("DOMContentLoaded", () => {
     usernameDisplay.id = "usernameDisplay";
     document.body.insertBefore(usernameDisplay, nameSubmit);
 
+    const accountUsername = document.getElementById("accountUsername");
+    const accountPassword = document.getElementById("accountPassword");
+    const loginBtn = document.getElementById("loginBtn");
+    const registerBtn = document.getElementById("registerBtn");
+    const logoutBtn = document.getElementById("logoutBtn");
+
+    const profileDiv = document.getElementById("profile");
+    const profileAvatar = document.getElementById("profileAvatar");
+    const displayName = document.getElementById("displayName");
+    const colorX = document.getElementById("colorX");
+    const colorO = document.getElementById("colorO");
+    const avatarFile = document.getElementById("avatarFile");
+    const saveProfileBtn = document.getElementById("saveProfileBtn");
+    const profileStats = document.getElementById("profileStats");
+
     let username = "";
-    let userProfile = null; // Store the user profile data
+    let account = null; // the signed in account, guests included
 
     function validateUsername(name) {
         const regex = /^[a-zA-Z0-9]{1,15}$/;
         return regex.test(name);
     }
 
-    const userProfileJSON = localStorage.getItem('TTTprofile');
-
-    if (userProfileJSON) {
-        const userProfile = JSON.parse(userProfileJSON);
-        if (userProfile) {
-            username = userProfile.Name; // Set username from cookie if available
-            usernameDisplay.innerHTML = `You are playing as: <strong>${username}</strong>`;
-            createLobbyBtn.disabled = false;
-            usernameInput.style.display = "none"; // Hide username input
-            submitUsernameBtn.disabled = true;
-            submitUsernameBtn.style.display = "none" // Hide submit button
+    // Shows who is signed in, the session cookie is what the server goes by
+    function showAccount(current) {
+        account = current;
+        username = account ? account.name : "";
+
+        if (account) {
+            usernameDisplay.innerHTML = account.guest
+                ? `You are playing as: <strong>${username}</strong> (guest, register to keep this account)`
+                : `You are playing as: <strong>${username}</strong>`;
         } else {
-            console.log("Local Storage Data not found");
+            usernameDisplay.innerHTML = "";
         }
-    } else {
-        console.log("Object not found in local storage.");
-        usernameInput.style.display = "inline"; // Show username input
-        submitUsernameBtn.disabled = false; // Show submit button
+
+        createLobbyBtn.disabled = !account;
+        nameSubmit.style.display = account ? "none" : "";
+        accountUsername.style.display = account && !account.guest ? "none" : "";
+        accountPassword.style.display = account && !account.guest ? "none" : "";
+        loginBtn.style.display = account && !account.guest ? "none" : "";
+        registerBtn.style.display = account && !account.guest ? "none" : "";
+        logoutBtn.style.display = account ? "" : "none";
+        profileDiv.style.display = account ? "" : "none";
+        if (account) {
+            loadProfile();
+        }
+
+        document.querySelectorAll("#lobby-list button").forEach(button => {
+            button.disabled = !account;
+        });
     }
 
-    submitUsernameBtn.addEventListener("click", () => {
-        const inputUsername = usernameInput.value.trim();
-        if (validateUsername(inputUsername)) {
-            username = inputUsername;
-            usernameDisplay.innerHTML = `You are playing as: <strong>${username}</strong>`;
-            createLobbyBtn.disabled = false;
-            usernameInput.style.display = "none"; // Hide username input
-            submitUsernameBtn.style.display = "none"; // Hide submit button
-            // Create the user profile object
-            const userProfile = {
-                Name: username,
-            };
+    // Posts to an auth endpoint and shows the account it answers with
+    function authRequest(path, body) {
+        return fetch(`/api/v1/auth/${path}`, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+        })
+            .then(async (response) => {
+                const data = await response.json();
+                if (!response.ok) {
+                    throw new Error(data.error ? data.error.message : response.statusText);
+                }
+                return data;
+            })
+            .then(showAccount)
+            .catch((error) => alert(error.message));
+    }
+
+    // Fetches a JSON API endpoint, throwing the API's error message on failure
+    async function apiRequest(method, path, body, contentType) {
+        const response = await fetch(path, {
+            method: method,
+            headers: contentType ? { "Content-Type": contentType } : {},
+            body: body,
+        });
+        if (response.status === 204) {
+            return null;
+        }
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error ? data.error.message : response.statusText);
+        }
+        return data;
+    }
+
+    // Fills in the profile form
+    function showProfile(profile) {
+        displayName.value = profile.displayName;
+        colorX.value = profile.colors.x || "#000000";
+        colorO.value = profile.colors.o || "#000000";
+        profileAvatar.src = profile.avatar || "";
+        profileAvatar.style.display = profile.avatar ? "" : "none";
+        const stats = profile.stats;
+        profileStats.textContent = `${stats.played} played: ${stats.wins} won, ${stats.losses} lost, ${stats.draws} drawn`;
+    }
+
+    function loadProfile() {
+        apiRequest("GET", "/api/v1/profile")
+            .then(showProfile)
+            .catch((error) => console.error("Error loading profile:", error));
+    }
 
-     
-            const userProfileJSON = JSON.stringify(userProfile);
+    saveProfileBtn.addEventListener("click", async () => {
+        try {
+            let profile = await apiRequest("PATCH", "/api/v1/profile", JSON.stringify({
+                displayName: displayName.value.trim(),
+                colors: { x: colorX.value, o: colorO.value },
+            }), "application/json");
 
-            localStorage.setItem('TTTprofile', userProfileJSON);
+            // the server checks the size and type again
+            const file = avatarFile.files[0];
+            if (file) {
+                profile = await apiRequest("PUT", "/api/v1/profile/avatar", file, file.type);
+                avatarFile.value = "";
+            }
+
+            showProfile(profile);
+            account.name = profile.displayName;
+            username = profile.displayName;
+            usernameDisplay.querySelector("strong").textContent = username;
+        } catch (error) {
+            alert(error.message);
+        }
+    });
+
+    fetch("/api/v1/auth/me")
+        .then((response) => response.ok ? response.json() : null)
+        .then(showAccount)
+        .catch(() => showAccount(null));
 
+    submitUsernameBtn.addEventListener("click", () => {
+        const inputUsername = usernameInput.value.trim();
+        if (validateUsername(inputUsername)) {
+            authRequest("guest", { name: inputUsername });
         } else {
             alert("Invalid username. Please use only letters and numbers (up to 15 characters).");
         }
     });
 
+    loginBtn.addEventListener("click", () => {
+        authRequest("login", { username: accountUsername.value.trim(), password: accountPassword.value });
+    });
+
+    // guests keep their ID (and any seat they hold) when they register
+    registerBtn.addEventListener("click", () => {
+        const path = account && account.guest ? "upgrade" : "register";
+        authRequest(path, { username: accountUsername.value.trim(), password: accountPassword.value });
+    });
+
+    logoutBtn.addEventListener("click", () => {
+        fetch("/api/v1/auth/logout", { method: "POST" }).then(() => showAccount(null));
+    });
+
     if (createLobbyBtn) {
         createLobbyBtn.addEventListener("click", () => {
-            // Construct query parameters from userProfile (or username if cookie not available)
-            let params = {};
-            if (userProfile) {
-                params = {
-                    ID: userProfile.ID,
-                    Name: userProfile.Name,
-                };
-            } else {
-                params = {
-                    Name: username, // Fallback to username if cookie not available
-                };
-            }
+            // Lobby settings, validated again by the server
+            const settings = {
+                username: username,
+                name: document.getElementById("lobbyName").value.trim(),
+                variant: document.getElementById("variant").value,
+                boardSize: 3,
+                timeControl: parseInt(document.getElementById("timeControl").value, 10) || 0,
+                visibility: document.getElementById("privateLobby").checked ? "private" : "public",
+                passcode: document.getElementById("passcode").value.trim(),
+                spectatorLimit: parseInt(document.getElementById("spectatorLimit").value, 10) || 0,
+                chatEnabled: document.getElementById("chatEnabled").checked,
+                seriesLength: parseInt(document.getElementById("seriesLength").value, 10),
+                firstMove: document.getElementById("firstMove").value,
+                postGameReview: document.getElementById("postGameReview").checked,
+                rated: document.getElementById("rated").checked,
+                hintsPerGame: parseInt(document.getElementById("hintsPerGame").value, 10) || 0,
+            };
 
-            const queryString = new URLSearchParams(params).toString();
-            window.location.href = `/create-lobby?${queryString}`;
+            fetch("/create-lobby", {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify(settings),
+            })
+                .then(async (response) => {
+                    if (!response.ok) {
+                        throw new Error(await response.text());
+                    }
+                    return response.json();
+                })
+                .then((lobby) => {
+                    window.location.href = lobby.url;
+                })
+                .catch((error) => alert(`Could not create lobby: ${error.message}`));
         });
     }
 
@@ -100,7 +223,7 @@ document.addEventListener("DOMContentLoaded", () => {
                     }
                 });
 
-                if (username) {
+                if (account) {
                     document.querySelectorAll("#lobby-list button").forEach(button => {
                         button.disabled = false;
                     });
@@ -112,21 +235,9 @@ document.addEventListener("DOMContentLoaded", () => {
             });
     }
 
+    // the lobby knows who we are from the session cookie
     window.joinLobby = function (id) {
-        let params = {};
-        if (userProfile) {
-            params = {
-                ID: userProfile.id,
-                Name: userProfile.Name,
-            };
-        } else {
-            params = {
-                Name: username, // Fallback to username if cookie not available
-            };
-        }
-        const queryString = new URLSearchParams(params).toString();
-
-        window.location.href = `/lobby/${id}?${queryString}`;
+        window.location.href = `/lobby/${id}`;
     };
 
     if (lobbyList) {
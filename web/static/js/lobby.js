@@ -1,6 +1,6 @@
 const lobbyID = window.location.pathname.split("/")[2];  // Extract lobby ID from URL
 
-const ws = new WebSocket(`ws://localhost:8080/ws?lobby=${lobbyID}`);
+let ws;
 
 
 // Interface vars
@@ -10,6 +10,15 @@ const playerInfo = document.getElementById("player-info");
 const user = document.getElementById("user")
 const role = document.getElementById("role")
 const readyToggle = document.getElementById("ready-toggle");
+const readyDiv = document.getElementById("ready");
+const takeSeatBtn = document.getElementById("take-seat");
+const leaveSeatBtn = document.getElementById("leave-seat");
+const hintBtn = document.getElementById("hint");
+const botControls = document.getElementById("bot-controls");
+const botSelect = document.getElementById("bot-select");
+const playersDiv = document.getElementById("players");
+const olderBtn = document.getElementById("older-messages");
+const channelSelect = document.getElementById("chat-channel");
 
 // Initial game values
 let currentPlayer = "X";
@@ -19,108 +28,170 @@ let activePlayer = "X";
 let gameStarted = false;
 let playerTotal = 0;
 let isReady = false;  // Track the player's readiness
-// Local chatMessages array
+let playerRole = "";  // "player" or "spectator"
+let playerID = "";
+let isHost = false;
+// emoji messages can be reacted with, and how long (seconds) our messages stay editable, from initialState
+let chatReactions = [];
+let chatEditWindow = 0;
+// Local chatMessages array, oldest first
 let chatMessages = [];
+// profiles of everyone in the lobby keyed by player ID, and who sits in each seat
+let profiles = {};
+let seats = {};
+// hints each player gets per game, 0 when the lobby gives none
+let hintsPerGame = 0;
+
+// visitors without an account (e.g. following an invite link) play as a guest,
+// the guest account is made here rather than for every page view
+if (document.body.dataset.signedIn === "true") {
+    connect();
+} else {
+    fetch("/api/v1/auth/guest", { method: "POST" })
+        .then((response) => {
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            connect();
+        })
+        .catch((error) => console.log("Error starting a guest session:", error));
+}
 
-// WebSocket connection opened
-ws.onopen = () => {
-
-    const userProfileJSON = localStorage.getItem('TTTprofile');
+// Opens the lobby's WebSocket, the server knows who we are from the session cookie
+function connect() {
+    ws = new WebSocket(`ws://localhost:8080/ws?lobby=${lobbyID}`);
+    ws.onopen = onOpen;
+    ws.onerror = onError;
+    ws.onclose = onClose;
+    ws.onmessage = onMessage;
+}
 
-    if (userProfileJSON) {
-        const userProfile = JSON.parse(userProfileJSON);
-        if (userProfile) {
-            // Send the cookie value to the server
-            ws.send(JSON.stringify({
-                type: "setUsername",
-                username: userProfile.Name,
-                id: userProfile.ID
-            }));
-        } else {
-            console.log("Local Storage Data not found");
-        }
-    } else {
-        console.log("Object not found in local storage.");
-    }
-};
+// WebSocket connection opened
+function onOpen() {
+    // joins the lobby
+    ws.send(JSON.stringify({ type: "setUsername" }));
+}
 
 // WebSocket connection error
-ws.onerror = (error) => {
+function onError(error) {
     console.log("WebSocket error:", error);
-};
+}
 
 // WebSocket connection closed
-ws.onclose = () => {
+function onClose() {
     console.log("WebSocket connection closed");
-};
+}
 
 // Handler for messages received from server
-ws.onmessage = (event) => {
+function onMessage(event) {
     const message = JSON.parse(event.data);
     switch (message.type) {
 
         case "initialState":
+            // profiles first so the board and chat can use them
+            profiles = message.profiles || {};
+            chatReactions = message.reactions || [];
+            chatEditWindow = message.chatEditWindow || 0;
+            seats = {};
+            (message.players || []).forEach(p => { seats[p.Symbol] = p.ID; });
+            renderPlayers();
+
             // Populate game board
-            message.gameBoard.forEach((symbol, index) => {
-                if (symbol) {
-                    gameBoard.children[index].textContent = symbol;
-                    gameBoard.children[index].style.pointerEvents = "none";
+            drawBoard(message.gameBoard);
+
+            // only the newest messages come with the state, older ones are paged in on request
+            messagesDiv.innerHTML = "";
+            chatMessages = [];
+            addChatMessages(message.chatMessages || []);
+            olderBtn.style.display = message.chatHasMore ? "" : "none";
+
+            activePlayer = message.currentTurn || "X";
+            gameStarted = message.gameStarted;
+
+            // lobby settings chosen by the creator
+            if (message.settings) {
+                document.getElementById("input").style.display = message.settings.chatEnabled ? "" : "none";
+                hintsPerGame = message.settings.rated ? 0 : (message.settings.hintsPerGame || 0);
+                if (message.settings.variant === "misere") {
+                    playerInfo.innerHTML = "Misère: three in a row <b>loses</b>!";
+                }
+                if (message.settings.puzzle) {
+                    playerInfo.innerHTML = `Puzzle ${message.settings.puzzle}, the solver defends. <a href="/puzzle?id=next">Next puzzle</a>`;
                 }
-            });
-
-            if (message.chatMessages && Array.isArray(message.chatMessages)) {
-                updateChatMessages(message.chatMessages);
-            }
-
-            break;
-
-
-        case "updatePlayers":
-            // Handle chat messages
-            if (message.chatMessages && Array.isArray(message.chatMessages)) {
-                updateChatMessages(message.chatMessages);
             }
 
-            // Other state updates (e.g., game board, players)
-            // Update gameBoard or other UI elements here
             break;
 
 
         case "lobbyFull":
-            username = message.usermame;
-            user.innerHTML = `YOU ARE SPECTATING AS <b>${username}</b>`;
+            // no seat and no spectator room left
             alert(message.text);
+            window.location.href = "/";
             break;
 
         case "assignPlayer":
             username = message.username;
             playerSymbol = message.symbol;
-            user.innerHTML = `YOU ARE PLAYING AS <b>${username}</b>`;
-            role.innerHTML = `Playing as: <b>${playerSymbol}<b>`
-
-            // Create the user profile object
-            const userProfile = {
-                ID: message.id, // Assuming the server sends the ID
-                Name: username,
-            };
+            playerRole = message.role;
+            playerID = message.id;
+            isHost = message.isHost;
+            showChannels();
+            if (message.profile) {
+                profiles[message.id] = message.profile;
+            }
+            setSeat(message.id, playerSymbol);
+            renderPlayers();
+            if (playerRole === "spectator") {
+                user.innerHTML = `YOU ARE SPECTATING AS <b>${username}</b>`;
+                role.innerHTML = "Spectating";
+            } else {
+                user.innerHTML = `YOU ARE PLAYING AS <b>${username}</b>`;
+                role.innerHTML = `Playing as: <b>${playerSymbol}<b>`
+            }
+            if (message.isHost) {
+                role.innerHTML += " (host)";
+                loadBots();
+            } else {
+                botControls.style.display = "none";
+            }
 
-            const userProfileJSON = JSON.stringify(userProfile);
+            // spectators don't get a ready button
+            readyDiv.style.display = message.canReady ? "" : "none";
+            leaveSeatBtn.style.display = message.canReady ? "" : "none";
+            hintBtn.style.display = message.canReady && hintsPerGame > 0 ? "" : "none";
+            takeSeatBtn.style.display = "none";
+            if (!message.canReady) {
+                isReady = false;
+                readyToggle.checked = false;
+            }
 
-            localStorage.setItem('TTTprofile', userProfileJSON);
             break;
 
         case "startGame":
             gameStarted = true
+            activePlayer = message.currentTurn || "X";
+            // practice lobbies start from a position instead of an empty board
+            if (message.board) {
+                resetBoard();
+                drawBoard(message.board);
+            }
+            break;
 
         // Handler for player moves
         case "move":
+            clearHint();
+            // clock ran out, resigned or draw agreed, no tile was played
+            if (message.position === -1) {
+                handleNext(message);
+                break;
+            }
             if (typeof message.position === "number" && message.position >= 0) {
                 const cell = gameBoard.children[message.position];
                 if (!cell) {
                     console.error("Invalid tile position", message.position);
                     return;
                 }
-                cell.textContent = message.symbol;
+                drawSymbol(cell, message.symbol);
                 cell.style.pointerEvents = "none";
                 handleNext(message); // Call handleNext *here*
             } else {
@@ -129,8 +200,64 @@ ws.onmessage = (event) => {
             break; // Break is essential here
 
         case "chat":
-            updateChatMessages(message.chatMessages)
+            // a command reply only we can see, it has no ID and isn't part of the history
+            if (message.private) {
+                messagesDiv.insertAdjacentHTML("beforeend", chatLine(message.message));
+                break;
+            }
+            // one new message
+            addChatMessages([message.message]);
+            break;
+
+        case "chatUpdate":
+            // edited, deleted or reacted to
+            updateChatMessage(message.message);
+            return; // keep the scroll position
+
+        case "chatHistory":
+            mergeChatMessages(message.messages);
+            // the button pages back through the all channel
+            if (message.channel === "all") {
+                olderBtn.style.display = message.hasMore ? "" : "none";
+            }
+            return; // keep the scroll position
+
+        case "profile":
+            // someone joined or changed their profile
+            profiles[message.profile.playerId] = message.profile;
+            if (message.symbol) {
+                setSeat(message.profile.playerId, message.symbol);
+            }
+            renderPlayers();
+            break;
+
+        case "chatRejected":
+            // only we see this, the message was not posted
+            appendSystemLine(message.text);
+            break;
+
+        case "hint":
+            // only we see the move, the GAMEMASTER tells everyone a hint was used
+            clearHint();
+            gameBoard.children[message.position].classList.add("hinted");
+            appendSystemLine(`Hint: ${message.square} ${outcomeText(message.outcome, message.moves)}, ${message.hintsLeft} left this game`);
+            break;
 
+        case "seatOpen":
+            if (playerRole === "spectator") {
+                takeSeatBtn.style.display = "";
+            }
+            break;
+
+        case "kicked":
+        case "banned":
+        case "lobbyClosed":
+            alert(message.text);
+            window.location.href = "/";
+            break;
+
+        case "error":
+            alert(message.text);
             break;
 
         default:
@@ -139,12 +266,12 @@ ws.onmessage = (event) => {
 
     // Auto-scroll chat
     messagesDiv.scrollTop = messagesDiv.scrollHeight;
-};
+}
 
 // Sends message to server when submit button is clicked
 function sendMessage() {
     const input = document.getElementById("message");
-    ws.send(JSON.stringify({ type: "chat", sender: username, text: input.value }));
+    ws.send(JSON.stringify({ type: "chat", channel: channelSelect.value, text: input.value }));
     input.value = "";
 }
 
@@ -155,7 +282,7 @@ function handleCellClick(e) {
     const position = cells.indexOf(cell);
 
     // Check if spectator
-    if (playerSymbol === "") {
+    if (playerRole !== "player") {
         alert("You are spectating and cannot play.");
         return;
     }
@@ -192,6 +319,57 @@ function toggleReady() {
         username: username
     }));
 }
+// Spectators can sit down in an empty seat
+function takeSeat() {
+    ws.send(JSON.stringify({ type: "takeSeat" }));
+}
+
+// Asks the solver for our best move, the lobby limits how many per game
+function requestHint() {
+    ws.send(JSON.stringify({ type: "hint" }));
+}
+
+// Removes the outline of the last hinted move
+function clearHint() {
+    Array.from(gameBoard.children).forEach(cell => cell.classList.remove("hinted"));
+}
+
+// e.g. "wins in 3"
+function outcomeText(outcome, moves) {
+    if (outcome === "win") return `wins in ${moves}`;
+    if (outcome === "loss") return `loses in ${moves}`;
+    return "draws";
+}
+
+// Players can give up their seat between games
+function leaveSeat() {
+    ws.send(JSON.stringify({ type: "leaveSeat" }));
+}
+
+// Hosts can seat any connected bot
+function loadBots() {
+    fetch("/api/v1/bots")
+        .then(response => response.json())
+        .then(bots => {
+            botSelect.innerHTML = "";
+            bots.filter(bot => bot.connected).forEach(bot => {
+                const option = document.createElement("option");
+                option.value = bot.id;
+                option.textContent = bot.name;
+                botSelect.appendChild(option);
+            });
+            botControls.style.display = botSelect.options.length > 0 ? "" : "none";
+        })
+        .catch(error => console.error("Error loading bots:", error));
+}
+
+function addBot() {
+    if (!botSelect.value) {
+        return;
+    }
+    ws.send(JSON.stringify({ type: "addBot", botId: botSelect.value }));
+}
+
 // Creates game board
 function createTicTacToeBoard() {
     gameBoard.innerHTML = "";  // Clear previous game board
@@ -205,57 +383,230 @@ function createTicTacToeBoard() {
 
 createTicTacToeBoard();  // Call this during page load
 
+// Draws the symbols of a whole board, leaving empty cells alone
+function drawBoard(board) {
+    board.forEach((symbol, index) => {
+        if (symbol) {
+            drawSymbol(gameBoard.children[index], symbol);
+            gameBoard.children[index].style.pointerEvents = "none";
+        }
+    });
+}
+
 // Reset Board with Style Reset
 function resetBoard() {
     Array.from(gameBoard.children).forEach((cell) => {
         cell.textContent = "";
         cell.style.pointerEvents = "auto"; // Reset pointer-events style
         cell.style.backgroundColor = "";  // Reset cell background
+        cell.style.color = "";
     });
 }
 
+// Moves a player to the seat for symbol, "S" (spectating) just frees their old seat
+function setSeat(playerID, symbol) {
+    Object.keys(seats).forEach(s => {
+        if (seats[s] === playerID) delete seats[s];
+    });
+    if (symbol === "X" || symbol === "O") {
+        seats[symbol] = playerID;
+    }
+}
 
-// Function to update chat messages
-function updateChatMessages(serverMessages) {
-    const localLength = chatMessages.length;
-    const serverLength = serverMessages.length;
+// Draws a symbol in the color its player picked in their profile
+function drawSymbol(cell, symbol) {
+    const profile = profiles[seats[symbol]];
+    const colors = profile ? profile.colors : {};
+    cell.textContent = symbol;
+    cell.style.color = colors[symbol.toLowerCase()] || "";
+}
 
-    // if new messages available
-    if (serverLength > localLength) {
-        // Add only the new messages
-        const newMessages = serverMessages.slice(localLength);
-        chatMessages = [...chatMessages, ...newMessages];
+// Shows the seated players next to the board with their avatar and record
+function renderPlayers() {
+    playersDiv.innerHTML = "";
+    ["X", "O"].forEach(symbol => {
+        const profile = profiles[seats[symbol]];
+        if (!profile) {
+            return;
+        }
+        const row = document.createElement("div");
+        row.className = "profile";
+        if (profile.avatar) {
+            const img = document.createElement("img");
+            img.src = profile.avatar;
+            img.alt = "";
+            row.appendChild(img);
+        }
+        const name = document.createElement("b");
+        name.textContent = `${symbol}: ${profile.displayName}`;
+        name.style.color = profile.colors[symbol.toLowerCase()] || "";
+        row.appendChild(name);
+        const stats = document.createElement("span");
+        stats.className = "stats";
+        stats.textContent = `${profile.stats.wins}W ${profile.stats.losses}L ${profile.stats.draws}D`;
+        row.appendChild(stats);
+        playersDiv.appendChild(row);
+    });
+}
+
+// chat only has the sender's name, which is unique, so find their profile by it
+function profileByName(name) {
+    return Object.values(profiles).find(p => p.displayName === name);
+}
+
+// Shows a line in the chat that only this player sees
+function appendSystemLine(text) {
+    const line = document.createElement("p");
+    line.className = "system-msg";
+    line.textContent = text;
+    messagesDiv.appendChild(line);
+}
 
-        // Render the new messages on the UI
-        renderMessages(newMessages);
+// Appends new messages, skipping any we already have (a reconnect resends the newest)
+function addChatMessages(messages) {
+    const lastID = chatMessages.length ? chatMessages[chatMessages.length - 1].ID : 0;
+    const fresh = messages.filter(m => m.ID > lastID);
+    chatMessages = [...chatMessages, ...fresh];
+    messagesDiv.insertAdjacentHTML("beforeend", fresh.map(chatLine).join(""));
+}
+
+// Adds a page of history (older messages, or another channel's) in ID order, without
+// moving what the player is reading
+function mergeChatMessages(messages) {
+    const known = new Set(chatMessages.map(m => m.ID));
+    const fresh = messages.filter(m => !known.has(m.ID));
+    const fromBottom = messagesDiv.scrollHeight - messagesDiv.scrollTop;
+    chatMessages = [...chatMessages, ...fresh].sort((a, b) => a.ID - b.ID);
+    messagesDiv.innerHTML = chatMessages.map(chatLine).join("");
+    messagesDiv.scrollTop = messagesDiv.scrollHeight - fromBottom;
+}
+
+// Asks the server for the page before the oldest message shown
+function loadOlderMessages() {
+    if (chatMessages.length) {
+        ws.send(JSON.stringify({ type: "chatHistory", channel: "all", before: chatMessages[0].ID }));
     }
 }
 
-// Function to render messages on the UI
-function renderMessages(messages) {
-    if (messages) {
-        // Check if 'messages' is an array or a single object
-        const isArray = Array.isArray(messages);
+// Offers the channels our seat can post to and fetches their history, which
+// initialState leaves out. whispers are sent with /w
+function showChannels() {
+    const own = playerRole === "spectator" ? "spectators" : "players";
+    for (const option of channelSelect.options) {
+        option.hidden = option.value !== "all" && option.value !== own;
+    }
+    if (channelSelect.selectedOptions[0].hidden) {
+        channelSelect.value = "all";
+    }
+    ws.send(JSON.stringify({ type: "chatHistory", channel: own }));
+    ws.send(JSON.stringify({ type: "chatHistory", channel: "whisper" }));
+}
 
-        // Create an array to handle both single object and array cases
-        const messagesArray = isArray ? messages : [messages];
+// Says who sees a message when it isn't everyone
+function channelLabel(chatMsg) {
+    switch (chatMsg.Channel) {
+        case "whisper":
+            return chatMsg.To === playerID ? "[whisper] " : `[to ${chatMsg.ToName}] `;
+        case "players":
+        case "spectators":
+            return `[${chatMsg.Channel}] `;
+        default:
+            return "";
+    }
+}
 
-        messagesArray.forEach(chatMsg => {
-            // Check if the message has already been added 
-            // (You might want to refine this logic based on your needs)
+// Builds the HTML for one chat message
+function chatLine(chatMsg) {
+    const timestamp = new Date(chatMsg.Timestamp).toLocaleString('en-US', { hour: 'numeric', minute: 'numeric', second: 'numeric', hour12: true });
 
-            // Check if sender is "GAMEMASTER" and add the "system-msg" class
-            const timestamp = new Date(chatMsg.Timestamp).toLocaleString('en-US', { hour: 'numeric', minute: 'numeric', second: 'numeric', hour12: true });
-            if (chatMsg.Sender === "GAMEMASTER") {
-                messagesDiv.innerHTML += `<p class="system-msg">${chatMsg.Sender}: ${chatMsg.Text} <span class="timestamp">(${timestamp})</span></p>`;
-            } else {
-                messagesDiv.innerHTML += `<p>${chatMsg.Sender}: ${chatMsg.Text} <span class="timestamp">(${timestamp})</span></p>`;
-            }
+    // command replies have no ID, they can't be changed
+    const id = chatMsg.ID ? ` data-id="${chatMsg.ID}"` : "";
+
+    if (chatMsg.Deleted) {
+        return `<p class="deleted"${id}>message deleted <span class="timestamp">(${timestamp})</span></p>`;
+    }
+    const extras = chatExtras(chatMsg);
+
+    // Check if sender is "GAMEMASTER" and add the "system-msg" class
+    if (chatMsg.Sender === "GAMEMASTER") {
+        return `<p class="system-msg"${id}>${chatMsg.Sender}: ${chatMsg.Text} <span class="timestamp">(${timestamp})</span>${extras}</p>`;
+    }
+    const profile = profileByName(chatMsg.Sender);
+    const avatar = profile && profile.thumbnail ? `<img class="chat-avatar" src="${profile.thumbnail}" alt="">` : "";
+    const label = channelLabel(chatMsg);
+    const cls = chatMsg.Channel ? ` class="channel-${chatMsg.Channel}"` : "";
+    // sent with /me
+    if (chatMsg.Emote) {
+        return `<p class="emote"${id}>${avatar}${label}* ${chatMsg.Sender} ${chatMsg.Text} <span class="timestamp">(${timestamp})</span>${extras}</p>`;
+    }
+    return `<p${cls}${id}>${avatar}${label}${chatMsg.Sender}: ${chatMsg.Text} <span class="timestamp">(${timestamp})</span>${extras}</p>`;
+}
+
+// The edited mark, reaction counts and, on hover, the buttons to react, edit and delete
+function chatExtras(chatMsg) {
+    if (!chatMsg.ID) {
+        return "";
+    }
+    let html = chatMsg.EditedAt ? ` <span class="edited">(edited)</span>` : "";
+
+    const counts = Object.entries(chatMsg.Reactions || {}).map(([emoji, ids]) => {
+        const mine = ids.includes(playerID) ? " mine" : "";
+        return `<button class="reaction${mine}" data-action="react" data-emoji="${emoji}">${emoji} ${ids.length}</button>`;
+    });
+    html += `<span class="reactions">${counts.join("")}</span>`;
+
+    let actions = chatReactions.map(emoji => `<button data-action="react" data-emoji="${emoji}">${emoji}</button>`).join("");
+    if (chatMsg.SenderID === playerID && Date.now() - new Date(chatMsg.Timestamp) < chatEditWindow * 1000) {
+        actions += `<button data-action="edit" title="Edit">✎</button>`;
+    }
+    if (chatMsg.SenderID === playerID || isHost) {
+        actions += `<button data-action="delete" title="Delete">🗑</button>`;
+    }
+    return html + `<span class="chat-actions">${actions}</span>`;
+}
 
-        });
+// Swaps in a message that was edited, deleted or reacted to
+function updateChatMessage(chatMsg) {
+    const index = chatMessages.findIndex(m => m.ID === chatMsg.ID);
+    if (index < 0) {
+        return; // not loaded, history will have the new version
+    }
+    chatMessages[index] = chatMsg;
+    const line = messagesDiv.querySelector(`[data-id="${chatMsg.ID}"]`);
+    if (line) {
+        line.outerHTML = chatLine(chatMsg);
     }
 }
 
+// Reaction, edit and delete buttons on chat messages
+messagesDiv.addEventListener("click", (e) => {
+    const button = e.target.closest("button[data-action]");
+    const line = button && button.closest("[data-id]");
+    if (!line) {
+        return;
+    }
+    const id = Number(line.dataset.id);
+
+    switch (button.dataset.action) {
+        case "react":
+            ws.send(JSON.stringify({ type: "chatReact", id: id, emoji: button.dataset.emoji }));
+            break;
+        case "edit": {
+            const chatMsg = chatMessages.find(m => m.ID === id);
+            const text = prompt("Edit your message", chatMsg ? chatMsg.Text : "");
+            if (text !== null && (!chatMsg || text !== chatMsg.Text)) {
+                ws.send(JSON.stringify({ type: "chatEdit", id: id, text: text }));
+            }
+            break;
+        }
+        case "delete":
+            if (confirm("Delete this message?")) {
+                ws.send(JSON.stringify({ type: "chatDelete", id: id }));
+            }
+            break;
+    }
+});
+
 function handleNext(message) {
     switch (message.next) {
         case "updateTurn":
@@ -280,6 +631,8 @@ function handleNext(message) {
             break;
 
         case "draw":
+        case "timeout":
+        case "resign":
             gameStarted = false
             isReady = false
             alert(message.text);  // Show the winner